@@ -1,26 +1,52 @@
 package generate
 
 import (
+	"errors"
 	"fmt"
 	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/evolve"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/compose"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/helm"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/fakeservice"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/istio"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/kuma"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/linkerd"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/kustomize"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/nomad"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/yaml"
+	"github.com/lahabana/microservice-mesh-generator/pkg/render"
+	"github.com/lahabana/microservice-mesh-generator/pkg/simulate"
+	"github.com/lahabana/microservice-mesh-generator/pkg/stats"
 	"github.com/lahabana/microservice-mesh-generator/pkg/version"
 	"io"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 type Config struct {
-	K8s          bool
-	Output       string
-	K8sApp       string
-	K8sNamespace string
-	Kuma         bool
-	Seed         int64
-	Writer       io.Writer
+	K8s             bool
+	Output          string
+	K8sApp          string
+	K8sNamespace    string
+	Kuma            bool
+	Istio           bool
+	Linkerd         bool
+	NetworkPolicies bool
+	Seed            int64
+	Writer          io.Writer
+	// Simulation the configuration of the simulation (only useful if output is simulation or simulation-json).
+	Simulation simulate.Config
+	// OutputDir where to write outputs with multiple files (helm, kustomize), they are written as an archive to Writer if empty.
+	OutputDir string
+	// Evolution the configuration of the mutations applied to the graph, each step is written to OutputDir when Steps > 0.
+	Evolution evolve.Config
+	// DotRich adds labels, colors and ranks to the graph (only useful if output is dot).
+	DotRich bool
+	// DotCluster groups services by this label or by tier (only useful if output is dot).
+	DotCluster string
 }
 
 var DefaultConfig = func() Config {
@@ -31,6 +57,8 @@ var DefaultConfig = func() Config {
 		K8sNamespace: "microservice-mesh",
 		Output:       "yaml",
 		K8s:          false,
+		Simulation:   simulate.DefaultConfig(),
+		Evolution:    evolve.Config{MinReplicas: 1, MaxReplicas: 3},
 	}
 }
 
@@ -47,38 +75,208 @@ func (e *InvalidConfError) Is(target error) bool {
 	return ok
 }
 
-func Run(conf Config, genFn func(seed int64) (apis.ServiceGraph, error)) error {
-	commentMarker := "#"
-	var generator apis.Generator
+// k8sOpts returns the options to generate the workloads and the ones to add a mesh to them.
+func k8sOpts(conf Config) ([]k8s.Option, []k8s.Option, error) {
+	var opts []k8s.Option
+	switch conf.K8sApp {
+	case "api-play":
+		opts = apiplay.GeneratorOpts()
+	case "fake-service":
+		opts = fakeservice.GeneratorOpts()
+	default:
+		return nil, nil, &InvalidConfError{msg: fmt.Sprintf("invalid k8sApp '%s' supported: api-play or fake-service", conf.K8sApp)}
+	}
+	opts = append(opts, k8s.WithNamespace(conf.K8sNamespace))
+	if conf.NetworkPolicies {
+		opts = append(opts, k8s.WithNetworkPolicies())
+	}
+	meshes := 0
+	for _, enabled := range []bool{conf.Kuma, conf.Istio, conf.Linkerd} {
+		if enabled {
+			meshes++
+		}
+	}
+	if meshes > 1 {
+		return nil, nil, &InvalidConfError{msg: "only one of kuma, istio or linkerd can be used"}
+	}
+	var meshOpts []k8s.Option
+	if conf.Kuma {
+		meshOpts = kuma.GeneratorOpts(kuma.DefaultConfig())
+	}
+	if conf.Istio {
+		meshOpts = istio.GeneratorOpts(istio.DefaultConfig())
+	}
+	if conf.Linkerd {
+		meshOpts = linkerd.GeneratorOpts(linkerd.DefaultConfig())
+	}
+	return opts, meshOpts, nil
+}
+
+// filesGenerator a generator of outputs with multiple files.
+type filesGenerator interface {
+	apis.Generator
+	WriteDir(dir string, graph apis.ServiceGraph) error
+}
+
+// output how to write a graph in the format of the config.
+type output struct {
+	generator apis.Generator
+	// files is set for outputs with multiple files.
+	files         filesGenerator
+	commentMarker string
+	runParams     string
+	// extension of the file when the output is written in a directory.
+	extension string
+}
+
+func newOutput(conf Config) (output, error) {
+	out := output{
+		commentMarker: "#",
+		runParams:     fmt.Sprintf("package:%s,version:%s,commit:%s,seed:%d", version.Name, version.Version, version.Commit, conf.Seed),
+		extension:     "yaml",
+	}
 	switch conf.Output {
 	case "k8s":
-		var opts []k8s.Option
-		switch conf.K8sApp {
-		case "api-play":
-			opts = apiplay.GeneratorOpts()
-		case "fake-service":
-			opts = fakeservice.GeneratorOpts()
-		default:
-			return &InvalidConfError{msg: fmt.Sprintf("invalid k8sApp '%s' supported: api-play or fake-service", conf.K8sApp)}
-		}
-		opts = append(opts, k8s.WithNamespace(conf.K8sNamespace))
-		k8sGenerator, err := k8s.NewGenerator(opts...)
+		opts, meshOpts, err := k8sOpts(conf)
+		if err != nil {
+			return out, err
+		}
+		k8sGenerator, err := k8s.NewGenerator(append(opts, meshOpts...)...)
+		if err != nil {
+			return out, err
+		}
+		out.generator = k8sGenerator
+	case "helm":
+		opts, meshOpts, err := k8sOpts(conf)
+		if err != nil {
+			return out, err
+		}
+		chart, err := helm.NewGenerator(conf.K8sNamespace, append(opts, meshOpts...)...)
+		if err != nil {
+			return out, err
+		}
+		chart.Annotations = map[string]string{"runParameters": out.runParams}
+		out.commentMarker, out.extension = "", "tgz"
+		out.generator, out.files = chart, chart
+	case "kustomize":
+		opts, meshOpts, err := k8sOpts(conf)
+		if err != nil {
+			return out, err
+		}
+		kustomizeOpts := []kustomize.Option{kustomize.WithScaledDownOverlay(1)}
+		if len(meshOpts) > 0 {
+			kustomizeOpts = append(kustomizeOpts, kustomize.WithMeshOverlay(meshOpts...))
+		}
+		layout, err := kustomize.NewGenerator(conf.K8sNamespace, opts, kustomizeOpts...)
+		if err != nil {
+			return out, err
+		}
+		out.commentMarker, out.extension = "", "tgz"
+		out.generator, out.files = layout, layout
+	case "compose":
+		opts, meshOpts, err := k8sOpts(conf)
+		if err != nil {
+			return out, err
+		}
+		if len(meshOpts) > 0 {
+			return out, &InvalidConfError{msg: "mesh add-ons are not supported with compose"}
+		}
+		out.generator, err = compose.NewGenerator(opts)
+		if err != nil {
+			return out, err
+		}
+	case "nomad", "nomad-json":
+		opts, meshOpts, err := k8sOpts(conf)
+		if err != nil {
+			return out, err
+		}
+		if len(meshOpts) > 0 {
+			return out, &InvalidConfError{msg: fmt.Sprintf("mesh add-ons are not supported with %s", conf.Output)}
+		}
+		nomadConf := nomad.DefaultConfig()
+		out.extension = "nomad.hcl"
+		if conf.Output == "nomad-json" {
+			nomadConf.JSON = true
+			out.commentMarker, out.extension = "", "json"
+		}
+		out.generator, err = nomad.NewGenerator(nomadConf, opts...)
 		if err != nil {
-			return err
+			return out, err
+		}
+	case "simulation", "simulation-json":
+		simulationConf := conf.Simulation
+		simulationConf.Seed = conf.Seed
+		out.extension = "txt"
+		if conf.Output == "simulation-json" {
+			simulationConf.JSON = true
+			out.commentMarker, out.extension = "", "json"
+		}
+		out.generator = simulate.Generator{Config: simulationConf}
+	case "stats", "stats-json":
+		statsGenerator := stats.Generator{}
+		out.extension = "txt"
+		if conf.Output == "stats-json" {
+			statsGenerator.JSON = true
+			out.commentMarker, out.extension = "", "json"
 		}
-		generator = k8sGenerator
+		out.generator = statsGenerator
 	case "dot":
-		generator = apis.DotGenerator
+		var dotOpts []apis.DotOption
+		if conf.DotRich {
+			dotOpts = apis.RichDotOpts()
+		}
+		if conf.DotCluster != "" {
+			dotOpts = append(dotOpts, apis.WithDotClusters(conf.DotCluster))
+		}
+		generator, err := apis.NewDotGenerator(dotOpts...)
+		if err != nil {
+			return out, &InvalidConfError{msg: err.Error()}
+		}
+		out.generator, out.extension = generator, "dot"
+	case "svg":
+		// The generation params are in the `<desc>` of the image.
+		out.commentMarker, out.extension = "", "svg"
+		out.generator = render.SVGGenerator
+	case "png":
+		out.commentMarker, out.extension = "", "png"
+		out.generator = render.PNGGenerator
 	case "mermaid":
-		commentMarker = "%%"
-		generator = apis.MermaidGenerator
+		out.commentMarker, out.extension = "%%", "mmd"
+		out.generator = apis.MermaidGenerator
 	case "yaml":
-		generator = yaml.Generator
+		out.generator = yaml.Generator
 	case "json":
-		commentMarker = ""
-		generator = apis.JsonGenerator
+		out.commentMarker, out.extension = "", "json"
+		out.generator = apis.JsonGenerator
 	default:
-		return &InvalidConfError{msg: fmt.Sprintf("format '%s' not supported accepted format: k8s, yaml, dot, mermaid, json", conf.Output)}
+		return out, &InvalidConfError{msg: fmt.Sprintf("format '%s' not supported accepted format: k8s, helm, kustomize, compose, nomad, nomad-json, simulation, simulation-json, stats, stats-json, yaml, dot, svg, png, mermaid, json", conf.Output)}
+	}
+	return out, nil
+}
+
+// write writes a graph to the writer (or to dir if it's set and the output has multiple files).
+func (o output) write(writer io.Writer, dir string, serviceGraph apis.ServiceGraph) error {
+	if o.commentMarker != "" {
+		_, _ = fmt.Fprintf(writer, "%s runParameters=%s\n", o.commentMarker, o.runParams)
+		_, _ = fmt.Fprintf(writer, "%s generationParameters=%s\n", o.commentMarker, serviceGraph.GenerationParams)
+	}
+	var err error
+	// Outputs with multiple files are written as an archive unless an output directory is set.
+	if o.files != nil && dir != "" {
+		err = o.files.WriteDir(dir, serviceGraph)
+	} else {
+		err = o.generator.Apply(writer, serviceGraph)
+	}
+	if errors.Is(err, fakeservice.ErrUnsupportedEdge) {
+		return &InvalidConfError{msg: err.Error()}
+	}
+	return err
+}
+
+func Run(conf Config, genFn func(seed int64) (apis.ServiceGraph, error)) error {
+	out, err := newOutput(conf)
+	if err != nil {
+		return err
 	}
 	serviceGraph, err := genFn(conf.Seed)
 	if err != nil {
@@ -87,9 +285,66 @@ func Run(conf Config, genFn func(seed int64) (apis.ServiceGraph, error)) error {
 	if err := serviceGraph.Validate(); err != nil {
 		return &InvalidConfError{msg: err.Error()}
 	}
-	if commentMarker != "" {
-		_, _ = fmt.Fprintf(conf.Writer, "%s runParameters=package:%s,version:%s,commit:%s,seed:%d\n", commentMarker, version.Name, version.Version, version.Commit, conf.Seed)
-		_, _ = fmt.Fprintf(conf.Writer, "%s generationParameters=%s\n", commentMarker, serviceGraph.GenerationParams)
+	if conf.Evolution.Steps > 0 {
+		return runEvolution(conf, out, serviceGraph)
+	}
+	return out.write(conf.Writer, conf.OutputDir, serviceGraph)
+}
+
+// runEvolution writes each step of the evolution of the graph as `step-<n>.<extension>` (or a `step-<n>` directory for outputs with multiple files) in conf.OutputDir
+// and lists the mutations to conf.Writer. Steps are written one after the other to conf.Writer if conf.OutputDir is empty
+// which is only possible for outputs with comments to separate them (other outputs like archives, images or json can't be concatenated).
+func runEvolution(conf Config, out output, serviceGraph apis.ServiceGraph) error {
+	if conf.OutputDir == "" && out.commentMarker == "" {
+		return &InvalidConfError{msg: fmt.Sprintf("evolving the mesh with output '%s' requires an output directory", conf.Output)}
+	}
+	evolveConf := conf.Evolution
+	evolveConf.Seed = conf.Seed
+	steps, err := evolve.Evolve(serviceGraph, evolveConf)
+	if err != nil {
+		return &InvalidConfError{msg: err.Error()}
+	}
+	for i, step := range steps {
+		description := "initial"
+		if step.Mutation != "" {
+			description = fmt.Sprintf("%s: %s", step.Mutation, step.Description)
+		}
+		if conf.OutputDir == "" {
+			if out.commentMarker != "" {
+				_, _ = fmt.Fprintf(conf.Writer, "%s step=%d %s\n", out.commentMarker, i, description)
+			}
+			if err := out.write(conf.Writer, "", step.Graph); err != nil {
+				return err
+			}
+			continue
+		}
+		name := fmt.Sprintf("step-%03d", i)
+		if out.files != nil {
+			if err := out.write(conf.Writer, filepath.Join(conf.OutputDir, name), step.Graph); err != nil {
+				return err
+			}
+		} else {
+			name = fmt.Sprintf("%s.%s", name, out.extension)
+			if err := writeFile(filepath.Join(conf.OutputDir, name), out, step.Graph); err != nil {
+				return err
+			}
+		}
+		_, _ = fmt.Fprintf(conf.Writer, "%s %s\n", name, description)
+	}
+	return nil
+}
+
+func writeFile(path string, out output, serviceGraph apis.ServiceGraph) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := out.write(f, "", serviceGraph); err != nil {
+		_ = f.Close()
+		return err
 	}
-	return generator.Apply(conf.Writer, serviceGraph)
+	return f.Close()
 }
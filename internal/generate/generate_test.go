@@ -0,0 +1,60 @@
+package generate_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/lahabana/microservice-mesh-generator/internal/generate"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func genFn(seed int64) (apis.ServiceGraph, error) {
+	return apis.GenerateRandomMesh(seed, 5, 50, 1, 2), nil
+}
+
+func TestEvolution(t *testing.T) {
+	for _, output := range []string{"json", "svg", "png", "helm", "kustomize", "nomad-json"} {
+		conf := generate.DefaultConfig()
+		conf.Seed = 1
+		conf.Output = output
+		conf.Writer = &bytes.Buffer{}
+		conf.Evolution.Steps = 2
+		err := generate.Run(conf, genFn)
+		if !errors.Is(err, &generate.InvalidConfError{}) || !strings.Contains(err.Error(), "requires an output directory") {
+			t.Errorf("output: %s, expected an error without outputDir, got: %v", output, err)
+		}
+
+		conf.OutputDir = t.TempDir()
+		if err := generate.Run(conf, genFn); err != nil {
+			t.Fatalf("output: %s, failed with outputDir: %v", output, err)
+		}
+		entries, err := os.ReadDir(conf.OutputDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 3 {
+			t.Errorf("output: %s, expected 3 steps in outputDir, got: %d", output, len(entries))
+		}
+		if !strings.HasPrefix(entries[0].Name(), "step-000") {
+			t.Errorf("output: %s, unexpected step name: %s", output, filepath.Join(conf.OutputDir, entries[0].Name()))
+		}
+	}
+
+	// Outputs with comments separate the steps.
+	conf := generate.DefaultConfig()
+	conf.Seed = 1
+	buf := &bytes.Buffer{}
+	conf.Writer = buf
+	conf.Evolution.Steps = 2
+	if err := generate.Run(conf, genFn); err != nil {
+		t.Fatal("failed", err)
+	}
+	for _, expected := range []string{"# step=0 initial", "# step=1 ", "# step=2 "} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+}
@@ -4,6 +4,7 @@
 package restapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -11,6 +12,12 @@ import (
 	"github.com/oapi-codegen/runtime"
 )
 
+// Defines values for EdgeEntryProtocol.
+const (
+	Grpc EdgeEntryProtocol = "grpc"
+	Http EdgeEntryProtocol = "http"
+)
+
 // Defines values for K8sAppType.
 const (
 	ApiPlay     K8sAppType = "api-play"
@@ -23,14 +30,39 @@ const (
 	Gv    OutputFormat = "gv"
 	Json  OutputFormat = "json"
 	Mmd   OutputFormat = "mmd"
+	Png   OutputFormat = "png"
+	Svg   OutputFormat = "svg"
+	Tgz   OutputFormat = "tgz"
 	Yaml  OutputFormat = "yaml"
 )
 
+// Defines values for ServiceRole.
+const (
+	Backend  ServiceRole = "backend"
+	Database ServiceRole = "database"
+	Frontend ServiceRole = "frontend"
+	Gateway  ServiceRole = "gateway"
+	Queue    ServiceRole = "queue"
+)
+
+// Defines values for TopologyType.
+const (
+	Random    TopologyType = "random"
+	Scalefree TopologyType = "scalefree"
+	Tiered    TopologyType = "tiered"
+)
+
 // CatalogItem defines model for CatalogItem.
 type CatalogItem struct {
 	Definition  MeshDefinition `json:"definition"`
 	Description string         `json:"description"`
-	Title       string         `json:"title"`
+
+	// Name the name of the preset (to use with the `-preset` flag)
+	Name string `json:"name"`
+
+	// Source a link to the original project
+	Source *string `json:"source,omitempty"`
+	Title  string  `json:"title"`
 }
 
 // CatalogResponse defines model for CatalogResponse.
@@ -38,6 +70,39 @@ type CatalogResponse struct {
 	Entries []CatalogItem `json:"entries"`
 }
 
+// EdgeEntry defines model for EdgeEntry.
+type EdgeEntry struct {
+	// ErrorRate the ratio of calls that should fail
+	ErrorRate *float32 `json:"errorRate,omitempty"`
+
+	// LatencyMs the latency to inject on the call
+	LatencyMs *int               `json:"latencyMs,omitempty"`
+	Protocol  *EdgeEntryProtocol `json:"protocol,omitempty"`
+
+	// Retries the number of retries on failure
+	Retries *int `json:"retries,omitempty"`
+
+	// Target the index of the service called
+	Target int `json:"target"`
+
+	// TimeoutMs the timeout of the call
+	TimeoutMs *int `json:"timeoutMs,omitempty"`
+
+	// Weight the number of calls per request
+	Weight *int `json:"weight,omitempty"`
+}
+
+// EdgeEntryProtocol defines model for EdgeEntry.Protocol.
+type EdgeEntryProtocol string
+
+// EdgeRef the index of the service called or an edge with its attributes
+type EdgeRef struct {
+	union json.RawMessage
+}
+
+// EdgeRef0 defines model for .
+type EdgeRef0 = int
+
 // ErrorResponse defines model for ErrorResponse.
 type ErrorResponse struct {
 	Details           string              `json:"details"`
@@ -67,8 +132,22 @@ type InvalidParameter struct {
 // K8sAppType defines model for K8sAppType.
 type K8sAppType string
 
+// MeshDefaults mesh wide settings for calls, edges can override them
+type MeshDefaults struct {
+	// CircuitBreakerErrors the number of consecutive errors after which an instance is ejected
+	CircuitBreakerErrors *int `json:"circuitBreakerErrors,omitempty"`
+
+	// Retries the number of retries on failure
+	Retries *int `json:"retries,omitempty"`
+
+	// TimeoutMs the timeout of calls
+	TimeoutMs *int `json:"timeoutMs,omitempty"`
+}
+
 // MeshDefinition defines model for MeshDefinition.
 type MeshDefinition struct {
+	// Defaults mesh wide settings for calls, edges can override them
+	Defaults *MeshDefaults  `json:"defaults,omitempty"`
 	Services []ServiceEntry `json:"services"`
 }
 
@@ -80,10 +159,63 @@ type OutputFormat string
 
 // ServiceEntry defines model for ServiceEntry.
 type ServiceEntry struct {
-	Edges    []int `json:"edges"`
-	Replicas int   `json:"replicas"`
+	Edges []EdgeRef `json:"edges"`
+
+	// Labels labels added to the kubernetes objects of the service
+	Labels *map[string]string `json:"labels,omitempty"`
+
+	// Name a human readable name for the service (must be unique)
+	Name     *string      `json:"name,omitempty"`
+	Replicas int          `json:"replicas"`
+	Role     *ServiceRole `json:"role,omitempty"`
+
+	// Tier the layer of the mesh the service belongs to
+	Tier *string `json:"tier,omitempty"`
 }
 
+// ServiceRole defines model for ServiceRole.
+type ServiceRole string
+
+// ServiceStats defines model for ServiceStats.
+type ServiceStats struct {
+	// Betweenness the betweenness centrality of the service
+	Betweenness float32 `json:"betweenness"`
+
+	// Depth the number of calls of the longest chain from an entry service to this service
+	Depth   int    `json:"depth"`
+	FanIn   int    `json:"fanIn"`
+	FanOut  int    `json:"fanOut"`
+	Service string `json:"service"`
+}
+
+// StatsResponse defines model for StatsResponse.
+type StatsResponse struct {
+	AvgFanIn  float32 `json:"avgFanIn"`
+	AvgFanOut float32 `json:"avgFanOut"`
+
+	// Components the groups of services connected by calls (ignoring the direction of the calls)
+	Components [][]string `json:"components"`
+
+	// Edges the number of edges (multiple edges between 2 services are counted once)
+	Edges int `json:"edges"`
+
+	// Entries the services no one calls
+	Entries []string `json:"entries"`
+
+	// Leaves the services calling no one
+	Leaves []string `json:"leaves"`
+
+	// LongestChain the services of the longest call chain
+	LongestChain []string       `json:"longestChain"`
+	MaxFanIn     int            `json:"maxFanIn"`
+	MaxFanOut    int            `json:"maxFanOut"`
+	PerService   []ServiceStats `json:"perService"`
+	Services     int            `json:"services"`
+}
+
+// TopologyType defines model for TopologyType.
+type TopologyType string
+
 // PostApiDefineFormatParams defines parameters for PostApiDefineFormat.
 type PostApiDefineFormatParams struct {
 	// K8sApp The app to use
@@ -95,6 +227,18 @@ type PostApiDefineFormatParams struct {
 	// K8s whether or not to return kubernetes manifest
 	K8s *bool `form:"k8s,omitempty" json:"k8s,omitempty"`
 
+	// Kuma whether or not to add Kuma sidecar injection and policies to the kubernetes manifest
+	Kuma *bool `form:"kuma,omitempty" json:"kuma,omitempty"`
+
+	// Istio whether or not to add Istio sidecar injection and resources to the kubernetes manifest
+	Istio *bool `form:"istio,omitempty" json:"istio,omitempty"`
+
+	// Linkerd whether or not to add Linkerd proxy injection and policies to the kubernetes manifest
+	Linkerd *bool `form:"linkerd,omitempty" json:"linkerd,omitempty"`
+
+	// NetworkPolicies whether or not to add NetworkPolicies which only allow the calls of the mesh to the kubernetes manifest
+	NetworkPolicies *bool `form:"networkPolicies,omitempty" json:"networkPolicies,omitempty"`
+
 	// NumServices integer of services to run
 	NumServices *int `form:"numServices,omitempty" json:"numServices,omitempty"`
 
@@ -122,6 +266,18 @@ type GenerateRandomParams struct {
 	// K8s whether or not to return kubernetes manifest
 	K8s *bool `form:"k8s,omitempty" json:"k8s,omitempty"`
 
+	// Kuma whether or not to add Kuma sidecar injection and policies to the kubernetes manifest
+	Kuma *bool `form:"kuma,omitempty" json:"kuma,omitempty"`
+
+	// Istio whether or not to add Istio sidecar injection and resources to the kubernetes manifest
+	Istio *bool `form:"istio,omitempty" json:"istio,omitempty"`
+
+	// Linkerd whether or not to add Linkerd proxy injection and policies to the kubernetes manifest
+	Linkerd *bool `form:"linkerd,omitempty" json:"linkerd,omitempty"`
+
+	// NetworkPolicies whether or not to add NetworkPolicies which only allow the calls of the mesh to the kubernetes manifest
+	NetworkPolicies *bool `form:"networkPolicies,omitempty" json:"networkPolicies,omitempty"`
+
 	// NumServices integer of services to run
 	NumServices *int `form:"numServices,omitempty" json:"numServices,omitempty"`
 
@@ -133,11 +289,91 @@ type GenerateRandomParams struct {
 
 	// PercentEdge maximum number of replicas per service
 	PercentEdge *int `form:"percentEdge,omitempty" json:"percentEdge,omitempty"`
+
+	// Topology the algorithm used to generate the mesh
+	Topology *TopologyType `form:"topology,omitempty" json:"topology,omitempty"`
+
+	// Attachment number of services each service calls (only for scalefree topology)
+	Attachment *int `form:"attachment,omitempty" json:"attachment,omitempty"`
+
+	// HubBias percentage of calls which favor already called services (only for scalefree topology)
+	HubBias *int `form:"hubBias,omitempty" json:"hubBias,omitempty"`
+
+	// Layers number of services in each layer (only for tiered topology)
+	Layers *[]int `form:"layers,omitempty" json:"layers,omitempty"`
+
+	// LayerPercentEdges chance for an edge between 2 consecutive layers to exist (only for tiered topology)
+	LayerPercentEdges *[]int `form:"layerPercentEdges,omitempty" json:"layerPercentEdges,omitempty"`
 }
 
 // PostApiDefineFormatJSONRequestBody defines body for PostApiDefineFormat for application/json ContentType.
 type PostApiDefineFormatJSONRequestBody = MeshDefinition
 
+// PostApiStatsJSONRequestBody defines body for PostApiStats for application/json ContentType.
+type PostApiStatsJSONRequestBody = MeshDefinition
+
+// AsEdgeRef0 returns the union data inside the EdgeRef as a EdgeRef0
+func (t EdgeRef) AsEdgeRef0() (EdgeRef0, error) {
+	var body EdgeRef0
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromEdgeRef0 overwrites any union data inside the EdgeRef as the provided EdgeRef0
+func (t *EdgeRef) FromEdgeRef0(v EdgeRef0) error {
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeEdgeRef0 performs a merge with any union data inside the EdgeRef, using the provided EdgeRef0
+func (t *EdgeRef) MergeEdgeRef0(v EdgeRef0) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JsonMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
+// AsEdgeEntry returns the union data inside the EdgeRef as a EdgeEntry
+func (t EdgeRef) AsEdgeEntry() (EdgeEntry, error) {
+	var body EdgeEntry
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromEdgeEntry overwrites any union data inside the EdgeRef as the provided EdgeEntry
+func (t *EdgeRef) FromEdgeEntry(v EdgeEntry) error {
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeEdgeEntry performs a merge with any union data inside the EdgeRef, using the provided EdgeEntry
+func (t *EdgeRef) MergeEdgeEntry(v EdgeEntry) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JsonMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
+func (t EdgeRef) MarshalJSON() ([]byte, error) {
+	b, err := t.union.MarshalJSON()
+	return b, err
+}
+
+func (t *EdgeRef) UnmarshalJSON(b []byte) error {
+	err := t.union.UnmarshalJSON(b)
+	return err
+}
+
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
 	// home
@@ -152,6 +388,9 @@ type ServerInterface interface {
 	// generate a random mesh
 	// (GET /api/random.{format})
 	GenerateRandom(c *gin.Context, format OutputFormat, params GenerateRandomParams)
+
+	// (POST /api/stats)
+	PostApiStats(c *gin.Context)
 	// healthcheck
 	// (GET /health)
 	Health(c *gin.Context)
@@ -236,6 +475,38 @@ func (siw *ServerInterfaceWrapper) PostApiDefineFormat(c *gin.Context) {
 		return
 	}
 
+	// ------------- Optional query parameter "kuma" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "kuma", c.Request.URL.Query(), &params.Kuma)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter kuma: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "istio" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "istio", c.Request.URL.Query(), &params.Istio)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter istio: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "linkerd" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "linkerd", c.Request.URL.Query(), &params.Linkerd)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter linkerd: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "networkPolicies" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "networkPolicies", c.Request.URL.Query(), &params.NetworkPolicies)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter networkPolicies: %w", err), http.StatusBadRequest)
+		return
+	}
+
 	// ------------- Optional query parameter "numServices" -------------
 
 	err = runtime.BindQueryParameter("form", true, false, "numServices", c.Request.URL.Query(), &params.NumServices)
@@ -327,6 +598,38 @@ func (siw *ServerInterfaceWrapper) GenerateRandom(c *gin.Context) {
 		return
 	}
 
+	// ------------- Optional query parameter "kuma" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "kuma", c.Request.URL.Query(), &params.Kuma)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter kuma: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "istio" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "istio", c.Request.URL.Query(), &params.Istio)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter istio: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "linkerd" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "linkerd", c.Request.URL.Query(), &params.Linkerd)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter linkerd: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "networkPolicies" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "networkPolicies", c.Request.URL.Query(), &params.NetworkPolicies)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter networkPolicies: %w", err), http.StatusBadRequest)
+		return
+	}
+
 	// ------------- Optional query parameter "numServices" -------------
 
 	err = runtime.BindQueryParameter("form", true, false, "numServices", c.Request.URL.Query(), &params.NumServices)
@@ -359,6 +662,46 @@ func (siw *ServerInterfaceWrapper) GenerateRandom(c *gin.Context) {
 		return
 	}
 
+	// ------------- Optional query parameter "topology" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "topology", c.Request.URL.Query(), &params.Topology)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter topology: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "attachment" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "attachment", c.Request.URL.Query(), &params.Attachment)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter attachment: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "hubBias" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "hubBias", c.Request.URL.Query(), &params.HubBias)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter hubBias: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "layers" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "layers", c.Request.URL.Query(), &params.Layers)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter layers: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "layerPercentEdges" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "layerPercentEdges", c.Request.URL.Query(), &params.LayerPercentEdges)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter layerPercentEdges: %w", err), http.StatusBadRequest)
+		return
+	}
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -369,6 +712,19 @@ func (siw *ServerInterfaceWrapper) GenerateRandom(c *gin.Context) {
 	siw.Handler.GenerateRandom(c, format, params)
 }
 
+// PostApiStats operation middleware
+func (siw *ServerInterfaceWrapper) PostApiStats(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.PostApiStats(c)
+}
+
 // Health operation middleware
 func (siw *ServerInterfaceWrapper) Health(c *gin.Context) {
 
@@ -426,6 +782,7 @@ func RegisterHandlersWithOptions(router gin.IRouter, si ServerInterface, options
 	router.GET(options.BaseURL+"/api/catalog", wrapper.GetApiCatalog)
 	router.POST(options.BaseURL+"/api/define.:format", wrapper.PostApiDefineFormat)
 	router.GET(options.BaseURL+"/api/random.:format", wrapper.GenerateRandom)
+	router.POST(options.BaseURL+"/api/stats", wrapper.PostApiStats)
 	router.GET(options.BaseURL+"/health", wrapper.Health)
 	router.GET(options.BaseURL+"/ready", wrapper.Ready)
 }
@@ -10,8 +10,12 @@ import (
 	"github.com/lahabana/microservice-mesh-generator/internal/restapi"
 	"github.com/lahabana/microservice-mesh-generator/internal/server/www"
 	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/catalog"
+	"github.com/lahabana/microservice-mesh-generator/pkg/render"
+	"github.com/lahabana/microservice-mesh-generator/pkg/stats"
 	"github.com/lahabana/microservice-mesh-generator/pkg/version"
 	"github.com/lahabana/otel-gin/pkg/observability"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
@@ -23,42 +27,149 @@ type srv struct {
 }
 
 func (s *srv) GetApiCatalog(c *gin.Context) {
-	c.PureJSON(http.StatusOK, restapi.CatalogResponse{
-		Entries: []restapi.CatalogItem{
-			{
-				Title:       "simple-multi-service",
-				Description: "a list of simple services",
-				Definition: restapi.MeshDefinition{
-					Services: []restapi.ServiceEntry{
-						{Edges: []int{1, 2}, Replicas: 2},
-						{Edges: []int{}, Replicas: 2},
-						{Edges: []int{3}, Replicas: 2},
-						{Replicas: 2},
-					},
-				},
-			},
-		},
-	})
+	entries, err := catalog.List()
+	if err != nil {
+		s.l.ErrorContext(c.Request.Context(), "failed to list catalog", "error", err)
+		c.PureJSON(http.StatusInternalServerError, restapi.ErrorResponse{
+			Status:  http.StatusInternalServerError,
+			Details: "internal error",
+		})
+		return
+	}
+	res := restapi.CatalogResponse{Entries: []restapi.CatalogItem{}}
+	for _, e := range entries {
+		item := restapi.CatalogItem{
+			Name:        e.Name,
+			Title:       e.Title,
+			Description: e.Description,
+			Definition:  toMeshDefinition(e.Graph()),
+		}
+		if e.Source != "" {
+			source := e.Source
+			item.Source = &source
+		}
+		res.Entries = append(res.Entries, item)
+	}
+	c.PureJSON(http.StatusOK, res)
 }
 
-func (s *srv) PostApiDefineFormat(c *gin.Context, format restapi.OutputFormat, params restapi.PostApiDefineFormatParams) {
-	ctx := c.Request.Context()
+func toMeshDefinition(graph apis.ServiceGraph) restapi.MeshDefinition {
+	out := restapi.MeshDefinition{}
+	if graph.Defaults != nil {
+		defaults := *graph.Defaults
+		out.Defaults = &restapi.MeshDefaults{
+			TimeoutMs:            &defaults.TimeoutMs,
+			Retries:              &defaults.Retries,
+			CircuitBreakerErrors: &defaults.CircuitBreakerErrors,
+		}
+	}
+	for _, srv := range graph.Services {
+		entry := restapi.ServiceEntry{Replicas: srv.Replicas, Edges: []restapi.EdgeRef{}}
+		if srv.Name != "" {
+			name := srv.Name
+			entry.Name = &name
+		}
+		if srv.Role != "" {
+			role := restapi.ServiceRole(srv.Role)
+			entry.Role = &role
+		}
+		if len(srv.Labels) > 0 {
+			labels := srv.Labels
+			entry.Labels = &labels
+		}
+		if srv.Tier != "" {
+			tier := srv.Tier
+			entry.Tier = &tier
+		}
+		for _, e := range srv.Edges {
+			entry.Edges = append(entry.Edges, toEdgeRef(e))
+		}
+		out.Services = append(out.Services, entry)
+	}
+	return out
+}
+
+func toEdgeRef(e apis.Edge) restapi.EdgeRef {
+	ref := restapi.EdgeRef{}
+	if e == (apis.Edge{Target: e.Target}) {
+		_ = ref.FromEdgeRef0(e.Target)
+		return ref
+	}
+	entry := restapi.EdgeEntry{Target: e.Target}
+	if e.Protocol != "" {
+		protocol := restapi.EdgeEntryProtocol(e.Protocol)
+		entry.Protocol = &protocol
+	}
+	if e.Weight != 0 {
+		entry.Weight = &e.Weight
+	}
+	if e.LatencyMs != 0 {
+		entry.LatencyMs = &e.LatencyMs
+	}
+	if e.ErrorRate != 0 {
+		errorRate := float32(e.ErrorRate)
+		entry.ErrorRate = &errorRate
+	}
+	if e.TimeoutMs != 0 {
+		entry.TimeoutMs = &e.TimeoutMs
+	}
+	if e.Retries != 0 {
+		entry.Retries = &e.Retries
+	}
+	_ = ref.FromEdgeEntry(entry)
+	return ref
+}
+
+func fromEdgeRef(ref restapi.EdgeRef) (apis.Edge, error) {
+	if target, err := ref.AsEdgeRef0(); err == nil {
+		return apis.Edge{Target: target}, nil
+	}
+	entry, err := ref.AsEdgeEntry()
+	if err != nil {
+		return apis.Edge{}, err
+	}
+	out := apis.Edge{Target: entry.Target}
+	if entry.Protocol != nil {
+		out.Protocol = string(*entry.Protocol)
+	}
+	if entry.Weight != nil {
+		out.Weight = *entry.Weight
+	}
+	if entry.LatencyMs != nil {
+		out.LatencyMs = *entry.LatencyMs
+	}
+	if entry.ErrorRate != nil {
+		out.ErrorRate = float64(*entry.ErrorRate)
+	}
+	if entry.TimeoutMs != nil {
+		out.TimeoutMs = *entry.TimeoutMs
+	}
+	if entry.Retries != nil {
+		out.Retries = *entry.Retries
+	}
+	return out, nil
+}
+
+// bindMeshDefinition parses the MeshDefinition in the body of the request into a ServiceGraph.
+func bindMeshDefinition(c *gin.Context) (apis.ServiceGraph, []restapi.InvalidParameter) {
 	if c.Request.ContentLength > (1 << 20) {
-		c.PureJSON(http.StatusBadRequest, restapi.ErrorResponse{
-			Status:  http.StatusBadRequest,
-			Details: "Bad Request",
-			InvalidParameters: &[]restapi.InvalidParameter{
-				{
-					Field:  "payload",
-					Reason: "Max payload size is 1MiB",
-				},
+		return apis.ServiceGraph{}, []restapi.InvalidParameter{
+			{
+				Field:  "payload",
+				Reason: "Max payload size is 1MiB",
 			},
-		})
-		return
+		}
+	}
+
+	switch c.ContentType() {
+	case "text/vnd.graphviz":
+		return bindDiagram(c, apis.ParseDot)
+	case "text/vnd.mermaid":
+		return bindDiagram(c, apis.ParseMermaid)
 	}
 
 	var invParams []restapi.InvalidParameter
-	inputGraph := restapi.PostApiDefineFormatJSONRequestBody{}
+	inputGraph := restapi.MeshDefinition{}
 	if err := c.BindJSON(&inputGraph); err != nil {
 		invParams = append(invParams, restapi.InvalidParameter{
 			Field:  "payload",
@@ -69,6 +180,18 @@ func (s *srv) PostApiDefineFormat(c *gin.Context, format restapi.OutputFormat, p
 	graph := apis.ServiceGraph{
 		GenerationParams: "provided by api",
 	}
+	if inputGraph.Defaults != nil {
+		graph.Defaults = &apis.Defaults{}
+		if inputGraph.Defaults.TimeoutMs != nil {
+			graph.Defaults.TimeoutMs = *inputGraph.Defaults.TimeoutMs
+		}
+		if inputGraph.Defaults.Retries != nil {
+			graph.Defaults.Retries = *inputGraph.Defaults.Retries
+		}
+		if inputGraph.Defaults.CircuitBreakerErrors != nil {
+			graph.Defaults.CircuitBreakerErrors = *inputGraph.Defaults.CircuitBreakerErrors
+		}
+	}
 	if len(inputGraph.Services) == 0 || len(inputGraph.Services) > 5000 {
 		invParams = append(invParams, restapi.InvalidParameter{
 			Field:  "payload.services",
@@ -82,24 +205,85 @@ func (s *srv) PostApiDefineFormat(c *gin.Context, format restapi.OutputFormat, p
 					Reason: fmt.Sprintf("can't have more than 50 edges"),
 				})
 			} else {
-				for j, edge := range srv.Edges {
-					if edge > len(inputGraph.Services) || edge < 0 {
+				var edges []apis.Edge
+				for j, ref := range srv.Edges {
+					edge, err := fromEdgeRef(ref)
+					if err != nil {
+						invParams = append(invParams, restapi.InvalidParameter{
+							Field:  fmt.Sprintf("payload.services[%d].edges[%d]", i, j),
+							Reason: "must be an integer or an edge entry: " + err.Error(),
+						})
+						continue
+					}
+					if edge.Target >= len(inputGraph.Services) || edge.Target < 0 {
 						invParams = append(invParams, restapi.InvalidParameter{
 							Field:  fmt.Sprintf("payload.services[%d].edges[%d]", i, j),
-							Reason: fmt.Sprintf("the destination of the call is not an existing entity, max index %d", len(inputGraph.Services)),
+							Reason: fmt.Sprintf("the destination of the call is not an existing entity, max index %d", len(inputGraph.Services)-1),
 						})
 					}
+					edges = append(edges, edge)
 				}
-				graph.Services = append(graph.Services, apis.Service{
+				service := apis.Service{
 					Idx:      i,
 					Replicas: srv.Replicas,
-					Edges:    srv.Edges,
-				})
+					Edges:    edges,
+				}
+				if srv.Name != nil {
+					service.Name = *srv.Name
+				}
+				if srv.Role != nil {
+					service.Role = string(*srv.Role)
+				}
+				if srv.Labels != nil {
+					service.Labels = *srv.Labels
+				}
+				if srv.Tier != nil {
+					service.Tier = *srv.Tier
+				}
+				graph.Services = append(graph.Services, service)
 			}
 		}
 	}
+	return graph, invParams
+}
 
-	config, contentType, invConfParams := s.extractConfig(format, params.K8s, params.K8sApp, params.K8sNamespace, nil)
+// bindDiagram parses a DOT or Mermaid graph in the body of the request into a ServiceGraph.
+func bindDiagram(c *gin.Context, parse func(b []byte) (apis.ServiceGraph, error)) (apis.ServiceGraph, []restapi.InvalidParameter) {
+	// Read one more byte than allowed to reject bodies without a content length (chunked) which are too big.
+	b, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20+1))
+	if err != nil {
+		return apis.ServiceGraph{}, []restapi.InvalidParameter{{Field: "payload", Reason: "failed to read payload: " + err.Error()}}
+	}
+	if len(b) > 1<<20 {
+		return apis.ServiceGraph{}, []restapi.InvalidParameter{{Field: "payload", Reason: "Max payload size is 1MiB"}}
+	}
+	graph, err := parse(b)
+	if err != nil {
+		return apis.ServiceGraph{}, []restapi.InvalidParameter{{Field: "payload", Reason: "failed to parse payload: " + err.Error()}}
+	}
+	var invParams []restapi.InvalidParameter
+	if len(graph.Services) > 5000 {
+		invParams = append(invParams, restapi.InvalidParameter{
+			Field:  "payload.services",
+			Reason: "can't have 0 or more than 5000 services",
+		})
+	}
+	for i, srv := range graph.Services {
+		if len(srv.Edges) > 50 {
+			invParams = append(invParams, restapi.InvalidParameter{
+				Field:  fmt.Sprintf("payload.services[%d].edges", i),
+				Reason: "can't have more than 50 edges",
+			})
+		}
+	}
+	graph.GenerationParams = "provided by api"
+	return graph, invParams
+}
+
+func (s *srv) PostApiDefineFormat(c *gin.Context, format restapi.OutputFormat, params restapi.PostApiDefineFormatParams) {
+	ctx := c.Request.Context()
+	graph, invParams := bindMeshDefinition(c)
+	config, contentType, invConfParams := s.extractConfig(format, params.K8s, params.Kuma, params.Istio, params.Linkerd, params.NetworkPolicies, params.K8sApp, params.K8sNamespace, nil)
 	invParams = append(invParams, invConfParams...)
 
 	if len(invParams) > 0 {
@@ -117,7 +301,14 @@ func (s *srv) PostApiDefineFormat(c *gin.Context, format restapi.OutputFormat, p
 		return graph, nil
 	})
 	if err != nil {
-		if errors.Is(err, &generate.InvalidConfError{}) {
+		if errors.Is(err, render.ErrTooLarge) {
+			c.PureJSON(http.StatusBadRequest, restapi.ErrorResponse{
+				Status:            http.StatusBadRequest,
+				Details:           "Bad Request",
+				InvalidParameters: &[]restapi.InvalidParameter{{Field: "payload", Reason: err.Error()}},
+			})
+			return
+		} else if errors.Is(err, &generate.InvalidConfError{}) {
 			c.PureJSON(http.StatusBadRequest, restapi.ErrorResponse{
 				Status:  http.StatusBadRequest,
 				Details: err.Error(),
@@ -136,7 +327,59 @@ func (s *srv) PostApiDefineFormat(c *gin.Context, format restapi.OutputFormat, p
 
 }
 
-func (s *srv) extractConfig(format restapi.OutputFormat, k8s *bool, k8sApp *restapi.K8sAppType, k8sNamespace *string, seed *int) (generate.Config, string, []restapi.InvalidParameter) {
+func (s *srv) PostApiStats(c *gin.Context) {
+	graph, invParams := bindMeshDefinition(c)
+	if len(invParams) > 0 {
+		c.PureJSON(http.StatusBadRequest, restapi.ErrorResponse{
+			Status:            http.StatusBadRequest,
+			Details:           "Bad Request",
+			InvalidParameters: &invParams,
+		})
+		return
+	}
+	report, err := stats.Compute(graph)
+	if errors.Is(err, stats.ErrTooLarge) {
+		c.PureJSON(http.StatusBadRequest, restapi.ErrorResponse{
+			Status:            http.StatusBadRequest,
+			Details:           "Bad Request",
+			InvalidParameters: &[]restapi.InvalidParameter{{Field: "payload", Reason: err.Error()}},
+		})
+		return
+	}
+	if err != nil {
+		// The graph was parsed so it can only be invalid.
+		c.PureJSON(http.StatusBadRequest, restapi.ErrorResponse{
+			Status:  http.StatusBadRequest,
+			Details: "invalid mesh: " + err.Error(),
+		})
+		return
+	}
+	res := restapi.StatsResponse{
+		Services:     report.Services,
+		Edges:        report.Edges,
+		MaxFanIn:     report.MaxFanIn,
+		MaxFanOut:    report.MaxFanOut,
+		AvgFanIn:     float32(report.AvgFanIn),
+		AvgFanOut:    float32(report.AvgFanOut),
+		LongestChain: report.LongestChain,
+		Entries:      report.Entries,
+		Leaves:       report.Leaves,
+		Components:   report.Components,
+		PerService:   []restapi.ServiceStats{},
+	}
+	for _, svc := range report.PerService {
+		res.PerService = append(res.PerService, restapi.ServiceStats{
+			Service:     svc.Service,
+			FanIn:       svc.FanIn,
+			FanOut:      svc.FanOut,
+			Depth:       svc.Depth,
+			Betweenness: float32(svc.Betweenness),
+		})
+	}
+	c.PureJSON(http.StatusOK, res)
+}
+
+func (s *srv) extractConfig(format restapi.OutputFormat, k8s *bool, kuma *bool, istio *bool, linkerd *bool, networkPolicies *bool, k8sApp *restapi.K8sAppType, k8sNamespace *string, seed *int) (generate.Config, string, []restapi.InvalidParameter) {
 	s.l.Info("foo", "format", format)
 	var invParams []restapi.InvalidParameter
 	config := generate.DefaultConfig()
@@ -146,6 +389,18 @@ func (s *srv) extractConfig(format restapi.OutputFormat, k8s *bool, k8sApp *rest
 	if k8sNamespace != nil {
 		config.K8sNamespace = *k8sNamespace
 	}
+	if kuma != nil {
+		config.Kuma = *kuma
+	}
+	if istio != nil {
+		config.Istio = *istio
+	}
+	if linkerd != nil {
+		config.Linkerd = *linkerd
+	}
+	if networkPolicies != nil {
+		config.NetworkPolicies = *networkPolicies
+	}
 	contentType := ""
 	switch format {
 	case restapi.Empty, restapi.Yaml:
@@ -164,6 +419,15 @@ func (s *srv) extractConfig(format restapi.OutputFormat, k8s *bool, k8sApp *rest
 	case restapi.Json:
 		contentType = "application/json"
 		config.Output = "json"
+	case restapi.Tgz:
+		contentType = "application/gzip"
+		config.Output = "helm"
+	case restapi.Svg:
+		contentType = "image/svg+xml"
+		config.Output = "svg"
+	case restapi.Png:
+		contentType = "image/png"
+		config.Output = "png"
 	default:
 		invParams = append(invParams, restapi.InvalidParameter{
 			Field:  "format",
@@ -179,7 +443,7 @@ func (s *srv) extractConfig(format restapi.OutputFormat, k8s *bool, k8sApp *rest
 func (s *srv) GenerateRandom(c *gin.Context, format restapi.OutputFormat, params restapi.GenerateRandomParams) {
 	var invParams []restapi.InvalidParameter
 	ctx := c.Request.Context()
-	config, contentType, invConfParams := s.extractConfig(format, params.K8s, params.K8sApp, params.K8sNamespace, params.Seed)
+	config, contentType, invConfParams := s.extractConfig(format, params.K8s, params.Kuma, params.Istio, params.Linkerd, params.NetworkPolicies, params.K8sApp, params.K8sNamespace, params.Seed)
 	invParams = append(invParams, invConfParams...)
 	numServices := 5
 	if params.NumServices != nil {
@@ -221,6 +485,94 @@ func (s *srv) GenerateRandom(c *gin.Context, format restapi.OutputFormat, params
 			Reason: "can't be lower than minReplicas",
 		})
 	}
+	topology := restapi.Random
+	if params.Topology != nil {
+		topology = *params.Topology
+	}
+	attachment := 2
+	if params.Attachment != nil {
+		attachment = *params.Attachment
+	}
+	if attachment <= 0 {
+		invParams = append(invParams, restapi.InvalidParameter{
+			Field:  "attachment",
+			Reason: "must > 0",
+		})
+	}
+	hubBias := 80
+	if params.HubBias != nil {
+		hubBias = *params.HubBias
+	}
+	if hubBias < 0 || hubBias > 100 {
+		invParams = append(invParams, restapi.InvalidParameter{
+			Field:  "hubBias",
+			Reason: "must be between 0 and 100",
+		})
+	}
+	layers := []int{1, 3, 5, 4}
+	if params.Layers != nil {
+		layers = *params.Layers
+	}
+	total := 0
+	for _, l := range layers {
+		total += l
+	}
+	if len(layers) == 0 || total > 5000 {
+		invParams = append(invParams, restapi.InvalidParameter{
+			Field:  "layers",
+			Reason: "can't have 0 or more than 5000 services",
+		})
+	}
+	for i, l := range layers {
+		if l <= 0 {
+			invParams = append(invParams, restapi.InvalidParameter{
+				Field:  fmt.Sprintf("layers[%d]", i),
+				Reason: "must > 0",
+			})
+		}
+	}
+	var layerPercentEdges []int
+	if params.LayerPercentEdges != nil {
+		layerPercentEdges = *params.LayerPercentEdges
+	} else {
+		for i := 1; i < len(layers); i++ {
+			layerPercentEdges = append(layerPercentEdges, 50)
+		}
+	}
+	if len(layers) > 0 && len(layerPercentEdges) != len(layers)-1 {
+		invParams = append(invParams, restapi.InvalidParameter{
+			Field:  "layerPercentEdges",
+			Reason: "must have one value per pair of consecutive layers",
+		})
+	}
+	for i, p := range layerPercentEdges {
+		if p < 0 || p > 100 {
+			invParams = append(invParams, restapi.InvalidParameter{
+				Field:  fmt.Sprintf("layerPercentEdges[%d]", i),
+				Reason: "must be between 0 and 100",
+			})
+		}
+	}
+	var genFn func(seed int64) (apis.ServiceGraph, error)
+	switch topology {
+	case restapi.Random:
+		genFn = func(seed int64) (apis.ServiceGraph, error) {
+			return apis.GenerateRandomMesh(seed, numServices, percentEdge, minReplicas, maxReplicas), nil
+		}
+	case restapi.Scalefree:
+		genFn = func(seed int64) (apis.ServiceGraph, error) {
+			return apis.GenerateScaleFreeMesh(seed, numServices, attachment, hubBias, minReplicas, maxReplicas), nil
+		}
+	case restapi.Tiered:
+		genFn = func(seed int64) (apis.ServiceGraph, error) {
+			return apis.GenerateTieredMesh(seed, layers, layerPercentEdges, minReplicas, maxReplicas)
+		}
+	default:
+		invParams = append(invParams, restapi.InvalidParameter{
+			Field:  "topology",
+			Reason: "not a supported topology",
+		})
+	}
 	if len(invParams) > 0 {
 		c.PureJSON(http.StatusBadRequest, restapi.ErrorResponse{
 			Status:            http.StatusBadRequest,
@@ -232,12 +584,16 @@ func (s *srv) GenerateRandom(c *gin.Context, format restapi.OutputFormat, params
 
 	buf := bytes.Buffer{}
 	config.Writer = &buf
-	err := generate.Run(config, func(seed int64) (apis.ServiceGraph, error) {
-		graph := apis.GenerateRandomMesh(seed, numServices, percentEdge, minReplicas, maxReplicas)
-		return graph, nil
-	})
+	err := generate.Run(config, genFn)
 	if err != nil {
-		if errors.Is(err, &generate.InvalidConfError{}) {
+		if errors.Is(err, render.ErrTooLarge) {
+			c.PureJSON(http.StatusBadRequest, restapi.ErrorResponse{
+				Status:            http.StatusBadRequest,
+				Details:           "Bad Request",
+				InvalidParameters: &[]restapi.InvalidParameter{{Field: "format", Reason: err.Error()}},
+			})
+			return
+		} else if errors.Is(err, &generate.InvalidConfError{}) {
 			c.PureJSON(http.StatusBadRequest, restapi.ErrorResponse{
 				Status:  http.StatusBadRequest,
 				Details: err.Error(),
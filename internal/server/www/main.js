@@ -12,7 +12,14 @@
         "minReplicas": 2,
         "maxReplicas": 2,
         "percentEdge": 50,
+        "topology": "random",
+        "attachment": 2,
+        "hubBias": 80,
         "yaml": null,
+        "kuma": null,
+        "istio": null,
+        "linkerd": null,
+        "networkPolicies": null,
         "k8sNamespace": "microservice-mesh",
         "k8sApp": "api-play",
         "defineContent": JSON.stringify({services: [{"replicas": 2, "edges": [1]}, {"replicas": 2}]})
@@ -110,7 +117,7 @@
                         } else {
                             elt.value = url.searchParams.has(key) ? url.searchParams.get(key) : formParamsWithDefaults[key]
                         }
-                        if (elt.value !== '') {
+                        if (elt.type === "checkbox" ? elt.checked : elt.value !== '') {
                             apiURL.searchParams.set(key, elt.value);
                         }
                     }
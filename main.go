@@ -3,25 +3,83 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"github.com/lahabana/microservice-mesh-generator/internal/generate"
 	"github.com/lahabana/microservice-mesh-generator/internal/server"
 	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/catalog"
+	"github.com/lahabana/microservice-mesh-generator/pkg/diff"
+	"github.com/lahabana/microservice-mesh-generator/pkg/evolve"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers/jaeger"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers/manifests"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers/otel"
+	"github.com/lahabana/microservice-mesh-generator/pkg/runner"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 )
 
 //go:generate go run github.com/deepmap/oapi-codegen/v2/cmd/oapi-codegen@v2.0.0 -config openapi.cfg.yaml openapi.yaml
 
 func main() {
 	config := generate.DefaultConfig()
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "diff" {
+		if err := diffCommand(args[1:]); err != nil {
+			panic(any(err))
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "stats" {
+		// `stats` is a shorthand for `-output stats`
+		config.Output = "stats"
+		args = args[1:]
+	}
 	numServices := flag.Int("numServices", 5, "The number of services to use")
 	minReplicas := flag.Int("minReplicas", 2, "The minimum number of replicas to use (will pick a number between min and max)")
 	maxReplicas := flag.Int("maxReplicas", 2, "The max number of replicas to use (will pick a number between min and max)")
 	percentEdge := flag.Int("percentEdge", 50, "The for an edge between 2 nodes to exist (100 == sure)")
+	topology := flag.String("topology", "random", "The topology to generate (random,scalefree,tiered)")
+	attachment := flag.Int("attachment", 2, "The number of services each service calls (only useful if topology is `scalefree`)")
+	hubBias := flag.Int("hubBias", 80, "The percentage of calls which favor already called services (only useful if topology is `scalefree`)")
+	layers := flag.String("layers", "1,3,5,4", "The comma separated number of services in each layer (only useful if topology is `tiered`)")
+	layerPercentEdges := flag.String("layerPercentEdges", "", "The comma separated chance for an edge between 2 consecutive layers to exist, 50 for each pair if empty (only useful if topology is `tiered`)")
 	flag.Int64Var(&config.Seed, "seed", config.Seed, "the seed for the random generate (set to now by default)")
-	flag.StringVar(&config.K8sNamespace, "k8sNamespace", config.K8sNamespace, "The namespace to use (only useful if output is `k8s`)")
-	flag.StringVar(&config.K8sApp, "k8sApp", config.K8sApp, "The app to use can be api-play or fake-service (only useful if output is `k8s`)")
-	flag.StringVar(&config.Output, "output", config.Output, "output format (k8s,dot,mermaid,yaml,json)")
+	flag.StringVar(&config.K8sNamespace, "k8sNamespace", config.K8sNamespace, "The namespace to use (only useful if output is `k8s`, `helm`, `kustomize`, `compose` or `nomad`)")
+	flag.StringVar(&config.K8sApp, "k8sApp", config.K8sApp, "The app to use can be api-play or fake-service (only useful if output is `k8s`, `helm`, `kustomize`, `compose` or `nomad`)")
+	flag.BoolVar(&config.Kuma, "kuma", config.Kuma, "Add Kuma sidecar injection and policies (only useful if output is `k8s`, `helm` or `kustomize`)")
+	flag.BoolVar(&config.Istio, "istio", config.Istio, "Add Istio sidecar injection and resources (only useful if output is `k8s`, `helm` or `kustomize`)")
+	flag.BoolVar(&config.Linkerd, "linkerd", config.Linkerd, "Add Linkerd proxy injection and policies (only useful if output is `k8s`, `helm` or `kustomize`)")
+	flag.BoolVar(&config.NetworkPolicies, "networkPolicies", config.NetworkPolicies, "Add NetworkPolicies which only allow the calls of the mesh (only useful if output is `k8s`, `helm` or `kustomize`)")
+	flag.StringVar(&config.Output, "output", config.Output, "output format (k8s,helm,kustomize,compose,nomad,nomad-json,simulation,simulation-json,stats,stats-json,dot,svg,png,mermaid,yaml,json)")
+	flag.StringVar(&config.OutputDir, "outputDir", config.OutputDir, "The directory in which to write outputs with multiple files (only useful if output is `helm` or `kustomize`, they are written as a .tgz to stdout if empty)")
+	flag.IntVar(&config.Simulation.Requests, "requests", config.Simulation.Requests, "The number of requests to simulate on each entry service (only useful if output is `simulation`)")
+	flag.BoolVar(&config.Simulation.Parallel, "parallel", config.Simulation.Parallel, "Whether services call their edges in parallel instead of one after the other (only useful if output is `simulation`)")
+	flag.Float64Var(&config.Simulation.LatencySigma, "latencySigma", config.Simulation.LatencySigma, "The sigma of the log-normal distribution of the latency of edges, 0 for constant latencies (only useful if output is `simulation`)")
+	flag.IntVar(&config.Evolution.Steps, "evolve", config.Evolution.Steps, "The number of seeded mutations to apply to the mesh, each step is written in `outputDir` as `step-<n>.<ext>`, required unless the output supports comments (replicas of added or rescaled services are between minReplicas and maxReplicas)")
+	flag.BoolVar(&config.DotRich, "dotRich", config.DotRich, "Label nodes with their name, replicas and role and edges with their protocol, weight and latency, color nodes by tier or role and rank them by depth (only useful if output is `dot`)")
+	flag.StringVar(&config.DotCluster, "dotCluster", config.DotCluster, "Group services in clusters by the value of this label (e.g. `zone`) or by `tier` (only useful if output is `dot`)")
+	evolveMutations := flag.String("evolveMutations", "", fmt.Sprintf("The comma separated mutations to pick from, all if empty (%s, only useful with `-evolve`)", strings.Join(evolve.AllMutations, ",")))
+	preset := flag.String("preset", "", fmt.Sprintf("Use a well-known mesh instead of generating one (%s)", strings.Join(catalog.Names(), ",")))
+	input := flag.String("input", "", "Read the mesh definition in yaml or json from a file (or stdin with `-`) instead of generating one")
+	importConf := importers.DefaultConfig()
+	inputFormat := flag.String("inputFormat", "mesh", fmt.Sprintf("The format of the input (%s)", strings.Join(inputFormats, ",")))
+	importFlags(flag.CommandLine, &importConf)
 	asServer := flag.Bool("server", false, "whether to run this tool as a hosted server")
-	flag.Parse()
+	asRun := flag.Bool("run", false, "whether to run all the services of the mesh as local HTTP servers until interrupted")
+	runPort := flag.Int("runPort", 0, "The port of the first service, service `idx` uses `runPort + idx` (random ports if 0, only useful with `-run`)")
+	_ = flag.CommandLine.Parse(args)
+	config.Evolution.MinReplicas, config.Evolution.MaxReplicas = *minReplicas, *maxReplicas
+	for _, m := range strings.Split(*evolveMutations, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			config.Evolution.Mutations = append(config.Evolution.Mutations, m)
+		}
+	}
 
 	if *asServer {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -32,11 +90,157 @@ func main() {
 		}
 		return
 	}
-	err := generate.Run(config, func(seed int64) (apis.ServiceGraph, error) {
-		mesh := apis.GenerateRandomMesh(seed, *numServices, *percentEdge, *minReplicas, *maxReplicas)
-		return mesh, nil
-	})
+	genFn := func(seed int64) (apis.ServiceGraph, error) {
+		if *input != "" {
+			return readServiceGraph(*input, *inputFormat, importConf)
+		}
+		if *preset != "" {
+			entry, err := catalog.Get(*preset)
+			if err != nil {
+				return apis.ServiceGraph{}, err
+			}
+			return entry.Graph(), nil
+		}
+		switch *topology {
+		case "random":
+			return apis.GenerateRandomMesh(seed, *numServices, *percentEdge, *minReplicas, *maxReplicas), nil
+		case "scalefree":
+			return apis.GenerateScaleFreeMesh(seed, *numServices, *attachment, *hubBias, *minReplicas, *maxReplicas), nil
+		case "tiered":
+			layerSizes, err := parseInts(*layers)
+			if err != nil {
+				return apis.ServiceGraph{}, fmt.Errorf("invalid layers: %w", err)
+			}
+			percentEdges, err := parseInts(*layerPercentEdges)
+			if err != nil {
+				return apis.ServiceGraph{}, fmt.Errorf("invalid layerPercentEdges: %w", err)
+			}
+			if len(percentEdges) == 0 {
+				for i := 1; i < len(layerSizes); i++ {
+					percentEdges = append(percentEdges, 50)
+				}
+			}
+			return apis.GenerateTieredMesh(seed, layerSizes, percentEdges, *minReplicas, *maxReplicas)
+		default:
+			return apis.ServiceGraph{}, fmt.Errorf("topology '%s' not supported accepted: random, scalefree, tiered", *topology)
+		}
+	}
+	if *asRun {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		if err := runMesh(ctx, config.Seed, *runPort, genFn); err != nil {
+			panic(any(err))
+		}
+		return
+	}
+	err := generate.Run(config, genFn)
 	if err != nil {
 		panic(any(err))
 	}
 }
+
+func runMesh(ctx context.Context, seed int64, port int, genFn func(seed int64) (apis.ServiceGraph, error)) error {
+	graph, err := genFn(seed)
+	if err != nil {
+		return err
+	}
+	conf := runner.DefaultConfig()
+	conf.Seed = seed
+	conf.BasePort = port
+	conf.Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	mesh, err := runner.Start(ctx, graph, conf)
+	if err != nil {
+		return err
+	}
+	return mesh.Wait()
+}
+
+// diffCommand prints what changed between 2 mesh definitions: `diff [-format text] <old> <new>`.
+func diffCommand(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	importConf := importers.DefaultConfig()
+	inputFormat := flags.String("inputFormat", "mesh", fmt.Sprintf("The format of the mesh definitions (%s)", strings.Join(inputFormats, ",")))
+	importFlags(flags, &importConf)
+	format := flags.String("format", diff.FormatText, fmt.Sprintf("The format of the diff (%s,%s,%s)", diff.FormatText, diff.FormatJSONPatch, diff.FormatMermaid))
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s diff [flags] <old mesh definition> <new mesh definition>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected 2 mesh definitions got %d", flags.NArg())
+	}
+	from, err := readServiceGraph(flags.Arg(0), *inputFormat, importConf)
+	if err != nil {
+		return err
+	}
+	to, err := readServiceGraph(flags.Arg(1), *inputFormat, importConf)
+	if err != nil {
+		return err
+	}
+	return diff.Write(os.Stdout, *format, from, to)
+}
+
+func parseInts(s string) ([]int, error) {
+	var out []int
+	for _, v := range strings.Split(s, ",") {
+		if v == "" {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+var inputFormats = []string{"mesh", "dot", "mermaid", "jaeger", "otel", "k8s"}
+
+// importFlags adds the flags to configure the import of graphs from observed calls.
+func importFlags(flags *flag.FlagSet, conf *importers.Config) {
+	flags.BoolVar(&conf.Anonymize, "anonymize", conf.Anonymize, "Replace the names of the imported services with `svc-<idx>` (only useful if inputFormat is not `mesh`)")
+	flags.IntVar(&conf.Replicas, "importReplicas", conf.Replicas, "The number of replicas of the imported services (only useful if inputFormat is not `mesh`)")
+	flags.IntVar(&conf.MaxWeight, "importMaxWeight", conf.MaxWeight, "The maximum weight of an imported edge (only useful if inputFormat is not `mesh`)")
+}
+
+func readServiceGraph(path string, format string, importConf importers.Config) (apis.ServiceGraph, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return apis.ServiceGraph{}, err
+	}
+	var graph apis.ServiceGraph
+	switch format {
+	case "mesh":
+		graph, err = apis.Parse(b)
+	case "dot":
+		graph, err = apis.ParseDot(b)
+	case "mermaid":
+		graph, err = apis.ParseMermaid(b)
+	case "jaeger":
+		graph, err = jaeger.Import(b, importConf)
+	case "otel":
+		var res otel.Result
+		res, err = otel.Import(b, importConf)
+		graph = res.Graph
+	case "k8s":
+		graph, err = manifests.Import(b)
+	default:
+		return apis.ServiceGraph{}, fmt.Errorf("inputFormat '%s' not supported accepted: %s", format, strings.Join(inputFormats, ", "))
+	}
+	if err != nil {
+		return graph, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+	if graph.GenerationParams == "" {
+		graph.GenerationParams = fmt.Sprintf("name:input,path:%s", path)
+	}
+	return graph, nil
+}
@@ -0,0 +1,706 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// SanitizeName turns a name into a DNS-1123 label (empty if nothing is left).
+func SanitizeName(name string) string {
+	name = invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.Trim(name, "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
+
+// diagramNode a node of a diagram with what its label and attributes tell about the service.
+type diagramNode struct {
+	id       string
+	name     string
+	replicas int
+	role     string
+	tier     string
+}
+
+type diagramEdge struct {
+	from, to string
+	edge     Edge
+}
+
+// diagram the nodes and edges of a DOT or Mermaid graph in the order they were declared.
+type diagram struct {
+	nodes map[string]*diagramNode
+	order []string
+	edges []diagramEdge
+}
+
+func newDiagram() *diagram {
+	return &diagram{nodes: map[string]*diagramNode{}}
+}
+
+func (d *diagram) node(id string) *diagramNode {
+	n, exists := d.nodes[id]
+	if !exists {
+		n = &diagramNode{id: id}
+		d.nodes[id] = n
+		d.order = append(d.order, id)
+	}
+	return n
+}
+
+func (d *diagram) edge(from, to string, e Edge) {
+	d.node(from)
+	d.node(to)
+	d.edges = append(d.edges, diagramEdge{from: from, to: to, edge: e})
+}
+
+var (
+	nodeLabelAttr = regexp.MustCompile(`^(replicas|role|tier)[:=](.+)$`)
+	labelBreaks   = regexp.MustCompile(`(?i)\\n|<br\s*/?>`)
+)
+
+// setLabel reads a node label: `replicas:N`, `role:X` and `tier:X` words set the attributes of the service and the rest is its name.
+func (n *diagramNode) setLabel(label string) error {
+	var name []string
+	for _, field := range strings.Fields(labelBreaks.ReplaceAllString(label, " ")) {
+		m := nodeLabelAttr.FindStringSubmatch(field)
+		if m == nil {
+			name = append(name, field)
+			continue
+		}
+		if err := n.setAttr(m[1], m[2]); err != nil {
+			return err
+		}
+	}
+	n.name = strings.Join(name, " ")
+	return nil
+}
+
+func (n *diagramNode) setAttr(key, value string) error {
+	switch key {
+	case "replicas":
+		replicas, err := strconv.Atoi(value)
+		if err != nil || replicas <= 0 {
+			return fmt.Errorf("invalid replicas '%s' for node '%s'", value, n.id)
+		}
+		n.replicas = replicas
+	case "role":
+		n.role = value
+	case "tier":
+		n.tier = value
+	}
+	return nil
+}
+
+var edgeLabelAttrs = []struct {
+	re  *regexp.Regexp
+	set func(e *Edge, v string) error
+}{
+	{regexp.MustCompile(`^(?:protocol[:=])?(http|grpc)$`), func(e *Edge, v string) error {
+		if v == ProtocolGRPC {
+			e.Protocol = v
+		}
+		return nil
+	}},
+	{regexp.MustCompile(`^(?:x|weight[:=])(\d+)$`), func(e *Edge, v string) (err error) {
+		e.Weight, err = strconv.Atoi(v)
+		return err
+	}},
+	{regexp.MustCompile(`^(?:latency(?:Ms)?[:=])?(\d+)(?:ms)?$`), func(e *Edge, v string) (err error) {
+		e.LatencyMs, err = strconv.Atoi(v)
+		return err
+	}},
+	{regexp.MustCompile(`^(?:errors?(?:Rate)?[:=])?(\d+(?:\.\d+)?)%$`), func(e *Edge, v string) error {
+		rate, err := strconv.ParseFloat(v, 64)
+		e.ErrorRate = rate / 100
+		return err
+	}},
+	{regexp.MustCompile(`^timeout(?:Ms)?[:=](\d+)(?:ms)?$`), func(e *Edge, v string) (err error) {
+		e.TimeoutMs, err = strconv.Atoi(v)
+		return err
+	}},
+	{regexp.MustCompile(`^retries[:=](\d+)$`), func(e *Edge, v string) (err error) {
+		e.Retries, err = strconv.Atoi(v)
+		return err
+	}},
+}
+
+// parseEdgeLabel reads an edge label like `grpc x3 10ms 1%`, words which aren't attributes of the call are ignored.
+func parseEdgeLabel(label string) (Edge, error) {
+	out := Edge{}
+	for _, field := range strings.Fields(labelBreaks.ReplaceAllString(label, " ")) {
+		field = strings.Trim(field, ",;")
+		for _, attr := range edgeLabelAttrs {
+			if m := attr.re.FindStringSubmatch(field); m != nil {
+				if err := attr.set(&out, m[1]); err != nil {
+					return out, fmt.Errorf("invalid edge label '%s': %w", label, err)
+				}
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// graph turns the diagram into a ServiceGraph.
+// When all node ids are integers (like in the output of DotGenerator and MermaidGenerator) they are used as the idx of the services,
+// otherwise services are ordered by first appearance.
+// Names are taken from labels or ids and are turned into DNS-1123 labels, repeated edges are merged into a single edge with a weight.
+func (d *diagram) graph(params string) (ServiceGraph, error) {
+	if len(d.order) == 0 {
+		return ServiceGraph{}, errors.New("no nodes found")
+	}
+	idx := map[string]int{}
+	numeric := true
+	for _, id := range d.order {
+		i, err := strconv.Atoi(id)
+		if err != nil || i < 0 || i > 5000 {
+			numeric = false
+			break
+		}
+		idx[id] = i
+	}
+	count := 0
+	if numeric {
+		for _, i := range idx {
+			count = max(count, i+1)
+		}
+	} else {
+		for i, id := range d.order {
+			idx[id] = i
+		}
+		count = len(d.order)
+	}
+	out := ServiceGraph{GenerationParams: params}
+	for i := 0; i < count; i++ {
+		out.Services = append(out.Services, Service{Idx: i, Replicas: 1})
+	}
+	for _, id := range d.order {
+		n := d.nodes[id]
+		srv := &out.Services[idx[id]]
+		name := n.name
+		if name == "" {
+			name = id
+		}
+		// Unnamed services are displayed with their idx.
+		if name != strconv.Itoa(srv.Idx) {
+			srv.Name = SanitizeName(name)
+		}
+		if n.replicas > 0 {
+			srv.Replicas = n.replicas
+		}
+		srv.Role = n.role
+		srv.Tier = n.tier
+	}
+	for _, e := range d.edges {
+		srv := &out.Services[idx[e.from]]
+		e.edge.Target = idx[e.to]
+		merged := false
+		for i := range srv.Edges {
+			if srv.Edges[i] == e.edge || (srv.Edges[i].Target == e.edge.Target && e.edge == Edge{Target: e.edge.Target}) {
+				srv.Edges[i].Weight = srv.Edges[i].GetWeight() + e.edge.GetWeight()
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			srv.Edges = append(srv.Edges, e.edge)
+		}
+	}
+	if err := out.Validate(); err != nil {
+		return ServiceGraph{}, err
+	}
+	return out, nil
+}
+
+// ParseDot reads a graph in the DOT language of Graphviz (`digraph { a -> b -> c; a [label="frontend replicas:2"] }`).
+// Subgraphs are flattened, `->` and `--` are both considered as a call from left to right and ports are ignored.
+// Node labels are read like the ones of ParseMermaid, the `replicas`, `role` and `tier` attributes and the shapes of DotGenerator are also used.
+// Edge labels set the attributes of the calls (e.g. `grpc x3 10ms 1%`).
+func ParseDot(b []byte) (ServiceGraph, error) {
+	tokens, err := dotTokenize(string(b))
+	if err != nil {
+		return ServiceGraph{}, err
+	}
+	p := &dotParser{tokens: tokens, diagram: newDiagram()}
+	if err := p.parseGraph(); err != nil {
+		return ServiceGraph{}, fmt.Errorf("invalid dot: %w", err)
+	}
+	return p.diagram.graph("name:dot")
+}
+
+type dotToken struct {
+	value string
+	// id whether the token is an identifier (quoted or not) rather than punctuation.
+	id bool
+}
+
+func dotTokenize(s string) ([]dotToken, error) {
+	var out []dotToken
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '#' || (c == '/' && i+1 < len(r) && r[i+1] == '/'):
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			for i += 2; i+1 < len(r) && (r[i] != '*' || r[i+1] != '/'); i++ {
+			}
+			if i+1 >= len(r) {
+				return nil, errors.New("unterminated comment")
+			}
+			i += 2
+		case c == '-' && i+1 < len(r) && (r[i+1] == '>' || r[i+1] == '-'):
+			out = append(out, dotToken{value: string(r[i : i+2])})
+			i += 2
+		case strings.ContainsRune("{}[];,=:", c):
+			out = append(out, dotToken{value: string(c)})
+			i++
+		case c == '"':
+			var sb strings.Builder
+			i++
+			for ; i < len(r) && r[i] != '"'; i++ {
+				if r[i] == '\\' && i+1 < len(r) && r[i+1] == '"' {
+					i++
+				} else if r[i] == '\\' && i+1 < len(r) && r[i+1] == '\n' {
+					i++
+					continue
+				}
+				sb.WriteRune(r[i])
+			}
+			if i >= len(r) {
+				return nil, errors.New("unterminated string")
+			}
+			i++
+			out = append(out, dotToken{value: sb.String(), id: true})
+		case c == '<':
+			// HTML strings are kept as is.
+			depth, start := 0, i
+			for ; i < len(r); i++ {
+				if r[i] == '<' {
+					depth++
+				} else if r[i] == '>' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if i >= len(r) {
+				return nil, errors.New("unterminated html string")
+			}
+			i++
+			out = append(out, dotToken{value: string(r[start+1 : i-1]), id: true})
+		case isDotIdRune(r, i):
+			start := i
+			for i < len(r) && isDotIdRune(r, i) {
+				i++
+			}
+			out = append(out, dotToken{value: string(r[start:i]), id: true})
+		default:
+			return nil, fmt.Errorf("unexpected character '%c'", c)
+		}
+	}
+	return out, nil
+}
+
+// isDotIdRune whether the rune is part of an unquoted id, `-` is accepted when followed by a letter or a digit as it's common in names.
+func isDotIdRune(r []rune, i int) bool {
+	c := r[i]
+	if c == '-' {
+		return i+1 < len(r) && (unicode.IsLetter(r[i+1]) || unicode.IsDigit(r[i+1]))
+	}
+	return c == '_' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+type dotParser struct {
+	tokens  []dotToken
+	pos     int
+	diagram *diagram
+}
+
+func (p *dotParser) peek() (dotToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return dotToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *dotParser) peekIs(value string) bool {
+	t, ok := p.peek()
+	return ok && !t.id && t.value == value
+}
+
+func (p *dotParser) peekKeyword(keyword string) bool {
+	t, ok := p.peek()
+	return ok && t.id && strings.EqualFold(t.value, keyword)
+}
+
+func (p *dotParser) expect(value string) error {
+	if !p.peekIs(value) {
+		return p.unexpected("'" + value + "'")
+	}
+	p.pos++
+	return nil
+}
+
+func (p *dotParser) id() (string, error) {
+	t, ok := p.peek()
+	if !ok || !t.id {
+		return "", p.unexpected("an identifier")
+	}
+	p.pos++
+	return t.value, nil
+}
+
+func (p *dotParser) unexpected(expected string) error {
+	if t, ok := p.peek(); ok {
+		return fmt.Errorf("expected %s got '%s'", expected, t.value)
+	}
+	return fmt.Errorf("expected %s got end of input", expected)
+}
+
+func (p *dotParser) parseGraph() error {
+	if p.peekKeyword("strict") {
+		p.pos++
+	}
+	if !p.peekKeyword("digraph") && !p.peekKeyword("graph") {
+		return p.unexpected("'digraph' or 'graph'")
+	}
+	p.pos++
+	if !p.peekIs("{") {
+		if _, err := p.id(); err != nil {
+			return err
+		}
+	}
+	if _, err := p.parseBlock(); err != nil {
+		return err
+	}
+	if _, ok := p.peek(); ok {
+		return p.unexpected("end of input")
+	}
+	return nil
+}
+
+// parseBlock parses `{ stmt_list }` and returns the ids of the nodes used in it.
+func (p *dotParser) parseBlock() ([]string, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var out []string
+	for !p.peekIs("}") {
+		if _, ok := p.peek(); !ok {
+			return nil, p.unexpected("'}'")
+		}
+		ids, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ids...)
+		for p.peekIs(";") || p.peekIs(",") {
+			p.pos++
+		}
+	}
+	p.pos++
+	return out, nil
+}
+
+func (p *dotParser) parseStatement() ([]string, error) {
+	if p.peekKeyword("graph") || p.peekKeyword("node") || p.peekKeyword("edge") {
+		// Default attributes only change the rendering.
+		p.pos++
+		_, err := p.parseAttrs()
+		return nil, err
+	}
+	if p.pos+1 < len(p.tokens) && p.tokens[p.pos].id && !p.peekKeyword("subgraph") && p.tokens[p.pos+1].value == "=" && !p.tokens[p.pos+1].id {
+		// Graph attribute like `rankdir=LR`.
+		p.pos += 2
+		_, err := p.id()
+		return nil, err
+	}
+	var all []string
+	from, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	all = append(all, from...)
+	type link struct{ from, to []string }
+	var links []link
+	for p.peekIs("->") || p.peekIs("--") {
+		p.pos++
+		to, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link{from: from, to: to})
+		all = append(all, to...)
+		from = to
+	}
+	attrs, err := p.parseAttrs()
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		for _, id := range from {
+			n := p.diagram.node(id)
+			if label, exists := attrs["label"]; exists {
+				if err := n.setLabel(label); err != nil {
+					return nil, err
+				}
+			}
+			if role, exists := dotRoles[attrs["shape"]]; exists && n.role == "" {
+				n.role = role
+			}
+			for _, key := range []string{"replicas", "role", "tier"} {
+				if v, exists := attrs[key]; exists {
+					if err := n.setAttr(key, v); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		return all, nil
+	}
+	edge, err := parseEdgeLabel(attrs["label"])
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		for _, f := range l.from {
+			for _, t := range l.to {
+				p.diagram.edge(f, t, edge)
+			}
+		}
+	}
+	return all, nil
+}
+
+// parseOperand parses a node id (with an optional port) or a subgraph.
+func (p *dotParser) parseOperand() ([]string, error) {
+	if p.peekKeyword("subgraph") {
+		p.pos++
+		if !p.peekIs("{") {
+			if _, err := p.id(); err != nil {
+				return nil, err
+			}
+		}
+		return p.parseBlock()
+	}
+	if p.peekIs("{") {
+		return p.parseBlock()
+	}
+	id, err := p.id()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekIs(":") {
+		p.pos++
+		if _, err := p.id(); err != nil {
+			return nil, err
+		}
+	}
+	p.diagram.node(id)
+	return []string{id}, nil
+}
+
+func (p *dotParser) parseAttrs() (map[string]string, error) {
+	out := map[string]string{}
+	for p.peekIs("[") {
+		p.pos++
+		for !p.peekIs("]") {
+			key, err := p.id()
+			if err != nil {
+				return nil, err
+			}
+			value := "true"
+			if p.peekIs("=") {
+				p.pos++
+				if value, err = p.id(); err != nil {
+					return nil, err
+				}
+			}
+			out[key] = value
+			for p.peekIs(",") || p.peekIs(";") {
+				p.pos++
+			}
+		}
+		p.pos++
+	}
+	return out, nil
+}
+
+var dotRoles = reverse(dotShapes)
+
+var mermaidRoles = func() map[string]string {
+	out := map[string]string{}
+	for role, shape := range mermaidShapes {
+		out[shape[0]] = role
+	}
+	return out
+}()
+
+func reverse(m map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range m {
+		out[v] = k
+	}
+	return out
+}
+
+// mermaidOpeners the opening delimiters of the shapes of nodes with their closing delimiter (longest first).
+var mermaidOpeners = [][2]string{
+	{"(((", ")))"}, {"([", "])"}, {"[(", ")]"}, {"[[", "]]"}, {"((", "))"}, {"{{", "}}"},
+	{"[/", "/]"}, {"[\\", "\\]"}, {"[/", "\\]"}, {"[\\", "/]"}, {"(", ")"}, {"[", "]"}, {"{", "}"}, {">", "]"},
+}
+
+var (
+	mermaidHeader       = regexp.MustCompile(`^(?:graph|flowchart)(?:\s+(?:TD|TB|BT|RL|LR))?$`)
+	mermaidIgnored      = regexp.MustCompile(`^(?:classDef|class|style|linkStyle|click|direction|subgraph|end|accTitle|accDescr)(?:\s|$)`)
+	mermaidId           = regexp.MustCompile(`^[\p{L}\p{N}_]+(?:[-.][\p{L}\p{N}_]+)*`)
+	mermaidArrow        = regexp.MustCompile(`^<?(?:-{2,}|={2,}|-\.+-|~{3,})[>xo]?(?:\|([^|]*)\|)?`)
+	mermaidLabeledArrow = regexp.MustCompile(`^<?(?:--|==|-\.)\s+(.+?)\s+(?:-{2,}|={2,}|\.+-)[>xo]?`)
+)
+
+// ParseMermaid reads a Mermaid flowchart (`graph TD; a(frontend replicas:2) --> b`).
+// Chains (`a --> b --> c`), groups (`a & b --> c`), all the shapes and arrows of flowcharts and edge labels (`-->|grpc x2|` or `-- grpc x2 -->`)
+// are supported, styling statements and subgraphs are ignored.
+// Node labels are `<name> [replicas:N] [role:X] [tier:X]` (the shapes of MermaidGenerator also set the role).
+func ParseMermaid(b []byte) (ServiceGraph, error) {
+	d := newDiagram()
+	header := false
+	for lineNo, line := range strings.Split(string(b), "\n") {
+		if i := strings.Index(line, "%%"); i >= 0 {
+			line = line[:i]
+		}
+		for _, stmt := range strings.Split(line, ";") {
+			stmt = strings.TrimSpace(stmt)
+			if stmt == "" {
+				continue
+			}
+			if !header {
+				if !mermaidHeader.MatchString(stmt) {
+					return ServiceGraph{}, fmt.Errorf("invalid mermaid line %d: must start with 'graph' or 'flowchart'", lineNo+1)
+				}
+				header = true
+				continue
+			}
+			if mermaidIgnored.MatchString(stmt) {
+				continue
+			}
+			if err := parseMermaidStatement(d, stmt); err != nil {
+				return ServiceGraph{}, fmt.Errorf("invalid mermaid line %d: %w", lineNo+1, err)
+			}
+		}
+	}
+	if !header {
+		return ServiceGraph{}, errors.New("invalid mermaid: must start with 'graph' or 'flowchart'")
+	}
+	return d.graph("name:mermaid")
+}
+
+func parseMermaidStatement(d *diagram, stmt string) error {
+	rest := stmt
+	var from []string
+	var edge *Edge
+	for {
+		// A group of nodes separated by `&`.
+		var group []string
+		for {
+			rest = strings.TrimSpace(rest)
+			id, remaining, err := parseMermaidNode(d, rest)
+			if err != nil {
+				return err
+			}
+			group = append(group, id)
+			rest = strings.TrimSpace(remaining)
+			if !strings.HasPrefix(rest, "&") {
+				break
+			}
+			rest = rest[1:]
+		}
+		if edge != nil {
+			for _, f := range from {
+				for _, t := range group {
+					d.edge(f, t, *edge)
+				}
+			}
+		}
+		if rest == "" {
+			return nil
+		}
+		label := ""
+		if m := mermaidLabeledArrow.FindStringSubmatch(rest); m != nil {
+			label, rest = m[1], rest[len(m[0]):]
+		} else if m := mermaidArrow.FindStringSubmatch(rest); m != nil {
+			label, rest = m[1], rest[len(m[0]):]
+		} else {
+			return fmt.Errorf("unexpected '%s'", rest)
+		}
+		e, err := parseEdgeLabel(strings.Trim(label, `"`))
+		if err != nil {
+			return err
+		}
+		edge, from = &e, group
+	}
+}
+
+// parseMermaidNode parses a node with its optional shape and label and returns its id with what's left of the statement.
+func parseMermaidNode(d *diagram, s string) (string, string, error) {
+	id := mermaidId.FindString(s)
+	if id == "" {
+		return "", "", fmt.Errorf("expected a node got '%s'", s)
+	}
+	n := d.node(id)
+	rest := s[len(id):]
+	for _, opener := range mermaidOpeners {
+		if !strings.HasPrefix(rest, opener[0]) {
+			continue
+		}
+		inner := rest[len(opener[0]):]
+		var label string
+		if strings.HasPrefix(inner, `"`) {
+			end := strings.Index(inner[1:], `"`)
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated label for node '%s'", id)
+			}
+			label, inner = inner[1:end+1], inner[end+2:]
+			if !strings.HasPrefix(inner, opener[1]) {
+				continue
+			}
+			inner = inner[len(opener[1]):]
+		} else {
+			end := strings.Index(inner, opener[1])
+			if end < 0 {
+				continue
+			}
+			label, inner = inner[:end], inner[end+len(opener[1]):]
+		}
+		if err := n.setLabel(label); err != nil {
+			return "", "", err
+		}
+		if role, exists := mermaidRoles[opener[0]]; exists && n.role == "" {
+			n.role = role
+		}
+		rest = inner
+		break
+	}
+	// Classes (`a:::important`) only change the rendering.
+	if strings.HasPrefix(rest, ":::") {
+		rest = strings.TrimLeftFunc(rest[3:], func(r rune) bool {
+			return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+		})
+	}
+	return id, rest, nil
+}
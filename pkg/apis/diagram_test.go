@@ -0,0 +1,144 @@
+package apis_test
+
+import (
+	"bytes"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"reflect"
+	"testing"
+)
+
+var diagramGraph = apis.ServiceGraph{
+	Services: []apis.Service{
+		{Idx: 0, Name: "frontend", Role: apis.RoleFrontend, Replicas: 2, Edges: apis.EdgesTo(1, 3)},
+		{Idx: 1, Replicas: 3, Edges: apis.EdgesTo(2)},
+		{Idx: 2, Name: "db", Role: apis.RoleDatabase, Replicas: 1},
+		{Idx: 3, Name: "queue", Role: apis.RoleQueue, Replicas: 1},
+	},
+}
+
+func TestDiagramRoundTrip(t *testing.T) {
+	for name, tc := range map[string]struct {
+		generator apis.Generator
+		parse     func(b []byte) (apis.ServiceGraph, error)
+		// replicas whether the output has the replicas.
+		replicas bool
+	}{
+		"dot":     {generator: apis.DotGenerator, parse: apis.ParseDot},
+		"mermaid": {generator: apis.MermaidGenerator, parse: apis.ParseMermaid, replicas: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			if err := tc.generator.Apply(buf, diagramGraph); err != nil {
+				t.Fatal("failed", err)
+			}
+			graph, err := tc.parse(buf.Bytes())
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			expected := diagramGraph.Services
+			if !tc.replicas {
+				expected = nil
+				for _, srv := range diagramGraph.Services {
+					srv.Replicas = 1
+					expected = append(expected, srv)
+				}
+			}
+			if !reflect.DeepEqual(graph.Services, expected) {
+				t.Errorf("graph doesn't round trip got: %+v", graph.Services)
+			}
+		})
+	}
+}
+
+func TestParseDiagram(t *testing.T) {
+	expected := []apis.Service{
+		{Idx: 0, Name: "front-end", Replicas: 3, Tier: "edge", Edges: []apis.Edge{{Target: 1, Protocol: apis.ProtocolGRPC, Weight: 2}, {Target: 2, Protocol: apis.ProtocolGRPC, Weight: 2}, {Target: 3, LatencyMs: 10}}},
+		{Idx: 1, Name: "cart", Replicas: 2, Edges: apis.EdgesTo(4)},
+		{Idx: 2, Name: "catalog", Replicas: 1, Edges: []apis.Edge{{Target: 4, Weight: 2}}},
+		{Idx: 3, Name: "search", Replicas: 1},
+		{Idx: 4, Name: "db", Role: apis.RoleDatabase, Replicas: 1},
+	}
+	for name, tc := range map[string]struct {
+		parse func(b []byte) (apis.ServiceGraph, error)
+		given string
+	}{
+		"dot": {
+			parse: apis.ParseDot,
+			given: `// A hand-written mesh
+digraph mesh {
+  rankdir=LR
+  node [shape=box, style="rounded"]
+  "front-end" [label="Front End\nreplicas:3", tier=edge]
+  "front-end" -> {cart catalog} [label="grpc x2"]
+  "front-end" -> search [label="10ms"]
+  cart [replicas=2]
+  subgraph cluster_data {
+    label="data"
+    db [shape=cylinder]
+  }
+  cart -> db; catalog -> db
+  /* calls it twice */
+  catalog -> db
+}`,
+		},
+		"mermaid": {
+			parse: apis.ParseMermaid,
+			given: `flowchart LR
+  %% A hand-written mesh
+  A["Front End replicas:3 tier:edge"] -->|grpc x2| B(cart replicas:2) & C[catalog]
+  A -- 10ms --> D{search}
+  subgraph data
+    E[(db)]
+  end
+  B --> E
+  C --> E; C --> E
+  classDef important fill:#f96
+  class A important`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			graph, err := tc.parse([]byte(tc.given))
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			if !reflect.DeepEqual(graph.Services, expected) {
+				t.Errorf("unexpected services: %+v", graph.Services)
+			}
+		})
+	}
+}
+
+func TestParseDiagramErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		parse func(b []byte) (apis.ServiceGraph, error)
+		given string
+	}{
+		"dot cycle":        {parse: apis.ParseDot, given: "digraph { a -> b -> a }"},
+		"dot unterminated": {parse: apis.ParseDot, given: "digraph { a -> b"},
+		"dot not a graph":  {parse: apis.ParseDot, given: "services: []"},
+		"dot empty":        {parse: apis.ParseDot, given: "digraph {}"},
+		"mermaid header":   {parse: apis.ParseMermaid, given: "a --> b"},
+		"mermaid arrow":    {parse: apis.ParseMermaid, given: "graph TD\n a ~> b"},
+		"mermaid replicas": {parse: apis.ParseMermaid, given: "graph TD\n a(a replicas:0)"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tc.parse([]byte(tc.given)); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	for in, expected := range map[string]string{
+		"frontend":            "frontend",
+		"Checkout_Service.v2": "checkout-service-v2",
+		"--redis--":           "redis",
+		"ÉÀ":                  "",
+		"a-very-long-service-name-which-is-way-too-long-to-be-a-dns-label": "a-very-long-service-name-which-is-way-too-long-to-be-a-dns-labe",
+	} {
+		if out := apis.SanitizeName(in); out != expected {
+			t.Errorf("expected %s to be %q got %q", in, expected, out)
+		}
+	}
+}
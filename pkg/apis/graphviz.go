@@ -0,0 +1,258 @@
+package apis
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// dotGenerator outputs the service graph in dot format with the styling of its options.
+type dotGenerator struct {
+	labels     bool
+	colors     bool
+	ranks      bool
+	clusterKey string
+}
+
+type DotOption interface {
+	Apply(g *dotGenerator) error
+}
+
+type DotOptionFn func(g *dotGenerator) error
+
+func (f DotOptionFn) Apply(g *dotGenerator) error {
+	return f(g)
+}
+
+// WithDotLabels labels nodes with the name, replicas and role of the service and edges with the protocol, weight, latency,
+// error rate, timeout and retries of the call (these labels are read back by ParseDot).
+func WithDotLabels() DotOption {
+	return DotOptionFn(func(g *dotGenerator) error {
+		g.labels = true
+		return nil
+	})
+}
+
+// WithDotColors fills nodes with a color per tier or per role for services without a tier.
+func WithDotColors() DotOption {
+	return DotOptionFn(func(g *dotGenerator) error {
+		g.colors = true
+		return nil
+	})
+}
+
+// WithDotRanks puts services at the same depth (the length of the longest chain of calls leading to them) on the same rank.
+func WithDotRanks() DotOption {
+	return DotOptionFn(func(g *dotGenerator) error {
+		g.ranks = true
+		return nil
+	})
+}
+
+// WithDotClusters groups services in a `subgraph cluster_*` by the value of a label (e.g. `namespace` or `zone`), `tier` groups by tier.
+// Services without the label are outside any cluster.
+func WithDotClusters(key string) DotOption {
+	return DotOptionFn(func(g *dotGenerator) error {
+		if key == "" {
+			return fmt.Errorf("cluster key can't be empty")
+		}
+		g.clusterKey = key
+		return nil
+	})
+}
+
+// RichDotOpts the options for a fully styled graph (labels, colors and ranks).
+func RichDotOpts() []DotOption {
+	return []DotOption{WithDotLabels(), WithDotColors(), WithDotRanks()}
+}
+
+// NewDotGenerator creates a dot generator, without options the output is the same as DotGenerator.
+func NewDotGenerator(opts ...DotOption) (Generator, error) {
+	g := &dotGenerator{}
+	for _, o := range opts {
+		if err := o.Apply(g); err != nil {
+			return nil, err
+		}
+	}
+	if *g == (dotGenerator{}) {
+		return DotGenerator, nil
+	}
+	return g, nil
+}
+
+var roleColors = map[string]string{
+	RoleFrontend: "#a6cee3",
+	RoleGateway:  "#b2df8a",
+	RoleBackend:  "#fdbf6f",
+	RoleDatabase: "#fb9a99",
+	RoleQueue:    "#cab2d6",
+}
+
+// tierColors the colors given to tiers in the order they appear in the graph.
+var tierColors = []string{"#8dd3c7", "#ffffb3", "#bebada", "#fb8072", "#80b1d3", "#fdb462", "#b3de69", "#fccde5", "#d9d9d9", "#bc80bd"}
+
+func (g *dotGenerator) Apply(writer io.Writer, s ServiceGraph) error {
+	var lines []string
+	if g.colors {
+		lines = append(lines, "node [style=filled];")
+	}
+	colors := Colors(s)
+	// Nodes are written in their cluster (if any) in the order of the clusters' first service.
+	var clusters []string
+	clustered := map[string][]string{}
+	for _, srv := range s.Services {
+		node := fmt.Sprintf("%d [%s];", srv.Idx, strings.Join(g.nodeAttrs(srv, colors[srv.Idx]), ","))
+		cluster := g.clusterOf(srv)
+		if cluster == "" {
+			lines = append(lines, node)
+			continue
+		}
+		if _, exists := clustered[cluster]; !exists {
+			clusters = append(clusters, cluster)
+		}
+		clustered[cluster] = append(clustered[cluster], node)
+	}
+	for _, cluster := range clusters {
+		lines = append(lines, fmt.Sprintf("subgraph %s {", dotQuote("cluster_"+g.clusterKey+"_"+cluster)))
+		lines = append(lines, fmt.Sprintf("\tlabel=%s;", dotQuote(g.clusterKey+": "+cluster)))
+		for _, node := range clustered[cluster] {
+			lines = append(lines, "\t"+node)
+		}
+		lines = append(lines, "}")
+	}
+	if g.ranks {
+		depths := Depths(s)
+		byDepth := map[int][]string{}
+		maxDepth := 0
+		for i, d := range depths {
+			byDepth[d] = append(byDepth[d], strconv.Itoa(i))
+			maxDepth = max(maxDepth, d)
+		}
+		for d := 0; d <= maxDepth; d++ {
+			if len(byDepth[d]) > 0 {
+				lines = append(lines, fmt.Sprintf("{rank=same; %s;}", strings.Join(byDepth[d], "; ")))
+			}
+		}
+	}
+	for _, srv := range s.Services {
+		for _, e := range srv.Edges {
+			if g.labels {
+				lines = append(lines, fmt.Sprintf("%d -> %d [label=%s];", srv.Idx, e.Target, dotQuote(EdgeLabel(e))))
+			} else {
+				lines = append(lines, fmt.Sprintf("%d -> %d;", srv.Idx, e.Target))
+			}
+		}
+	}
+	_, err := fmt.Fprintf(writer, "digraph{\n%s\n}\n", strings.Join(lines, "\n"))
+	return err
+}
+
+func (g *dotGenerator) nodeAttrs(srv Service, color string) []string {
+	var attrs []string
+	if g.labels {
+		label := []string{srv.DisplayName(), fmt.Sprintf("replicas:%d", srv.Replicas)}
+		if srv.Role != "" {
+			label = append(label, "role:"+srv.Role)
+		}
+		attrs = append(attrs, "label="+dotQuote(strings.Join(label, `\n`)))
+	} else if srv.Name != "" {
+		attrs = append(attrs, "label="+dotQuote(srv.Name))
+	}
+	if shape, exists := dotShapes[srv.Role]; exists {
+		attrs = append(attrs, "shape="+shape)
+	}
+	if srv.Tier != "" {
+		attrs = append(attrs, "tier="+dotQuote(srv.Tier))
+	}
+	if g.colors && color != "" {
+		attrs = append(attrs, "fillcolor="+dotQuote(color))
+	}
+	return attrs
+}
+
+// Colors returns the fill color of each service: a color per tier (in the order tiers appear) or per role for services without a tier,
+// empty if the service has neither.
+func Colors(s ServiceGraph) []string {
+	out := make([]string, len(s.Services))
+	tiers := map[string]string{}
+	for i, srv := range s.Services {
+		if srv.Tier == "" {
+			out[i] = roleColors[srv.Role]
+			continue
+		}
+		if _, exists := tiers[srv.Tier]; !exists {
+			tiers[srv.Tier] = tierColors[len(tiers)%len(tierColors)]
+		}
+		out[i] = tiers[srv.Tier]
+	}
+	return out
+}
+
+func (g *dotGenerator) clusterOf(srv Service) string {
+	switch g.clusterKey {
+	case "":
+		return ""
+	case "tier":
+		return srv.Tier
+	default:
+		return srv.Labels[g.clusterKey]
+	}
+}
+
+// EdgeLabel describes a call like `grpc x3 10ms 1%` (the format read by ParseDot and ParseMermaid).
+func EdgeLabel(e Edge) string {
+	parts := []string{e.GetProtocol()}
+	if e.GetWeight() > 1 {
+		parts = append(parts, fmt.Sprintf("x%d", e.Weight))
+	}
+	if e.LatencyMs > 0 {
+		parts = append(parts, fmt.Sprintf("%dms", e.LatencyMs))
+	}
+	if e.ErrorRate > 0 {
+		parts = append(parts, strconv.FormatFloat(math.Round(e.ErrorRate*10000)/100, 'f', -1, 64)+"%")
+	}
+	if e.TimeoutMs > 0 {
+		parts = append(parts, fmt.Sprintf("timeout:%dms", e.TimeoutMs))
+	}
+	if e.Retries > 0 {
+		parts = append(parts, fmt.Sprintf("retries:%d", e.Retries))
+	}
+	return strings.Join(parts, " ")
+}
+
+// dotQuote quotes a string for dot keeping escape sequences like `\n`.
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// Depths returns the depth of each service: the length of the longest chain of calls from a service nobody calls.
+func Depths(s ServiceGraph) []int {
+	out := make([]int, len(s.Services))
+	// Process services in topological order so callers are done before their callees.
+	inDegree := make([]int, len(s.Services))
+	for _, srv := range s.Services {
+		for _, e := range srv.Edges {
+			inDegree[e.Target]++
+		}
+	}
+	var ready []int
+	for i, d := range inDegree {
+		if d == 0 {
+			ready = append(ready, i)
+		}
+	}
+	for len(ready) > 0 {
+		next := ready[0]
+		ready = ready[1:]
+		for _, e := range s.Services[next].Edges {
+			out[e.Target] = max(out[e.Target], out[next]+1)
+			inDegree[e.Target]--
+			if inDegree[e.Target] == 0 {
+				ready = append(ready, e.Target)
+			}
+		}
+	}
+	return out
+}
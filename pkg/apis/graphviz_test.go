@@ -0,0 +1,107 @@
+package apis_test
+
+import (
+	"bytes"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"reflect"
+	"testing"
+)
+
+var styledGraph = apis.ServiceGraph{
+	Services: []apis.Service{
+		{Idx: 0, Name: "frontend", Role: apis.RoleFrontend, Tier: "edge", Replicas: 2, Labels: map[string]string{"zone": "a"}, Edges: []apis.Edge{{Target: 1, Protocol: apis.ProtocolGRPC, Weight: 3, LatencyMs: 10}, {Target: 2, ErrorRate: 0.07, TimeoutMs: 200, Retries: 2}}},
+		{Idx: 1, Replicas: 1, Labels: map[string]string{"zone": "a"}, Edges: apis.EdgesTo(2)},
+		{Idx: 2, Name: "db", Role: apis.RoleDatabase, Replicas: 3, Labels: map[string]string{"zone": "b"}},
+	},
+}
+
+func TestNewDotGenerator(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts     []apis.DotOption
+		expected string
+	}{
+		"minimal": {
+			expected: `digraph{
+0 [label="frontend",shape=house];
+2 [label="db",shape=cylinder];
+0 -> 1;
+0 -> 2;
+1 -> 2;
+}
+`,
+		},
+		"rich": {
+			opts: append(apis.RichDotOpts(), apis.WithDotClusters("zone")),
+			expected: `digraph{
+node [style=filled];
+subgraph "cluster_zone_a" {
+	label="zone: a";
+	0 [label="frontend\nreplicas:2\nrole:frontend",shape=house,tier="edge",fillcolor="#8dd3c7"];
+	1 [label="1\nreplicas:1"];
+}
+subgraph "cluster_zone_b" {
+	label="zone: b";
+	2 [label="db\nreplicas:3\nrole:database",shape=cylinder,fillcolor="#fb9a99"];
+}
+{rank=same; 0;}
+{rank=same; 1;}
+{rank=same; 2;}
+0 -> 1 [label="grpc x3 10ms"];
+0 -> 2 [label="http 7% timeout:200ms retries:2"];
+1 -> 2 [label="http"];
+}
+`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			generator, err := apis.NewDotGenerator(tc.opts...)
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err := generator.Apply(buf, styledGraph); err != nil {
+				t.Fatal("failed", err)
+			}
+			if buf.String() != tc.expected {
+				t.Errorf("unexpected output:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestRichDotRoundTrip(t *testing.T) {
+	generator, err := apis.NewDotGenerator(append(apis.RichDotOpts(), apis.WithDotClusters("tier"))...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := generator.Apply(buf, styledGraph); err != nil {
+		t.Fatal("failed", err)
+	}
+	graph, err := apis.ParseDot(buf.Bytes())
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	// Labels are not part of the output.
+	var expected []apis.Service
+	for _, srv := range styledGraph.Services {
+		srv.Labels = nil
+		expected = append(expected, srv)
+	}
+	if !reflect.DeepEqual(graph.Services, expected) {
+		t.Errorf("graph doesn't round trip got: %+v", graph.Services)
+	}
+}
+
+func TestDepths(t *testing.T) {
+	graph := apis.ServiceGraph{Services: []apis.Service{
+		{Idx: 0, Edges: apis.EdgesTo(1, 3)},
+		{Idx: 1, Edges: apis.EdgesTo(2)},
+		{Idx: 2, Edges: apis.EdgesTo(3)},
+		{Idx: 3},
+		{Idx: 4, Edges: apis.EdgesTo(3)},
+	}}
+	if depths := apis.Depths(graph); !reflect.DeepEqual(depths, []int{0, 1, 2, 3, 0}) {
+		t.Errorf("unexpected depths: %v", depths)
+	}
+}
@@ -4,33 +4,304 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"gopkg.in/yaml.v3"
 	"io"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
+// Edge is a call from a service to another one.
+// An edge with only a target is serialized as a plain integer to stay compatible with the original format.
+type Edge struct {
+	// Target the idx of the service called.
+	Target int `yaml:"target" json:"target"`
+	// Protocol http or grpc (defaults to http).
+	Protocol string `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+	// Weight the number of calls done for each request received (defaults to 1).
+	Weight int `yaml:"weight,omitempty" json:"weight,omitempty"`
+	// LatencyMs the latency to inject on the call.
+	LatencyMs int `yaml:"latencyMs,omitempty" json:"latencyMs,omitempty"`
+	// ErrorRate the ratio of calls that should fail (between 0 and 1).
+	ErrorRate float64 `yaml:"errorRate,omitempty" json:"errorRate,omitempty"`
+	// TimeoutMs the timeout of the call (0 means no timeout).
+	TimeoutMs int `yaml:"timeoutMs,omitempty" json:"timeoutMs,omitempty"`
+	// Retries the number of retries on failure.
+	Retries int `yaml:"retries,omitempty" json:"retries,omitempty"`
+}
+
+// EdgesTo creates simple edges to each of the targets.
+func EdgesTo(targets ...int) []Edge {
+	out := make([]Edge, 0, len(targets))
+	for _, t := range targets {
+		out = append(out, Edge{Target: t})
+	}
+	return out
+}
+
+func (e Edge) isSimple() bool {
+	return e == Edge{Target: e.Target}
+}
+
+// GetProtocol returns the protocol of the edge with the default applied.
+func (e Edge) GetProtocol() string {
+	if e.Protocol == "" {
+		return ProtocolHTTP
+	}
+	return e.Protocol
+}
+
+// GetWeight returns the number of calls per request with the default applied.
+func (e Edge) GetWeight() int {
+	if e.Weight == 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+func (e Edge) validate() error {
+	switch e.Protocol {
+	case "", ProtocolHTTP, ProtocolGRPC:
+	default:
+		return fmt.Errorf("protocol '%s' is not supported accepted: http, grpc", e.Protocol)
+	}
+	if e.Weight < 0 {
+		return errors.New("weight can't be negative")
+	}
+	if e.LatencyMs < 0 {
+		return errors.New("latencyMs can't be negative")
+	}
+	if e.ErrorRate < 0 || e.ErrorRate > 1 {
+		return errors.New("errorRate must be between 0 and 1")
+	}
+	if e.TimeoutMs < 0 {
+		return errors.New("timeoutMs can't be negative")
+	}
+	if e.Retries < 0 {
+		return errors.New("retries can't be negative")
+	}
+	return nil
+}
+
+type edgeAlias Edge
+
+func (e Edge) MarshalJSON() ([]byte, error) {
+	if e.isSimple() {
+		return json.Marshal(e.Target)
+	}
+	return json.Marshal(edgeAlias(e))
+}
+
+func (e *Edge) UnmarshalJSON(b []byte) error {
+	var target int
+	if err := json.Unmarshal(b, &target); err == nil {
+		*e = Edge{Target: target}
+		return nil
+	}
+	var out edgeAlias
+	if err := json.Unmarshal(b, &out); err != nil {
+		return err
+	}
+	*e = Edge(out)
+	return nil
+}
+
+func (e Edge) MarshalYAML() (interface{}, error) {
+	if e.isSimple() {
+		return e.Target, nil
+	}
+	return edgeAlias(e), nil
+}
+
+func (e *Edge) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var target int
+		if err := value.Decode(&target); err != nil {
+			return err
+		}
+		*e = Edge{Target: target}
+		return nil
+	}
+	var out edgeAlias
+	if err := value.Decode(&out); err != nil {
+		return err
+	}
+	*e = Edge(out)
+	return nil
+}
+
+const (
+	RoleFrontend = "frontend"
+	RoleBackend  = "backend"
+	RoleDatabase = "database"
+	RoleQueue    = "queue"
+	RoleGateway  = "gateway"
+)
+
+var dns1123LabelRegexp = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+
+// generatedNameSuffixRegexp matches the `-%03d` suffix generators append to unnamed services.
+var generatedNameSuffixRegexp = regexp.MustCompile("-([0-9]{3,})$")
+
 type Service struct {
-	Idx      int   `yaml:"idx" json:"idx"`
-	Edges    []int `yaml:"edges" json:"edges"`
-	Replicas int   `yaml:"replicas" json:"replicas"`
+	Idx      int    `yaml:"idx" json:"idx"`
+	Edges    []Edge `yaml:"edges" json:"edges"`
+	Replicas int    `yaml:"replicas" json:"replicas"`
+	// Name a human-readable name (must be a DNS-1123 label), if empty a name is derived from the Idx.
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Role one of frontend, backend, database, queue, gateway.
+	Role   string            `yaml:"role,omitempty" json:"role,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	// Tier the layer of the mesh the service belongs to (edge, api, domain, data...).
+	Tier string `yaml:"tier,omitempty" json:"tier,omitempty"`
+}
+
+// DisplayName returns the name of the service or its idx if it has no name.
+func (s Service) DisplayName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%d", s.Idx)
+}
+
+func (s Service) validate() error {
+	if s.Name != "" && (len(s.Name) > 63 || !dns1123LabelRegexp.MatchString(s.Name)) {
+		return fmt.Errorf("name '%s' is not a valid DNS-1123 label", s.Name)
+	}
+	switch s.Role {
+	case "", RoleFrontend, RoleBackend, RoleDatabase, RoleQueue, RoleGateway:
+	default:
+		return fmt.Errorf("role '%s' is not supported accepted: frontend, backend, database, queue, gateway", s.Role)
+	}
+	if s.Tier != "" && (len(s.Tier) > 63 || !dns1123LabelRegexp.MatchString(s.Tier)) {
+		return fmt.Errorf("tier '%s' is not a valid DNS-1123 label", s.Tier)
+	}
+	// Labels end up on the k8s resources so they must be valid k8s labels.
+	keys := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("label key '%s' is invalid: %s", k, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(s.Labels[k]); len(errs) > 0 {
+			return fmt.Errorf("label '%s' has invalid value '%s': %s", k, s.Labels[k], strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// Defaults are mesh wide settings for calls, edges can override them.
+type Defaults struct {
+	// TimeoutMs the timeout of calls (0 means no timeout).
+	TimeoutMs int `yaml:"timeoutMs,omitempty" json:"timeoutMs,omitempty"`
+	// Retries the number of retries on failure.
+	Retries int `yaml:"retries,omitempty" json:"retries,omitempty"`
+	// CircuitBreakerErrors the number of consecutive errors after which an instance is ejected (0 disables circuit breaking).
+	CircuitBreakerErrors int `yaml:"circuitBreakerErrors,omitempty" json:"circuitBreakerErrors,omitempty"`
+}
+
+func (d Defaults) validate() error {
+	if d.TimeoutMs < 0 {
+		return errors.New("timeoutMs can't be negative")
+	}
+	if d.Retries < 0 {
+		return errors.New("retries can't be negative")
+	}
+	if d.CircuitBreakerErrors < 0 {
+		return errors.New("circuitBreakerErrors can't be negative")
+	}
+	return nil
 }
 
 type ServiceGraph struct {
 	Services         []Service `yaml:"services" json:"services"`
 	GenerationParams string    `yaml:"generationParams" json:"generationParams"`
+	Defaults         *Defaults `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+}
+
+// Callers returns for each service the idx of the services calling it (sorted and without duplicates).
+func (g ServiceGraph) Callers() map[int][]int {
+	out := map[int][]int{}
+	for _, srv := range g.Services {
+		seen := map[int]struct{}{}
+		for _, e := range srv.Edges {
+			if _, exists := seen[e.Target]; exists {
+				continue
+			}
+			seen[e.Target] = struct{}{}
+			out[e.Target] = append(out[e.Target], srv.Idx)
+		}
+	}
+	return out
+}
+
+// generatedNameOwner returns the idx of the unnamed service displayed or generated as `name`, -1 if there is none.
+func (g ServiceGraph) generatedNameOwner(name string) int {
+	idxStr := name
+	if m := generatedNameSuffixRegexp.FindStringSubmatch(name); m != nil {
+		idxStr = m[1]
+	}
+	idx, err := strconv.Atoi(idxStr)
+	if err != nil || idx >= len(g.Services) || g.Services[idx].Name != "" {
+		return -1
+	}
+	if idxStr != strconv.Itoa(idx) && idxStr != fmt.Sprintf("%03d", idx) {
+		// Not the canonical form so it can't be generated (e.g. `0001`).
+		return -1
+	}
+	return idx
 }
 
 func (g ServiceGraph) Validate() error {
+	if g.Defaults != nil {
+		if err := g.Defaults.validate(); err != nil {
+			return fmt.Errorf("invalid defaults: %s", err.Error())
+		}
+	}
 	// Check first that all indexes correspond to array idx
+	names := map[string]int{}
 	for i, srv := range g.Services {
 		if i != srv.Idx {
 			return fmt.Errorf("service's Idx:%d doesn't refer to its position in the service array: %d", i, srv.Idx)
 		}
+		if err := srv.validate(); err != nil {
+			return fmt.Errorf("service's Idx:%d is invalid: %s", i, err.Error())
+		}
+		if srv.Name != "" {
+			if other, exists := names[srv.Name]; exists {
+				return fmt.Errorf("service's Idx:%d has name '%s' which is already used by service's Idx:%d", i, srv.Name, other)
+			}
+			names[srv.Name] = i
+		}
 		for _, edge := range srv.Edges {
-			if edge >= len(g.Services) || edge < 0 {
-				return fmt.Errorf("service's Idx:%d has edge '%d' that is not an actual service", i, edge)
+			if edge.Target >= len(g.Services) || edge.Target < 0 {
+				return fmt.Errorf("service's Idx:%d has edge '%d' that is not an actual service", i, edge.Target)
+			}
+			if err := edge.validate(); err != nil {
+				return fmt.Errorf("service's Idx:%d has invalid edge '%d': %s", i, edge.Target, err.Error())
 			}
 		}
 	}
+	// Unnamed services are referred to by their idx or get a generated name (e.g. `api-play-001`)
+	// so explicit names must not collide with these either.
+	for i, srv := range g.Services {
+		if srv.Name == "" {
+			continue
+		}
+		if other := g.generatedNameOwner(srv.Name); other != -1 {
+			return fmt.Errorf("service's Idx:%d has name '%s' which collides with the generated name of service's Idx:%d", i, srv.Name, other)
+		}
+	}
 	// Check for cycles
 	permanentMark := map[int]struct{}{}
 	temporaryMark := map[int]struct{}{}
@@ -45,7 +316,7 @@ func (g ServiceGraph) Validate() error {
 		temporaryMark[n] = struct{}{}
 
 		for _, edge := range g.Services[n].Edges {
-			if err := visit(edge); err != nil {
+			if err := visit(edge.Target); err != nil {
 				return err
 			}
 		}
@@ -76,25 +347,55 @@ func (f GeneratorFunc) Apply(writer io.Writer, svc ServiceGraph) error {
 	return f(writer, svc)
 }
 
+var dotShapes = map[string]string{
+	RoleFrontend: "house",
+	RoleGateway:  "hexagon",
+	RoleDatabase: "cylinder",
+	RoleQueue:    "cds",
+}
+
 // DotGenerator outputs the service graph in dot format.
 var DotGenerator = GeneratorFunc(func(writer io.Writer, s ServiceGraph) error {
 	var allEdges []string
+	for _, srv := range s.Services {
+		var attrs []string
+		if srv.Name != "" {
+			attrs = append(attrs, fmt.Sprintf("label=%q", srv.Name))
+		}
+		if shape, exists := dotShapes[srv.Role]; exists {
+			attrs = append(attrs, "shape="+shape)
+		}
+		if len(attrs) > 0 {
+			allEdges = append(allEdges, fmt.Sprintf("%d [%s];", srv.Idx, strings.Join(attrs, ",")))
+		}
+	}
 	for _, srv := range s.Services {
 		for _, other := range srv.Edges {
-			allEdges = append(allEdges, fmt.Sprintf("%d -> %d;", srv.Idx, other))
+			allEdges = append(allEdges, fmt.Sprintf("%d -> %d;", srv.Idx, other.Target))
 		}
 	}
 	_, err := fmt.Fprintf(writer, "digraph{\n%s\n}\n", strings.Join(allEdges, "\n"))
 	return err
 })
 
+var mermaidShapes = map[string][2]string{
+	RoleFrontend: {"([", "])"},
+	RoleGateway:  {"{{", "}}"},
+	RoleDatabase: {"[(", ")]"},
+	RoleQueue:    {"[[", "]]"},
+}
+
 // MermaidGenerator outputs the service graph in mermaid format (this is rendered in github flavoured Markdown).
 var MermaidGenerator = GeneratorFunc(func(writer io.Writer, s ServiceGraph) error {
 	var allEdges []string
 	for _, srv := range s.Services {
-		allEdges = append(allEdges, fmt.Sprintf("\t%d(%d replicas:%d);", srv.Idx, srv.Idx, srv.Replicas))
+		shape, exists := mermaidShapes[srv.Role]
+		if !exists {
+			shape = [2]string{"(", ")"}
+		}
+		allEdges = append(allEdges, fmt.Sprintf("\t%d%s%s replicas:%d%s;", srv.Idx, shape[0], srv.DisplayName(), srv.Replicas, shape[1]))
 		for _, other := range srv.Edges {
-			allEdges = append(allEdges, fmt.Sprintf("\t%d --> %d;", srv.Idx, other))
+			allEdges = append(allEdges, fmt.Sprintf("\t%d --> %d;", srv.Idx, other.Target))
 		}
 	}
 	_, err := fmt.Fprintf(writer, "graph TD;\n%s\n\n", strings.Join(allEdges, "\n"))
@@ -1,8 +1,10 @@
 package apis_test
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"gopkg.in/yaml.v3"
 	"reflect"
 	"testing"
 )
@@ -25,9 +27,9 @@ func TestValidate(t *testing.T) {
 			desc: "Line graph",
 			given: apis.ServiceGraph{
 				Services: []apis.Service{
-					{Idx: 0, Edges: []int{1}, Replicas: 2},
-					{Idx: 1, Edges: []int{2}, Replicas: 2},
-					{Idx: 2, Edges: []int{}, Replicas: 2},
+					{Idx: 0, Edges: apis.EdgesTo(1), Replicas: 2},
+					{Idx: 1, Edges: apis.EdgesTo(2), Replicas: 2},
+					{Idx: 2, Edges: apis.EdgesTo(), Replicas: 2},
 				},
 			},
 			then: nil,
@@ -36,9 +38,9 @@ func TestValidate(t *testing.T) {
 			desc: "Loop graph",
 			given: apis.ServiceGraph{
 				Services: []apis.Service{
-					{Idx: 0, Edges: []int{1}, Replicas: 2},
-					{Idx: 1, Edges: []int{2}, Replicas: 2},
-					{Idx: 2, Edges: []int{0}, Replicas: 2},
+					{Idx: 0, Edges: apis.EdgesTo(1), Replicas: 2},
+					{Idx: 1, Edges: apis.EdgesTo(2), Replicas: 2},
+					{Idx: 2, Edges: apis.EdgesTo(0), Replicas: 2},
 				},
 			},
 			then: errors.New("cycle detected"),
@@ -47,26 +49,143 @@ func TestValidate(t *testing.T) {
 			desc: "Complex loop",
 			given: apis.ServiceGraph{
 				Services: []apis.Service{
-					{Idx: 0, Edges: []int{1}, Replicas: 2},
-					{Idx: 1, Edges: []int{2}, Replicas: 2},
-					{Idx: 2, Edges: []int{3, 4, 5}, Replicas: 2},
-					{Idx: 3, Edges: []int{4}, Replicas: 2},
-					{Idx: 4, Edges: []int{0}, Replicas: 2},
-					{Idx: 5, Edges: []int{0}, Replicas: 2},
+					{Idx: 0, Edges: apis.EdgesTo(1), Replicas: 2},
+					{Idx: 1, Edges: apis.EdgesTo(2), Replicas: 2},
+					{Idx: 2, Edges: apis.EdgesTo(3, 4, 5), Replicas: 2},
+					{Idx: 3, Edges: apis.EdgesTo(4), Replicas: 2},
+					{Idx: 4, Edges: apis.EdgesTo(0), Replicas: 2},
+					{Idx: 5, Edges: apis.EdgesTo(0), Replicas: 2},
 				},
 			},
 			then: errors.New("cycle detected"),
 		},
-
 		{
 			desc: "Invalid index",
 			given: apis.ServiceGraph{
 				Services: []apis.Service{
-					{Idx: 0, Edges: []int{1}, Replicas: 2},
+					{Idx: 0, Edges: apis.EdgesTo(1), Replicas: 2},
 				},
 			},
 			then: errors.New("service's Idx:0 has edge '1' that is not an actual service"),
 		},
+		{
+			desc: "Invalid edge attribute",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Edges: []apis.Edge{{Target: 1, ErrorRate: 2}}, Replicas: 2},
+					{Idx: 1, Replicas: 2},
+				},
+			},
+			then: errors.New("service's Idx:0 has invalid edge '1': errorRate must be between 0 and 1"),
+		},
+		{
+			desc: "Named graph",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Name: "frontend", Role: apis.RoleFrontend, Edges: apis.EdgesTo(1), Replicas: 2},
+					{Idx: 1, Name: "db", Role: apis.RoleDatabase, Replicas: 2},
+				},
+			},
+			then: nil,
+		},
+		{
+			desc: "Invalid name",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Name: "Front_End", Replicas: 2},
+				},
+			},
+			then: errors.New("service's Idx:0 is invalid: name 'Front_End' is not a valid DNS-1123 label"),
+		},
+		{
+			desc: "Duplicate name",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Name: "backend", Replicas: 2},
+					{Idx: 1, Name: "backend", Replicas: 2},
+				},
+			},
+			then: errors.New("service's Idx:1 has name 'backend' which is already used by service's Idx:0"),
+		},
+		{
+			desc: "Name colliding with a generated name",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Name: "api-play-001", Replicas: 2},
+					{Idx: 1, Replicas: 2},
+				},
+			},
+			then: errors.New("service's Idx:0 has name 'api-play-001' which collides with the generated name of service's Idx:1"),
+		},
+		{
+			desc: "Name colliding with a display name",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Replicas: 2},
+					{Idx: 1, Name: "0", Replicas: 2},
+				},
+			},
+			then: errors.New("service's Idx:1 has name '0' which collides with the generated name of service's Idx:0"),
+		},
+		{
+			desc: "Name matching its own generated name or a named service",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Name: "api-play-000", Replicas: 2},
+					{Idx: 1, Name: "backend-002", Replicas: 2},
+					{Idx: 2, Name: "frontend", Replicas: 2},
+					{Idx: 3, Name: "db-0001", Replicas: 2},
+					{Idx: 4, Replicas: 2},
+				},
+			},
+			then: nil,
+		},
+		{
+			desc: "Invalid role",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Role: "cache", Replicas: 2},
+				},
+			},
+			then: errors.New("service's Idx:0 is invalid: role 'cache' is not supported accepted: frontend, backend, database, queue, gateway"),
+		},
+		{
+			desc: "Labels",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Labels: map[string]string{"app.kubernetes.io/part-of": "shop", "zone": "us_east.1", "empty": ""}, Replicas: 2},
+				},
+			},
+			then: nil,
+		},
+		{
+			desc: "Invalid label key",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Labels: map[string]string{"zone": "a", "my zone": "b"}, Replicas: 2},
+				},
+			},
+			then: errors.New("service's Idx:0 is invalid: label key 'my zone' is invalid: name part must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]')"),
+		},
+		{
+			desc: "Invalid label value",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Labels: map[string]string{"zone": "us east"}, Replicas: 2},
+				},
+			},
+			then: errors.New("service's Idx:0 is invalid: label 'zone' has invalid value 'us east': a valid label must be an empty string or consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyValue',  or 'my_value',  or '12345', regex used for validation is '(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?')"),
+		},
+		{
+			desc: "Invalid defaults",
+			given: apis.ServiceGraph{
+				Services: []apis.Service{
+					{Idx: 0, Replicas: 2},
+				},
+				Defaults: &apis.Defaults{Retries: -1},
+			},
+			then: errors.New("invalid defaults: retries can't be negative"),
+		},
 	}
 	for _, tc := range tests {
 		got := tc.given.Validate()
@@ -75,3 +194,60 @@ func TestValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestEdgeSerialization(t *testing.T) {
+	type testCase struct {
+		desc  string
+		given string
+		then  []apis.Edge
+	}
+	tests := []testCase{
+		{
+			desc:  "plain int edges",
+			given: `[1, 2]`,
+			then:  apis.EdgesTo(1, 2),
+		},
+		{
+			desc:  "mixed edges",
+			given: `[1, {"target": 2, "protocol": "grpc", "weight": 10, "latencyMs": 20, "errorRate": 0.05, "timeoutMs": 200, "retries": 2}]`,
+			then: []apis.Edge{
+				{Target: 1},
+				{Target: 2, Protocol: "grpc", Weight: 10, LatencyMs: 20, ErrorRate: 0.05, TimeoutMs: 200, Retries: 2},
+			},
+		},
+		{
+			desc:  "unknown fields are ignored by lenient decoders",
+			given: `[{"target": 1, "latncyMs": 20}]`,
+			then:  apis.EdgesTo(1),
+		},
+	}
+	for _, tc := range tests {
+		var fromJson []apis.Edge
+		if err := json.Unmarshal([]byte(tc.given), &fromJson); err != nil {
+			t.Fatalf("test: %s, failed to parse json: %v", tc.desc, err)
+		}
+		if !reflect.DeepEqual(tc.then, fromJson) {
+			t.Fatalf("test: %s, expected: %v, got: %v", tc.desc, tc.then, fromJson)
+		}
+		// JSON is a subset of YAML
+		var fromYaml []apis.Edge
+		if err := yaml.Unmarshal([]byte(tc.given), &fromYaml); err != nil {
+			t.Fatalf("test: %s, failed to parse yaml: %v", tc.desc, err)
+		}
+		if !reflect.DeepEqual(tc.then, fromYaml) {
+			t.Fatalf("test: %s, expected: %v, got: %v", tc.desc, tc.then, fromYaml)
+		}
+		// Round trip
+		b, err := yaml.Marshal(fromYaml)
+		if err != nil {
+			t.Fatalf("test: %s, failed to serialize yaml: %v", tc.desc, err)
+		}
+		var roundTrip []apis.Edge
+		if err := yaml.Unmarshal(b, &roundTrip); err != nil {
+			t.Fatalf("test: %s, failed to parse yaml: %v", tc.desc, err)
+		}
+		if !reflect.DeepEqual(tc.then, roundTrip) {
+			t.Fatalf("test: %s, expected: %v, got: %v", tc.desc, tc.then, roundTrip)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+)
+
+// Parse reads a service graph in yaml or json (detected automatically).
+// Unknown fields are rejected, including inside edges.
+func Parse(b []byte) (ServiceGraph, error) {
+	out := ServiceGraph{}
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 {
+		return out, errors.New("empty service graph")
+	}
+	if trimmed[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&out); err != nil {
+			return out, err
+		}
+		return out, checkJSONEdgeFields(trimmed)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(trimmed))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&out); err != nil {
+		return out, err
+	}
+	return out, checkYAMLEdgeFields(trimmed)
+}
+
+// edgeFields the yaml fields of an edge.
+var edgeFields = func() map[string]struct{} {
+	out := map[string]struct{}{}
+	t := reflect.TypeOf(Edge{})
+	for i := 0; i < t.NumField(); i++ {
+		out[strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]] = struct{}{}
+	}
+	return out
+}()
+
+// checkJSONEdgeFields rejects unknown fields in edges as decoder options don't apply to Edge.UnmarshalJSON.
+func checkJSONEdgeFields(b []byte) error {
+	var graph struct {
+		Services []struct {
+			Edges []json.RawMessage `json:"edges"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal(b, &graph); err != nil {
+		return err
+	}
+	for _, srv := range graph.Services {
+		for _, raw := range srv.Edges {
+			if len(raw) == 0 || raw[0] != '{' {
+				continue
+			}
+			decoder := json.NewDecoder(bytes.NewReader(raw))
+			decoder.DisallowUnknownFields()
+			var e edgeAlias
+			if err := decoder.Decode(&e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkYAMLEdgeFields rejects unknown fields in edges as KnownFields doesn't apply to Edge.UnmarshalYAML.
+func checkYAMLEdgeFields(b []byte) error {
+	var graph struct {
+		Services []struct {
+			Edges []yaml.Node `yaml:"edges"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(b, &graph); err != nil {
+		return err
+	}
+	for _, srv := range graph.Services {
+		for _, edge := range srv.Edges {
+			if edge.Kind != yaml.MappingNode {
+				continue
+			}
+			for i := 0; i < len(edge.Content); i += 2 {
+				key := edge.Content[i]
+				if _, exists := edgeFields[key.Value]; !exists {
+					return fmt.Errorf("line %d: field %s not found in type apis.Edge", key.Line, key.Value)
+				}
+			}
+		}
+	}
+	return nil
+}
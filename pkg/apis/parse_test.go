@@ -0,0 +1,72 @@
+package apis_test
+
+import (
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	expected := apis.ServiceGraph{
+		Services: []apis.Service{
+			{Idx: 0, Name: "frontend", Edges: []apis.Edge{{Target: 1}, {Target: 2, TimeoutMs: 200}}, Replicas: 2},
+			{Idx: 1, Edges: apis.EdgesTo(), Replicas: 1},
+			{Idx: 2, Edges: apis.EdgesTo(), Replicas: 1},
+		},
+	}
+	type testCase struct {
+		desc  string
+		given string
+	}
+	tests := []testCase{
+		{
+			desc: "yaml",
+			given: `
+services:
+  - idx: 0
+    name: frontend
+    replicas: 2
+    edges:
+      - 1
+      - target: 2
+        timeoutMs: 200
+  - idx: 1
+    replicas: 1
+    edges: []
+  - idx: 2
+    replicas: 1
+    edges: []
+`,
+		},
+		{
+			desc: "json",
+			given: `
+{"services": [
+  {"idx": 0, "name": "frontend", "replicas": 2, "edges": [1, {"target": 2, "timeoutMs": 200}]},
+  {"idx": 1, "replicas": 1, "edges": []},
+  {"idx": 2, "replicas": 1, "edges": []}
+]}`,
+		},
+	}
+	for _, tc := range tests {
+		got, err := apis.Parse([]byte(tc.given))
+		if err != nil {
+			t.Fatalf("test: %s, failed to parse: %v", tc.desc, err)
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Fatalf("test: %s, expected: %v, got: %v", tc.desc, expected, got)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, given := range []string{"", "services: [{idx: 0, unknown: 1}]", `{"services": "foo"}`,
+		// Unknown fields are also rejected in edges.
+		"services: [{idx: 0, edges: [{target: 1, latncyMs: 10}]}, {idx: 1}]",
+		`{"services": [{"idx": 0, "edges": [{"target": 1, "latncyMs": 10}]}, {"idx": 1}]}`,
+	} {
+		if _, err := apis.Parse([]byte(given)); err == nil {
+			t.Fatalf("expected an error parsing: '%s'", given)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package apis
 import (
 	"fmt"
 	"math/rand"
+	"sort"
 )
 
 // GenerateRandomMesh creates a mesh of some instances with some replicas.
@@ -10,21 +11,77 @@ func GenerateRandomMesh(seed int64, numServices, percentEdge, minReplicas, maxRe
 	r := rand.New(rand.NewSource(seed))
 	srvs := ServiceGraph{
 		GenerationParams: fmt.Sprintf("name:random,seed:%d,numServices:%d,percentEdge:%d,minReplicas:%d,maxReplicas:%d", seed, numServices, percentEdge, minReplicas, maxReplicas),
-	}
-	for i := 0; i < numServices; i++ {
-		numInstances := 1
-		if maxReplicas >= minReplicas {
-			numInstances = (r.Int() % (1 + maxReplicas - minReplicas)) + minReplicas
-		}
-		srvs.Services = append(srvs.Services, Service{Idx: i, Replicas: numInstances})
+		Services:         randomServices(r, numServices, minReplicas, maxReplicas),
 	}
 	// That's the whole story of DAG and topological sort with triangular matrix.
 	for i := 0; i < numServices; i++ {
 		for j := i + 1; j < numServices; j++ {
 			if r.Int()%(j-i) == 0 && r.Int()%100 < percentEdge {
-				srvs.Services[i].Edges = append(srvs.Services[i].Edges, j)
+				srvs.Services[i].Edges = append(srvs.Services[i].Edges, Edge{Target: j})
 			}
 		}
 	}
 	return srvs
 }
+
+// GenerateScaleFreeMesh creates a mesh using preferential attachment (Barabási–Albert) so that a few hub services receive most of the calls.
+// attachment is the number of services each new service calls and hubBias is the percentage of these calls that use preferential attachment (the rest is picked uniformly).
+func GenerateScaleFreeMesh(seed int64, numServices, attachment, hubBias, minReplicas, maxReplicas int) ServiceGraph {
+	r := rand.New(rand.NewSource(seed))
+	srvs := ServiceGraph{
+		GenerationParams: fmt.Sprintf("name:scalefree,seed:%d,numServices:%d,attachment:%d,hubBias:%d,minReplicas:%d,maxReplicas:%d", seed, numServices, attachment, hubBias, minReplicas, maxReplicas),
+		Services:         randomServices(r, numServices, minReplicas, maxReplicas),
+	}
+	// Services are added from the last to the first and only call services added before them (which have a higher index).
+	// This keeps the matrix triangular so the graph is a DAG.
+	inDegree := make([]int, numServices)
+	for i := numServices - 2; i >= 0; i-- {
+		var candidates []int
+		for j := i + 1; j < numServices; j++ {
+			candidates = append(candidates, j)
+		}
+		var targets []int
+		for len(targets) < attachment && len(candidates) > 0 {
+			pos := pickCandidate(r, candidates, inDegree, r.Int()%100 < hubBias)
+			targets = append(targets, candidates[pos])
+			candidates = append(candidates[:pos], candidates[pos+1:]...)
+		}
+		sort.Ints(targets)
+		for _, target := range targets {
+			inDegree[target]++
+			srvs.Services[i].Edges = append(srvs.Services[i].Edges, Edge{Target: target})
+		}
+	}
+	return srvs
+}
+
+// pickCandidate returns the position of a candidate picked either uniformly or proportionally to its in degree + 1.
+func pickCandidate(r *rand.Rand, candidates []int, inDegree []int, preferential bool) int {
+	if !preferential {
+		return r.Intn(len(candidates))
+	}
+	total := 0
+	for _, c := range candidates {
+		total += inDegree[c] + 1
+	}
+	n := r.Intn(total)
+	for i, c := range candidates {
+		n -= inDegree[c] + 1
+		if n < 0 {
+			return i
+		}
+	}
+	return len(candidates) - 1
+}
+
+func randomServices(r *rand.Rand, numServices, minReplicas, maxReplicas int) []Service {
+	var out []Service
+	for i := 0; i < numServices; i++ {
+		numInstances := 1
+		if maxReplicas >= minReplicas {
+			numInstances = (r.Int() % (1 + maxReplicas - minReplicas)) + minReplicas
+		}
+		out = append(out, Service{Idx: i, Replicas: numInstances})
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+package apis_test
+
+import (
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateScaleFreeMesh(t *testing.T) {
+	graph := apis.GenerateScaleFreeMesh(42, 50, 2, 100, 1, 3)
+	if err := graph.Validate(); err != nil {
+		t.Fatalf("generated graph is invalid: %v", err)
+	}
+	if len(graph.Services) != 50 {
+		t.Fatalf("expected 50 services, got: %d", len(graph.Services))
+	}
+	inDegree := map[int]int{}
+	for _, srv := range graph.Services {
+		expected := 2
+		if remaining := len(graph.Services) - 1 - srv.Idx; remaining < expected {
+			expected = remaining
+		}
+		if len(srv.Edges) != expected {
+			t.Fatalf("service %d expected %d edges, got: %d", srv.Idx, expected, len(srv.Edges))
+		}
+		if srv.Replicas < 1 || srv.Replicas > 3 {
+			t.Fatalf("service %d has out of bounds replicas: %d", srv.Idx, srv.Replicas)
+		}
+		for _, e := range srv.Edges {
+			inDegree[e.Target]++
+		}
+	}
+	maxInDegree := 0
+	for _, d := range inDegree {
+		if d > maxInDegree {
+			maxInDegree = d
+		}
+	}
+	// With full preferential attachment we should get a hub way above the average in degree of 2
+	if maxInDegree < 8 {
+		t.Errorf("expected a hub with a high in degree, max in degree: %d", maxInDegree)
+	}
+	if !reflect.DeepEqual(graph, apis.GenerateScaleFreeMesh(42, 50, 2, 100, 1, 3)) {
+		t.Errorf("generation is not deterministic")
+	}
+}
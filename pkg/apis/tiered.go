@@ -0,0 +1,92 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// GenerateTieredMesh creates a mesh shaped in layers (edge -> api -> domain -> data).
+// layers is the number of services in each layer and percentEdges the chance for an edge to exist between a service and a service of the next layer.
+// Every service is reachable from at least one service of the first layer.
+func GenerateTieredMesh(seed int64, layers []int, percentEdges []int, minReplicas, maxReplicas int) (ServiceGraph, error) {
+	if len(layers) == 0 {
+		return ServiceGraph{}, errors.New("must have at least one layer")
+	}
+	if len(percentEdges) != len(layers)-1 {
+		return ServiceGraph{}, fmt.Errorf("must have exactly %d percentEdges (one per pair of layers) got: %d", len(layers)-1, len(percentEdges))
+	}
+	numServices := 0
+	for i, l := range layers {
+		if l <= 0 {
+			return ServiceGraph{}, fmt.Errorf("layer %d must have at least one service", i)
+		}
+		numServices += l
+	}
+	r := rand.New(rand.NewSource(seed))
+	srvs := ServiceGraph{
+		GenerationParams: fmt.Sprintf("name:tiered,seed:%d,layers:%s,percentEdges:%s,minReplicas:%d,maxReplicas:%d", seed, joinInts(layers), joinInts(percentEdges), minReplicas, maxReplicas),
+		Services:         randomServices(r, numServices, minReplicas, maxReplicas),
+	}
+	start := 0
+	for l, size := range layers {
+		for i := start; i < start+size; i++ {
+			srvs.Services[i].Tier = TierName(l, len(layers))
+			switch l {
+			case 0:
+				srvs.Services[i].Role = RoleGateway
+			case len(layers) - 1:
+				srvs.Services[i].Role = RoleDatabase
+			default:
+				srvs.Services[i].Role = RoleBackend
+			}
+		}
+		if l == 0 {
+			start += size
+			continue
+		}
+		// Edges only go from the previous layer to this one which keeps the graph a DAG.
+		prevStart := start - layers[l-1]
+		for i := start; i < start+size; i++ {
+			hasCaller := false
+			for j := prevStart; j < start; j++ {
+				if r.Int()%100 < percentEdges[l-1] {
+					srvs.Services[j].Edges = append(srvs.Services[j].Edges, Edge{Target: i})
+					hasCaller = true
+				}
+			}
+			// Make sure the service is reachable from the previous layer
+			if !hasCaller {
+				j := prevStart + r.Intn(layers[l-1])
+				srvs.Services[j].Edges = append(srvs.Services[j].Edges, Edge{Target: i})
+			}
+		}
+		start += size
+	}
+	return srvs, nil
+}
+
+// TierName returns the name of the layer at position idx in a mesh of numLayers.
+func TierName(idx, numLayers int) string {
+	switch {
+	case idx == 0:
+		return "edge"
+	case idx == numLayers-1:
+		return "data"
+	case idx == 1:
+		return "api"
+	case numLayers == 4:
+		return "domain"
+	default:
+		return fmt.Sprintf("domain-%d", idx-1)
+	}
+}
+
+func joinInts(in []int) string {
+	var out []string
+	for _, i := range in {
+		out = append(out, fmt.Sprintf("%d", i))
+	}
+	return strings.Join(out, "-")
+}
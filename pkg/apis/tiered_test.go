@@ -0,0 +1,50 @@
+package apis_test
+
+import (
+	"errors"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateTieredMesh(t *testing.T) {
+	graph, err := apis.GenerateTieredMesh(12, []int{1, 3, 5, 4}, []int{0, 0, 0}, 1, 1)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	if err := graph.Validate(); err != nil {
+		t.Fatalf("generated graph is invalid: %v", err)
+	}
+	expectedTiers := []string{"edge", "api", "api", "api", "domain", "domain", "domain", "domain", "domain", "data", "data", "data", "data"}
+	var tiers []string
+	for _, srv := range graph.Services {
+		tiers = append(tiers, srv.Tier)
+	}
+	if !reflect.DeepEqual(expectedTiers, tiers) {
+		t.Fatalf("expected tiers: %v, got: %v", expectedTiers, tiers)
+	}
+	// Even with no chance of edges all services must be reachable from the entry point
+	reached := map[int]struct{}{0: {}}
+	queue := []int{0}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, e := range graph.Services[cur].Edges {
+			if _, exists := reached[e.Target]; !exists {
+				reached[e.Target] = struct{}{}
+				queue = append(queue, e.Target)
+			}
+		}
+	}
+	if len(reached) != len(graph.Services) {
+		t.Fatalf("expected all services to be reachable, reached: %d/%d", len(reached), len(graph.Services))
+	}
+}
+
+func TestGenerateTieredMeshInvalid(t *testing.T) {
+	_, err := apis.GenerateTieredMesh(12, []int{1, 3}, []int{20, 30}, 1, 1)
+	expected := errors.New("must have exactly 1 percentEdges (one per pair of layers) got: 2")
+	if !reflect.DeepEqual(expected, err) {
+		t.Fatalf("expected: %v, got: %v", expected, err)
+	}
+}
@@ -0,0 +1,69 @@
+package catalog
+
+import (
+	"embed"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"gopkg.in/yaml.v3"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed presets/*.yaml
+var presets embed.FS
+
+// Entry is a well-known mesh shipped with the generator.
+type Entry struct {
+	Name        string `yaml:"-"`
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	// Source a link to the original project.
+	Source   string         `yaml:"source,omitempty"`
+	Services []apis.Service `yaml:"services"`
+}
+
+// Graph returns the service graph of the entry.
+func (e Entry) Graph() apis.ServiceGraph {
+	return apis.ServiceGraph{
+		Services:         e.Services,
+		GenerationParams: fmt.Sprintf("name:preset,preset:%s", e.Name),
+	}
+}
+
+// Names returns the names of all the presets sorted alphabetically.
+func Names() []string {
+	files, _ := presets.ReadDir("presets")
+	var out []string
+	for _, f := range files {
+		out = append(out, strings.TrimSuffix(f.Name(), path.Ext(f.Name())))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Get returns the preset with this name.
+func Get(name string) (Entry, error) {
+	out := Entry{Name: name}
+	b, err := presets.ReadFile(path.Join("presets", name+".yaml"))
+	if err != nil {
+		return out, fmt.Errorf("preset '%s' doesn't exist accepted: %s", name, strings.Join(Names(), ", "))
+	}
+	if err := yaml.Unmarshal(b, &out); err != nil {
+		return out, fmt.Errorf("failed to parse preset '%s': %w", name, err)
+	}
+	return out, nil
+}
+
+// List returns all the presets.
+func List() ([]Entry, error) {
+	var out []Entry
+	for _, n := range Names() {
+		e, err := Get(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
@@ -0,0 +1,33 @@
+package catalog_test
+
+import (
+	"github.com/lahabana/microservice-mesh-generator/pkg/catalog"
+	"testing"
+)
+
+func TestPresetsAreValid(t *testing.T) {
+	entries, err := catalog.List()
+	if err != nil {
+		t.Fatal("failed to list presets", err)
+	}
+	if len(entries) != len(catalog.Names()) {
+		t.Fatalf("expected %d presets, got: %d", len(catalog.Names()), len(entries))
+	}
+	for _, e := range entries {
+		if e.Title == "" || e.Description == "" {
+			t.Errorf("preset: %s, must have a title and a description", e.Name)
+		}
+		if len(e.Services) == 0 {
+			t.Errorf("preset: %s, has no services", e.Name)
+		}
+		if err := e.Graph().Validate(); err != nil {
+			t.Errorf("preset: %s, is invalid: %v", e.Name, err)
+		}
+	}
+}
+
+func TestGetUnknownPreset(t *testing.T) {
+	if _, err := catalog.Get("not-a-preset"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
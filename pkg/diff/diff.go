@@ -0,0 +1,483 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	FormatText      = "text"
+	FormatJSONPatch = "json-patch"
+	FormatMermaid   = "mermaid"
+)
+
+// FieldChange an attribute which has a different value in both graphs.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type ServiceChange struct {
+	Service string        `json:"service"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// EdgeKey identifies an edge by the names of the services it links.
+type EdgeKey struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type EdgeChange struct {
+	EdgeKey
+	Changes []FieldChange `json:"changes"`
+}
+
+// Diff what changed between 2 graphs, services are matched by their name (or their idx if they have no name)
+// and edges by the services they link.
+type Diff struct {
+	AddedServices   []string        `json:"addedServices,omitempty"`
+	RemovedServices []string        `json:"removedServices,omitempty"`
+	ChangedServices []ServiceChange `json:"changedServices,omitempty"`
+	AddedEdges      []EdgeKey       `json:"addedEdges,omitempty"`
+	RemovedEdges    []EdgeKey       `json:"removedEdges,omitempty"`
+	ChangedEdges    []EdgeChange    `json:"changedEdges,omitempty"`
+	Defaults        []FieldChange   `json:"defaults,omitempty"`
+}
+
+func (d Diff) IsEmpty() bool {
+	return reflect.DeepEqual(d, Diff{})
+}
+
+// Compute computes what changed to go from a graph to another.
+func Compute(from, to apis.ServiceGraph) (Diff, error) {
+	if err := from.Validate(); err != nil {
+		return Diff{}, fmt.Errorf("invalid original graph: %w", err)
+	}
+	if err := to.Validate(); err != nil {
+		return Diff{}, fmt.Errorf("invalid new graph: %w", err)
+	}
+	out := Diff{}
+	out.Defaults = compareDefaults(from.Defaults, to.Defaults)
+
+	fromServices := servicesByName(from)
+	toServices := servicesByName(to)
+	for _, svc := range to.Services {
+		old, exists := fromServices[svc.DisplayName()]
+		if !exists {
+			out.AddedServices = append(out.AddedServices, svc.DisplayName())
+			continue
+		}
+		if changes := compareServices(old, svc); len(changes) > 0 {
+			out.ChangedServices = append(out.ChangedServices, ServiceChange{Service: svc.DisplayName(), Changes: changes})
+		}
+	}
+	for _, svc := range from.Services {
+		if _, exists := toServices[svc.DisplayName()]; !exists {
+			out.RemovedServices = append(out.RemovedServices, svc.DisplayName())
+		}
+	}
+
+	fromEdges := edgesByKey(from)
+	for _, e := range edges(to) {
+		old, exists := fromEdges[e.id]
+		if !exists {
+			out.AddedEdges = append(out.AddedEdges, e.key)
+			continue
+		}
+		delete(fromEdges, e.id)
+		if changes := compareEdges(old.edge, e.edge); len(changes) > 0 {
+			out.ChangedEdges = append(out.ChangedEdges, EdgeChange{EdgeKey: e.key, Changes: changes})
+		}
+	}
+	for _, e := range edges(from) {
+		if _, exists := fromEdges[e.id]; exists {
+			out.RemovedEdges = append(out.RemovedEdges, e.key)
+		}
+	}
+	return out, nil
+}
+
+func servicesByName(graph apis.ServiceGraph) map[string]apis.Service {
+	out := map[string]apis.Service{}
+	for _, svc := range graph.Services {
+		out[svc.DisplayName()] = svc
+	}
+	return out
+}
+
+type namedEdge struct {
+	// id is unique even when there are multiple edges between the same services.
+	id   string
+	key  EdgeKey
+	edge apis.Edge
+}
+
+func edges(graph apis.ServiceGraph) []namedEdge {
+	var out []namedEdge
+	for _, svc := range graph.Services {
+		seen := map[int]int{}
+		for _, e := range svc.Edges {
+			key := EdgeKey{From: svc.DisplayName(), To: graph.Services[e.Target].DisplayName()}
+			out = append(out, namedEdge{id: fmt.Sprintf("%s\x00%s\x00%d", key.From, key.To, seen[e.Target]), key: key, edge: e})
+			seen[e.Target]++
+		}
+	}
+	return out
+}
+
+func edgesByKey(graph apis.ServiceGraph) map[string]namedEdge {
+	out := map[string]namedEdge{}
+	for _, e := range edges(graph) {
+		out[e.id] = e
+	}
+	return out
+}
+
+type fieldChanges []FieldChange
+
+func (c *fieldChanges) compare(field string, from, to interface{}) {
+	if !reflect.DeepEqual(from, to) {
+		*c = append(*c, FieldChange{Field: field, From: from, To: to})
+	}
+}
+
+func compareServices(from, to apis.Service) []FieldChange {
+	var out fieldChanges
+	out.compare("replicas", from.Replicas, to.Replicas)
+	out.compare("role", from.Role, to.Role)
+	out.compare("tier", from.Tier, to.Tier)
+	fromLabels, toLabels := from.Labels, to.Labels
+	if fromLabels == nil {
+		fromLabels = map[string]string{}
+	}
+	if toLabels == nil {
+		toLabels = map[string]string{}
+	}
+	out.compare("labels", fromLabels, toLabels)
+	return out
+}
+
+func compareEdges(from, to apis.Edge) []FieldChange {
+	var out fieldChanges
+	out.compare("protocol", from.GetProtocol(), to.GetProtocol())
+	out.compare("weight", from.GetWeight(), to.GetWeight())
+	out.compare("latencyMs", from.LatencyMs, to.LatencyMs)
+	out.compare("errorRate", from.ErrorRate, to.ErrorRate)
+	out.compare("timeoutMs", from.TimeoutMs, to.TimeoutMs)
+	out.compare("retries", from.Retries, to.Retries)
+	return out
+}
+
+func compareDefaults(from, to *apis.Defaults) []FieldChange {
+	if from == nil {
+		from = &apis.Defaults{}
+	}
+	if to == nil {
+		to = &apis.Defaults{}
+	}
+	var out fieldChanges
+	out.compare("timeoutMs", from.TimeoutMs, to.TimeoutMs)
+	out.compare("retries", from.Retries, to.Retries)
+	out.compare("circuitBreakerErrors", from.CircuitBreakerErrors, to.CircuitBreakerErrors)
+	return out
+}
+
+func formatChanges(changes []FieldChange) string {
+	var out []string
+	for _, c := range changes {
+		out = append(out, fmt.Sprintf("%s %s -> %s", c.Field, formatValue(c.From), formatValue(c.To)))
+	}
+	return strings.Join(out, ", ")
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", val)
+	case map[string]string:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var entries []string
+		for _, k := range keys {
+			entries = append(entries, fmt.Sprintf("%s=%s", k, val[k]))
+		}
+		return "{" + strings.Join(entries, ",") + "}"
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// WriteText writes the diff in a human-readable format: one line per change prefixed with +, - or ~.
+func (d Diff) WriteText(writer io.Writer) error {
+	b := &strings.Builder{}
+	if d.IsEmpty() {
+		b.WriteString("no changes\n")
+	}
+	if len(d.Defaults) > 0 {
+		fmt.Fprintf(b, "~ defaults: %s\n", formatChanges(d.Defaults))
+	}
+	for _, s := range d.AddedServices {
+		fmt.Fprintf(b, "+ service %s\n", s)
+	}
+	for _, s := range d.RemovedServices {
+		fmt.Fprintf(b, "- service %s\n", s)
+	}
+	for _, s := range d.ChangedServices {
+		fmt.Fprintf(b, "~ service %s: %s\n", s.Service, formatChanges(s.Changes))
+	}
+	for _, e := range d.AddedEdges {
+		fmt.Fprintf(b, "+ edge %s -> %s\n", e.From, e.To)
+	}
+	for _, e := range d.RemovedEdges {
+		fmt.Fprintf(b, "- edge %s -> %s\n", e.From, e.To)
+	}
+	for _, e := range d.ChangedEdges {
+		fmt.Fprintf(b, "~ edge %s -> %s: %s\n", e.From, e.To, formatChanges(e.Changes))
+	}
+	_, err := io.WriteString(writer, b.String())
+	return err
+}
+
+// Operation a JSON patch operation (RFC 6902).
+type Operation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+func (o Operation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{Op: o.Op, Path: o.Path})
+	}
+	type operation Operation
+	return json.Marshal(operation(o))
+}
+
+// JSONPatch returns the JSON patch which turns the JSON document of a graph into the one of another.
+// Arrays are compared by position as services and edge targets are identified by their idx.
+func JSONPatch(from, to apis.ServiceGraph) ([]Operation, error) {
+	fromDoc, err := toDocument(from)
+	if err != nil {
+		return nil, err
+	}
+	toDoc, err := toDocument(to)
+	if err != nil {
+		return nil, err
+	}
+	out := []Operation{}
+	patch(&out, "", fromDoc, toDoc)
+	return out, nil
+}
+
+func toDocument(graph apis.ServiceGraph) (interface{}, error) {
+	b, err := json.Marshal(graph)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	return out, json.Unmarshal(b, &out)
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func patch(ops *[]Operation, path string, from, to interface{}) {
+	switch fromVal := from.(type) {
+	case map[string]interface{}:
+		toVal, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+		var keys []string
+		for k := range fromVal {
+			keys = append(keys, k)
+		}
+		for k := range toVal {
+			if _, exists := fromVal[k]; !exists {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			childPath := path + "/" + pointerEscaper.Replace(k)
+			f, inFrom := fromVal[k]
+			t, inTo := toVal[k]
+			switch {
+			case !inTo:
+				*ops = append(*ops, Operation{Op: "remove", Path: childPath})
+			case !inFrom:
+				*ops = append(*ops, Operation{Op: "add", Path: childPath, Value: t})
+			default:
+				patch(ops, childPath, f, t)
+			}
+		}
+		return
+	case []interface{}:
+		toVal, ok := to.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(fromVal) && i < len(toVal); i++ {
+			patch(ops, fmt.Sprintf("%s/%d", path, i), fromVal[i], toVal[i])
+		}
+		// Remove from the end so indexes of the remaining items don't move.
+		for i := len(fromVal) - 1; i >= len(toVal); i-- {
+			*ops = append(*ops, Operation{Op: "remove", Path: fmt.Sprintf("%s/%d", path, i)})
+		}
+		for i := len(fromVal); i < len(toVal); i++ {
+			*ops = append(*ops, Operation{Op: "add", Path: fmt.Sprintf("%s/%d", path, i), Value: toVal[i]})
+		}
+		return
+	}
+	if !reflect.DeepEqual(from, to) {
+		*ops = append(*ops, Operation{Op: "replace", Path: path, Value: to})
+	}
+}
+
+// WriteMermaid writes a mermaid graph containing the services and edges of both graphs,
+// added ones are green, removed ones are red and dashed and changed ones are orange.
+func WriteMermaid(writer io.Writer, from, to apis.ServiceGraph) error {
+	d, err := Compute(from, to)
+	if err != nil {
+		return err
+	}
+	status := map[string]string{}
+	for _, s := range d.AddedServices {
+		status[s] = "added"
+	}
+	for _, s := range d.RemovedServices {
+		status[s] = "removed"
+	}
+	for _, s := range d.ChangedServices {
+		status[s.Service] = "changed"
+	}
+	// Nodes are identified by their position in the union of both graphs as names and idx may differ.
+	ids := map[string]string{}
+	var lines []string
+	addNode := func(svc apis.Service, label string) {
+		id := fmt.Sprintf("s%d", len(ids))
+		ids[svc.DisplayName()] = id
+		lines = append(lines, fmt.Sprintf("\t%s(\"%s\");", id, label))
+	}
+	fromServices := servicesByName(from)
+	for _, svc := range to.Services {
+		replicas := fmt.Sprint(svc.Replicas)
+		if old, exists := fromServices[svc.DisplayName()]; exists && old.Replicas != svc.Replicas {
+			replicas = fmt.Sprintf("%d->%d", old.Replicas, svc.Replicas)
+		}
+		addNode(svc, fmt.Sprintf("%s replicas:%s", svc.DisplayName(), replicas))
+	}
+	for _, name := range d.RemovedServices {
+		svc := fromServices[name]
+		addNode(svc, fmt.Sprintf("%s replicas:%d", name, svc.Replicas))
+	}
+
+	edgeStatus := map[EdgeKey]string{}
+	for _, e := range d.ChangedEdges {
+		edgeStatus[e.EdgeKey] = "changed"
+	}
+	// Edges are added/removed by occurrence so only the last ones between 2 services get the status.
+	added := map[EdgeKey]int{}
+	for _, e := range d.AddedEdges {
+		added[e]++
+	}
+	links := map[string][]string{}
+	linkIdx := 0
+	addLink := func(key EdgeKey, arrow string, st string) {
+		lines = append(lines, fmt.Sprintf("\t%s %s %s;", ids[key.From], arrow, ids[key.To]))
+		if st != "" {
+			links[st] = append(links[st], fmt.Sprint(linkIdx))
+		}
+		linkIdx++
+	}
+	toEdges := edges(to)
+	count := map[EdgeKey]int{}
+	for _, e := range toEdges {
+		count[e.key]++
+	}
+	seen := map[EdgeKey]int{}
+	for _, e := range toEdges {
+		seen[e.key]++
+		st := edgeStatus[e.key]
+		if count[e.key]-seen[e.key] < added[e.key] {
+			st = "added"
+		}
+		addLink(e.key, "-->", st)
+	}
+	for _, e := range d.RemovedEdges {
+		addLink(e, "-.->", "removed")
+	}
+
+	lines = append(lines,
+		"\tclassDef added fill:#dafbe1,stroke:#1a7f37;",
+		"\tclassDef removed fill:#ffebe9,stroke:#cf222e,stroke-dasharray:5 5;",
+		"\tclassDef changed fill:#fff8c5,stroke:#9a6700;",
+	)
+	styles := map[string]string{
+		"added":   "stroke:#1a7f37,stroke-width:2px",
+		"removed": "stroke:#cf222e,stroke-width:2px",
+		"changed": "stroke:#9a6700,stroke-width:2px",
+	}
+	for _, st := range []string{"added", "removed", "changed"} {
+		var nodes []string
+		for name, s := range status {
+			if s == st {
+				nodes = append(nodes, ids[name])
+			}
+		}
+		sort.Strings(nodes)
+		if len(nodes) > 0 {
+			lines = append(lines, fmt.Sprintf("\tclass %s %s;", strings.Join(nodes, ","), st))
+		}
+		if len(links[st]) > 0 {
+			lines = append(lines, fmt.Sprintf("\tlinkStyle %s %s;", strings.Join(links[st], ","), styles[st]))
+		}
+	}
+	_, err = fmt.Fprintf(writer, "graph TD;\n%s\n\n", strings.Join(lines, "\n"))
+	return err
+}
+
+// Write writes the diff between 2 graphs in one of the formats: text, json-patch or mermaid.
+func Write(writer io.Writer, format string, from, to apis.ServiceGraph) error {
+	switch format {
+	case FormatText:
+		d, err := Compute(from, to)
+		if err != nil {
+			return err
+		}
+		return d.WriteText(writer)
+	case FormatJSONPatch:
+		if err := from.Validate(); err != nil {
+			return fmt.Errorf("invalid original graph: %w", err)
+		}
+		if err := to.Validate(); err != nil {
+			return fmt.Errorf("invalid new graph: %w", err)
+		}
+		ops, err := JSONPatch(from, to)
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(ops, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(append(b, '\n'))
+		return err
+	case FormatMermaid:
+		return WriteMermaid(writer, from, to)
+	default:
+		return fmt.Errorf("format '%s' not supported accepted: %s, %s, %s", format, FormatText, FormatJSONPatch, FormatMermaid)
+	}
+}
@@ -0,0 +1,123 @@
+package diff_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/diff"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var from = apis.ServiceGraph{
+	Services: []apis.Service{
+		{Idx: 0, Name: "frontend", Replicas: 1, Edges: []apis.Edge{{Target: 1}, {Target: 2, LatencyMs: 10}}},
+		{Idx: 1, Name: "legacy", Replicas: 1},
+		{Idx: 2, Name: "cart", Replicas: 2},
+	},
+}
+
+var to = apis.ServiceGraph{
+	Defaults: &apis.Defaults{Retries: 2},
+	Services: []apis.Service{
+		{Idx: 0, Name: "frontend", Replicas: 1, Edges: []apis.Edge{{Target: 1, LatencyMs: 20}, {Target: 2}}},
+		{Idx: 1, Name: "cart", Replicas: 3, Tier: "api"},
+		{Idx: 2, Name: "payments", Replicas: 2},
+	},
+}
+
+func TestCompute(t *testing.T) {
+	d, err := diff.Compute(from, to)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	expected := diff.Diff{
+		AddedServices:   []string{"payments"},
+		RemovedServices: []string{"legacy"},
+		ChangedServices: []diff.ServiceChange{{Service: "cart", Changes: []diff.FieldChange{{Field: "replicas", From: 2, To: 3}, {Field: "tier", From: "", To: "api"}}}},
+		AddedEdges:      []diff.EdgeKey{{From: "frontend", To: "payments"}},
+		RemovedEdges:    []diff.EdgeKey{{From: "frontend", To: "legacy"}},
+		ChangedEdges:    []diff.EdgeChange{{EdgeKey: diff.EdgeKey{From: "frontend", To: "cart"}, Changes: []diff.FieldChange{{Field: "latencyMs", From: 10, To: 20}}}},
+		Defaults:        []diff.FieldChange{{Field: "retries", From: 0, To: 2}},
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("unexpected diff: %+v", d)
+	}
+
+	d, err = diff.Compute(from, from)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	if !d.IsEmpty() {
+		t.Errorf("expected no changes got: %+v", d)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, tc := range []struct {
+		format   string
+		expected []string
+	}{
+		{format: diff.FormatText, expected: []string{
+			"~ defaults: retries 0 -> 2\n",
+			"+ service payments\n",
+			"- service legacy\n",
+			"~ service cart: replicas 2 -> 3, tier \"\" -> \"api\"\n",
+			"+ edge frontend -> payments\n",
+			"- edge frontend -> legacy\n",
+			"~ edge frontend -> cart: latencyMs 10 -> 20\n",
+		}},
+		{format: diff.FormatMermaid, expected: []string{
+			"\ts1(\"cart replicas:2->3\");\n",
+			"\ts3(\"legacy replicas:1\");\n",
+			"\ts0 --> s1;\n\ts0 --> s2;\n\ts0 -.-> s3;\n",
+			"\tclass s2 added;\n\tlinkStyle 1 stroke:#1a7f37,stroke-width:2px;\n",
+			"\tclass s3 removed;\n\tlinkStyle 2 stroke:#cf222e,stroke-width:2px;\n",
+			"\tclass s1 changed;\n\tlinkStyle 0 stroke:#9a6700,stroke-width:2px;\n",
+		}},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			if err := diff.Write(&buf, tc.format, from, to); err != nil {
+				t.Fatal("failed", err)
+			}
+			for _, s := range tc.expected {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("expected %q in output:\n%s", s, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	ops, err := diff.JSONPatch(from, to)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	b, err := json.Marshal(ops)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	for _, s := range []string{
+		`{"op":"add","path":"/defaults","value":{"retries":2}}`,
+		`{"op":"replace","path":"/services/0/edges/0","value":{"latencyMs":20,"target":1}}`,
+		`{"op":"replace","path":"/services/0/edges/1","value":2}`,
+		`{"op":"replace","path":"/services/1/name","value":"cart"}`,
+		`{"op":"add","path":"/services/1/tier","value":"api"}`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("expected %s in patch: %s", s, string(b))
+		}
+	}
+
+	ops, err = diff.JSONPatch(to, from)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	b, _ = json.Marshal(ops)
+	if !strings.Contains(string(b), `{"op":"remove","path":"/defaults"}`) {
+		t.Errorf("expected defaults to be removed: %s", string(b))
+	}
+}
@@ -0,0 +1,318 @@
+package evolve
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"math/rand"
+	"strings"
+)
+
+const (
+	MutationAddService = "add-service"
+	MutationRemoveLeaf = "remove-leaf"
+	MutationAddEdge    = "add-edge"
+	MutationRemoveEdge = "remove-edge"
+	MutationRescale    = "rescale"
+)
+
+// AllMutations the mutations used when none are configured.
+var AllMutations = []string{MutationAddService, MutationRemoveLeaf, MutationAddEdge, MutationRemoveEdge, MutationRescale}
+
+type Config struct {
+	// Steps the number of mutations to apply.
+	Steps int
+	// Seed the seed of the random generator.
+	Seed int64
+	// MinReplicas and MaxReplicas the range of replicas of added or rescaled services.
+	MinReplicas int
+	MaxReplicas int
+	// Mutations the mutations to pick from at each step (all if empty).
+	Mutations []string
+	// NamePrefix services without a name are named `<NamePrefix>-<idx>` so they keep their name when other services are removed.
+	NamePrefix string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Steps:       10,
+		MinReplicas: 1,
+		MaxReplicas: 3,
+		NamePrefix:  "svc",
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Steps < 0 {
+		return errors.New("steps can't be negative")
+	}
+	if c.MinReplicas < 0 || c.MaxReplicas < c.MinReplicas {
+		return fmt.Errorf("invalid replicas range: [%d, %d]", c.MinReplicas, c.MaxReplicas)
+	}
+	for _, m := range c.Mutations {
+		switch m {
+		case MutationAddService, MutationRemoveLeaf, MutationAddEdge, MutationRemoveEdge, MutationRescale:
+		default:
+			return fmt.Errorf("mutation '%s' is not supported accepted: %s", m, strings.Join(AllMutations, ", "))
+		}
+	}
+	return nil
+}
+
+// Step a graph of the evolution and the mutation which led to it.
+type Step struct {
+	// Mutation the kind of mutation applied to the previous step (empty for the initial graph).
+	Mutation string
+	// Description what the mutation changed.
+	Description string
+	Graph       apis.ServiceGraph
+}
+
+type evolution struct {
+	conf   Config
+	random *rand.Rand
+	graph  apis.ServiceGraph
+	// next the suffix of the name of the next added service.
+	next int
+}
+
+// Evolve applies conf.Steps seeded mutations to a graph, the graph stays a valid DAG after each one.
+// The first step is the initial graph (with names set on all services) followed by one step per mutation.
+func Evolve(graph apis.ServiceGraph, conf Config) ([]Step, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	if err := graph.Validate(); err != nil {
+		return nil, err
+	}
+	if conf.NamePrefix == "" {
+		conf.NamePrefix = DefaultConfig().NamePrefix
+	}
+	mutations := conf.Mutations
+	if len(mutations) == 0 {
+		mutations = AllMutations
+	}
+	e := &evolution{conf: conf, random: rand.New(rand.NewSource(conf.Seed)), graph: copyGraph(graph)}
+	for i := range e.graph.Services {
+		if e.graph.Services[i].Name == "" {
+			e.next = i
+			e.graph.Services[i].Name = e.newName()
+		}
+	}
+	e.next = len(e.graph.Services)
+	if err := e.graph.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to name services: %w", err)
+	}
+	out := []Step{{Graph: e.snapshot(0)}}
+	for i := 1; i <= conf.Steps; i++ {
+		// Only pick among the mutations which can be applied to the current graph.
+		var candidates []string
+		for _, m := range mutations {
+			if e.applicable(m) {
+				candidates = append(candidates, m)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("no mutation can be applied at step %d", i)
+		}
+		mutation := candidates[e.random.Intn(len(candidates))]
+		description := e.apply(mutation)
+		if err := e.graph.Validate(); err != nil {
+			return nil, fmt.Errorf("mutation %s led to an invalid graph at step %d: %w", mutation, i, err)
+		}
+		out = append(out, Step{Mutation: mutation, Description: description, Graph: e.snapshot(i)})
+	}
+	return out, nil
+}
+
+func copyGraph(graph apis.ServiceGraph) apis.ServiceGraph {
+	out := graph
+	out.Services = make([]apis.Service, len(graph.Services))
+	for i, svc := range graph.Services {
+		svc.Edges = append([]apis.Edge(nil), svc.Edges...)
+		if svc.Labels != nil {
+			labels := map[string]string{}
+			for k, v := range svc.Labels {
+				labels[k] = v
+			}
+			svc.Labels = labels
+		}
+		out.Services[i] = svc
+	}
+	if graph.Defaults != nil {
+		defaults := *graph.Defaults
+		out.Defaults = &defaults
+	}
+	return out
+}
+
+func (e *evolution) snapshot(step int) apis.ServiceGraph {
+	out := copyGraph(e.graph)
+	out.GenerationParams = fmt.Sprintf("%s,evolveSeed:%d,step:%d", e.graph.GenerationParams, e.conf.Seed, step)
+	return out
+}
+
+// newName returns a name which isn't used by any service.
+func (e *evolution) newName() string {
+	used := map[string]bool{}
+	for _, svc := range e.graph.Services {
+		used[svc.Name] = true
+	}
+	for {
+		name := fmt.Sprintf("%s-%03d", e.conf.NamePrefix, e.next)
+		e.next++
+		if !used[name] {
+			return name
+		}
+	}
+}
+
+func (e *evolution) replicas() int {
+	return e.conf.MinReplicas + e.random.Intn(1+e.conf.MaxReplicas-e.conf.MinReplicas)
+}
+
+func (e *evolution) leaves() []int {
+	var out []int
+	for _, svc := range e.graph.Services {
+		if len(svc.Edges) == 0 {
+			out = append(out, svc.Idx)
+		}
+	}
+	return out
+}
+
+type pair struct {
+	from, to int
+}
+
+// edgeCandidates the edges which can be added without creating a duplicate edge or a cycle.
+func (e *evolution) edgeCandidates() []pair {
+	n := len(e.graph.Services)
+	// reaches[a][b] whether b is reachable from a.
+	reaches := make([][]bool, n)
+	var visit func(from, idx int)
+	visit = func(from, idx int) {
+		for _, edge := range e.graph.Services[idx].Edges {
+			if !reaches[from][edge.Target] {
+				reaches[from][edge.Target] = true
+				visit(from, edge.Target)
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		reaches[i] = make([]bool, n)
+		visit(i, i)
+	}
+	var out []pair
+	for a := 0; a < n; a++ {
+		calls := map[int]bool{}
+		for _, edge := range e.graph.Services[a].Edges {
+			calls[edge.Target] = true
+		}
+		for b := 0; b < n; b++ {
+			if a != b && !calls[b] && !reaches[b][a] {
+				out = append(out, pair{from: a, to: b})
+			}
+		}
+	}
+	return out
+}
+
+func (e *evolution) applicable(mutation string) bool {
+	switch mutation {
+	case MutationAddService:
+		return true
+	case MutationRemoveLeaf:
+		// Keep at least one service
+		return len(e.graph.Services) > 1
+	case MutationAddEdge:
+		return len(e.edgeCandidates()) > 0
+	case MutationRemoveEdge:
+		for _, svc := range e.graph.Services {
+			if len(svc.Edges) > 0 {
+				return true
+			}
+		}
+		return false
+	case MutationRescale:
+		return len(e.graph.Services) > 0 && e.conf.MaxReplicas > e.conf.MinReplicas
+	}
+	return false
+}
+
+func (e *evolution) name(idx int) string {
+	return e.graph.Services[idx].Name
+}
+
+// apply applies a mutation and returns its description.
+func (e *evolution) apply(mutation string) string {
+	switch mutation {
+	case MutationAddService:
+		svc := apis.Service{Idx: len(e.graph.Services), Name: e.newName(), Replicas: e.replicas()}
+		e.graph.Services = append(e.graph.Services, svc)
+		if svc.Idx == 0 {
+			return fmt.Sprintf("added %s", svc.Name)
+		}
+		// A new service has no edges so it can be called by any service without creating a cycle.
+		caller := e.random.Intn(svc.Idx)
+		e.graph.Services[caller].Edges = append(e.graph.Services[caller].Edges, apis.Edge{Target: svc.Idx})
+		return fmt.Sprintf("added %s called by %s", svc.Name, e.name(caller))
+	case MutationRemoveLeaf:
+		leaves := e.leaves()
+		removed := leaves[e.random.Intn(len(leaves))]
+		name := e.name(removed)
+		e.removeService(removed)
+		return fmt.Sprintf("removed %s", name)
+	case MutationAddEdge:
+		candidates := e.edgeCandidates()
+		p := candidates[e.random.Intn(len(candidates))]
+		e.graph.Services[p.from].Edges = append(e.graph.Services[p.from].Edges, apis.Edge{Target: p.to})
+		return fmt.Sprintf("added %s -> %s", e.name(p.from), e.name(p.to))
+	case MutationRemoveEdge:
+		var candidates []pair
+		for _, svc := range e.graph.Services {
+			for i := range svc.Edges {
+				candidates = append(candidates, pair{from: svc.Idx, to: i})
+			}
+		}
+		p := candidates[e.random.Intn(len(candidates))]
+		edges := e.graph.Services[p.from].Edges
+		target := edges[p.to].Target
+		e.graph.Services[p.from].Edges = append(edges[:p.to:p.to], edges[p.to+1:]...)
+		return fmt.Sprintf("removed %s -> %s", e.name(p.from), e.name(target))
+	case MutationRescale:
+		idx := e.random.Intn(len(e.graph.Services))
+		old := e.graph.Services[idx].Replicas
+		replicas := old
+		for replicas == old {
+			replicas = e.replicas()
+		}
+		e.graph.Services[idx].Replicas = replicas
+		return fmt.Sprintf("rescaled %s from %d to %d replicas", e.name(idx), old, replicas)
+	}
+	return ""
+}
+
+// removeService removes a service and the edges to it and shifts the idx of the following services.
+func (e *evolution) removeService(removed int) {
+	var services []apis.Service
+	for _, svc := range e.graph.Services {
+		if svc.Idx == removed {
+			continue
+		}
+		var edges []apis.Edge
+		for _, edge := range svc.Edges {
+			if edge.Target == removed {
+				continue
+			}
+			if edge.Target > removed {
+				edge.Target--
+			}
+			edges = append(edges, edge)
+		}
+		svc.Edges = edges
+		svc.Idx = len(services)
+		services = append(services, svc)
+	}
+	e.graph.Services = services
+}
@@ -0,0 +1,88 @@
+package evolve_test
+
+import (
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/evolve"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvolve(t *testing.T) {
+	graph := apis.GenerateRandomMesh(42, 5, 50, 1, 2)
+	conf := evolve.DefaultConfig()
+	conf.Steps = 100
+	conf.Seed = 3
+	steps, err := evolve.Evolve(graph, conf)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	if len(steps) != 101 {
+		t.Fatalf("expected the initial graph and 100 steps got: %d", len(steps))
+	}
+	if steps[0].Mutation != "" || steps[0].Graph.Services[3].Name != "svc-003" {
+		t.Errorf("unexpected initial step: %+v", steps[0])
+	}
+	seen := map[string]bool{}
+	for i, step := range steps {
+		if err := step.Graph.Validate(); err != nil {
+			t.Errorf("step %d is invalid: %s", i, err)
+		}
+		if !strings.HasSuffix(step.Graph.GenerationParams, fmt.Sprintf(",evolveSeed:3,step:%d", i)) {
+			t.Errorf("unexpected generation params: %s", step.Graph.GenerationParams)
+		}
+		if i > 0 && step.Description == "" {
+			t.Errorf("step %d has no description", i)
+		}
+		seen[step.Mutation] = true
+	}
+	for _, m := range evolve.AllMutations {
+		if !seen[m] {
+			t.Errorf("mutation %s never picked", m)
+		}
+	}
+	// The input graph is left untouched
+	if graph.Services[0].Name != "" {
+		t.Errorf("input graph was modified")
+	}
+
+	again, err := evolve.Evolve(graph, conf)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	if !reflect.DeepEqual(steps, again) {
+		t.Errorf("evolution isn't reproducible")
+	}
+}
+
+func TestEvolveMutations(t *testing.T) {
+	graph := apis.ServiceGraph{Services: []apis.Service{
+		{Idx: 0, Name: "frontend", Replicas: 1, Edges: apis.EdgesTo(1)},
+		{Idx: 1, Replicas: 1, Edges: apis.EdgesTo(2)},
+		{Idx: 2, Replicas: 1},
+	}}
+	conf := evolve.DefaultConfig()
+	conf.Steps = 2
+	conf.Mutations = []string{evolve.MutationRemoveLeaf}
+	steps, err := evolve.Evolve(graph, conf)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	if steps[1].Description != "removed svc-002" || steps[2].Description != "removed svc-001" {
+		t.Errorf("unexpected steps: %+v", steps)
+	}
+	if !reflect.DeepEqual(steps[2].Graph.Services, []apis.Service{{Idx: 0, Name: "frontend", Replicas: 1}}) {
+		t.Errorf("unexpected graph: %+v", steps[2].Graph)
+	}
+
+	conf.Steps = 3
+	if _, err := evolve.Evolve(graph, conf); err == nil || err.Error() != "no mutation can be applied at step 3" {
+		t.Errorf("expected an error got: %v", err)
+	}
+
+	conf.Mutations = []string{"unknown"}
+	if _, err := evolve.Evolve(graph, conf); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,52 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// File a file of an output which spans multiple files (a Helm chart for example), Path is relative to the root of the output.
+type File struct {
+	Path    string
+	Content []byte
+}
+
+// WriteDir writes all the files inside dir creating the intermediate directories.
+func WriteDir(dir string, files []File) error {
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, f.Content, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTarGz writes all the files in a gzipped tarball.
+func WriteTarGz(writer io.Writer, files []File) error {
+	gz := gzip.NewWriter(writer)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     f.Path,
+			Mode:     0o644,
+			Size:     int64(len(f.Content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,162 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"io"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"path"
+	"sigs.k8s.io/yaml"
+	"sort"
+)
+
+// Generator outputs a docker-compose file with one container per service.
+// It reuses the k8s generator of an app (api-play or fake-service) and translates its pod template and config maps,
+// replicas are ignored as each service has its port published on the host.
+type Generator struct {
+	k8s          k8s.Generator
+	hostPortBase int
+}
+
+type Option interface {
+	Apply(g *Generator) error
+}
+
+type OptionFn func(g *Generator) error
+
+func (f OptionFn) Apply(g *Generator) error {
+	return f(g)
+}
+
+// WithHostPortBase the port published on the host for service `idx` is `base + idx` (defaults to the port of the app).
+func WithHostPortBase(base int) Option {
+	return OptionFn(func(g *Generator) error {
+		if base <= 0 || base > 65535 {
+			return fmt.Errorf("invalid host port base: %d", base)
+		}
+		g.hostPortBase = base
+		return nil
+	})
+}
+
+// NewGenerator creates a docker-compose generator from the options of k8s.NewGenerator.
+func NewGenerator(k8sOpts []k8s.Option, opts ...Option) (*Generator, error) {
+	k8sGenerator, err := k8s.NewGenerator(k8sOpts...)
+	if err != nil {
+		return nil, err
+	}
+	g := &Generator{
+		k8s:          k8sGenerator,
+		hostPortBase: k8sGenerator.Settings.Port,
+	}
+	for _, o := range opts {
+		if err := o.Apply(g); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func (g *Generator) Apply(writer io.Writer, graph apis.ServiceGraph) error {
+	workloadGenerator := g.k8s.WorkloadGenerator
+	if wg, ok := workloadGenerator.(k8s.GraphAwareWorkloadGenerator); ok {
+		workloadGenerator = wg.ForGraph(graph)
+	}
+	formatters := g.k8s.Settings.Formatters.ForGraph(graph)
+	services := map[string]interface{}{}
+	configs := map[string]interface{}{}
+	for _, svc := range graph.Services {
+		name := formatters.Name(svc.Idx)
+		objs, _, err := workloadGenerator.Apply(svc)
+		if err != nil {
+			return err
+		}
+		var podSpec *v1.PodSpec
+		configMaps := map[string]map[string]string{}
+		for _, obj := range objs {
+			switch o := obj.(type) {
+			case *appsv1.Deployment:
+				podSpec = &o.Spec.Template.Spec
+			case *appsv1.StatefulSet:
+				podSpec = &o.Spec.Template.Spec
+			case *v1.ConfigMap:
+				configMaps[o.Name] = o.Data
+			}
+		}
+		if podSpec == nil || len(podSpec.Containers) == 0 {
+			return errors.New("no workload generated for service")
+		}
+		container := podSpec.Containers[0]
+		service := map[string]interface{}{
+			"image":    container.Image,
+			"hostname": name,
+			"ports":    []string{fmt.Sprintf("%d:%d", g.hostPortBase+svc.Idx, g.k8s.Settings.Port)},
+		}
+		if len(container.Args) > 0 {
+			service["command"] = container.Args
+		}
+		if len(container.Env) > 0 {
+			env := map[string]string{}
+			for _, e := range container.Env {
+				env[e.Name] = e.Value
+			}
+			service["environment"] = env
+		}
+		// Files from config maps are added as configs with inline content.
+		var serviceConfigs []interface{}
+		for _, mount := range container.VolumeMounts {
+			for _, volume := range podSpec.Volumes {
+				if volume.Name != mount.Name || volume.ConfigMap == nil {
+					continue
+				}
+				data := configMaps[volume.ConfigMap.Name]
+				keys := make([]string, 0, len(data))
+				for k := range data {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					if data[k] == "" {
+						continue
+					}
+					configName := fmt.Sprintf("%s-%s", volume.ConfigMap.Name, k)
+					configs[configName] = map[string]string{"content": data[k]}
+					serviceConfigs = append(serviceConfigs, map[string]string{"source": configName, "target": path.Join(mount.MountPath, k)})
+				}
+			}
+		}
+		if len(serviceConfigs) > 0 {
+			service["configs"] = serviceConfigs
+		}
+		var dependsOn []string
+		seen := map[int]bool{}
+		for _, e := range svc.Edges {
+			if !seen[e.Target] {
+				seen[e.Target] = true
+				dependsOn = append(dependsOn, formatters.Name(e.Target))
+			}
+		}
+		if len(dependsOn) > 0 {
+			service["depends_on"] = dependsOn
+		}
+		services[name] = service
+	}
+	out := map[string]interface{}{
+		"services": services,
+	}
+	if g.k8s.Settings.Namespace != "" {
+		out["name"] = g.k8s.Settings.Namespace
+	}
+	if len(configs) > 0 {
+		out["configs"] = configs
+	}
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(b)
+	return err
+}
@@ -0,0 +1,71 @@
+package compose_test
+
+import (
+	"bytes"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/compose"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/fakeservice"
+	"strings"
+	"testing"
+)
+
+var graph = apis.ServiceGraph{
+	Services: []apis.Service{
+		{Replicas: 2, Edges: apis.EdgesTo(1, 2), Idx: 0, Name: "frontend"},
+		{Replicas: 2, Edges: apis.EdgesTo(2), Idx: 1},
+		{Replicas: 2, Idx: 2},
+	},
+}
+
+func TestApiPlay(t *testing.T) {
+	generator, err := compose.NewGenerator(append(apiplay.GeneratorOpts(), k8s.WithNamespace("foo")))
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := generator.Apply(buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"name: foo",
+		"  frontend:\n    command:\n    - -config-file\n    - /etc/config/config.yaml\n",
+		"    depends_on:\n    - api-play-001\n    - api-play-002\n",
+		"    - 8080:8080\n",
+		"    - 8082:8080\n",
+		"source: frontend-config.yaml",
+		"target: /etc/config/config.yaml",
+		"http://api-play-001:8080/api/dynamic/microservice_mesh",
+		"image: ghcr.io/lahabana/api-play:main",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+	println(out)
+}
+
+func TestFakeService(t *testing.T) {
+	generator, err := compose.NewGenerator(fakeservice.GeneratorOpts(), compose.WithHostPortBase(10000))
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := generator.Apply(buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"UPSTREAM_URIS: http://fake-service-001:9090,http://fake-service-002:9090",
+		"    - 10001:9090\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+	if strings.Contains(out, "configs:") {
+		t.Errorf("fake-service has no config files")
+	}
+}
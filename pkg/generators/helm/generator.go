@@ -0,0 +1,200 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/archive"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"io"
+	"k8s.io/apimachinery/pkg/runtime"
+	"path"
+	"regexp"
+	"sigs.k8s.io/yaml"
+	"strconv"
+	"strings"
+)
+
+// The manifests are generated with these placeholders which are then replaced by references to values.
+// They are chosen to not collide with anything else in the manifests so they are replaced wherever they appear
+// (e.g. the port is also part of names like the Kuma service refs `<name>_<namespace>_svc_<port>`).
+const (
+	namespacePlaceholder = "helm-placeholder-namespace"
+	imagePlaceholder     = "helm-placeholder-image"
+	portPlaceholder      = 61999
+	replicasPlaceholder  = "HELM_PLACEHOLDER_REPLICAS"
+	resourcesPlaceholder = "HELM_PLACEHOLDER_RESOURCES"
+)
+
+var resourcesRegexp = regexp.MustCompile(fmt.Sprintf(`(?m)^( *)resources: %s$`, resourcesPlaceholder))
+
+// Generator outputs a Helm chart where the image, port, namespace, replicas and resources are values.
+type Generator struct {
+	// Name the name of the chart.
+	Name string
+	// Version the version of the chart.
+	Version string
+	// Annotations are added to the Chart.yaml.
+	Annotations map[string]string
+
+	settings  k8s.Settings
+	templates k8s.Generator
+}
+
+// NewGenerator creates a generator of Helm chart, the options are the same as the ones of k8s.NewGenerator.
+func NewGenerator(name string, opts ...k8s.Option) (*Generator, error) {
+	defaults, err := k8s.NewGenerator(opts...)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := k8s.NewGenerator(append(opts,
+		k8s.WithNamespace(namespacePlaceholder),
+		k8s.WithImage(imagePlaceholder),
+		k8s.WithPort(portPlaceholder),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{
+		Name:      name,
+		Version:   "0.1.0",
+		settings:  defaults.Settings,
+		templates: templates,
+	}, nil
+}
+
+// Apply writes the chart as a .tgz (like `helm package` does).
+func (g *Generator) Apply(writer io.Writer, graph apis.ServiceGraph) error {
+	files, err := g.Files(graph)
+	if err != nil {
+		return err
+	}
+	return archive.WriteTarGz(writer, files)
+}
+
+// WriteDir writes the chart in a directory named after the chart inside dir (like `helm create` does).
+func (g *Generator) WriteDir(dir string, graph apis.ServiceGraph) error {
+	files, err := g.Files(graph)
+	if err != nil {
+		return err
+	}
+	return archive.WriteDir(dir, files)
+}
+
+// Files returns all the files of the chart, their path starts with the name of the chart.
+func (g *Generator) Files(graph apis.ServiceGraph) ([]archive.File, error) {
+	values := map[string]interface{}{
+		"namespace": g.settings.Namespace,
+		"image":     g.settings.Image,
+		"port":      g.settings.Port,
+	}
+	var templates []archive.File
+	objs, raw, err := g.templates.CommonSetup.Generate(graph)
+	if err != nil {
+		return nil, err
+	}
+	content, err := g.template(values, "", raw, objs)
+	if err != nil {
+		return nil, err
+	}
+	templates = append(templates, archive.File{Path: "common.yaml", Content: content})
+
+	services := map[string]interface{}{}
+	var workloadGenerator k8s.WorkloadGenerator = g.templates.WorkloadGenerator
+	if wg, ok := workloadGenerator.(k8s.GraphAwareWorkloadGenerator); ok {
+		workloadGenerator = wg.ForGraph(graph)
+	}
+	formatters := g.settings.Formatters.ForGraph(graph)
+	for _, svc := range graph.Services {
+		name := formatters.Name(svc.Idx)
+		services[name] = map[string]interface{}{"replicas": svc.Replicas}
+		objs, raw, err := workloadGenerator.Apply(svc)
+		if err != nil {
+			return nil, err
+		}
+		content, err := g.template(values, name, raw, objs)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, archive.File{Path: name + ".yaml", Content: content})
+	}
+	values["services"] = services
+
+	chart := map[string]interface{}{
+		"apiVersion":  "v2",
+		"name":        g.Name,
+		"description": fmt.Sprintf("A mesh of %d services", len(graph.Services)),
+		"type":        "application",
+		"version":     g.Version,
+	}
+	annotations := map[string]string{}
+	for k, v := range g.Annotations {
+		annotations[k] = v
+	}
+	if graph.GenerationParams != "" {
+		annotations["generationParameters"] = graph.GenerationParams
+	}
+	if len(annotations) > 0 {
+		chart["annotations"] = annotations
+	}
+	chartContent, err := yaml.Marshal(chart)
+	if err != nil {
+		return nil, err
+	}
+	valuesContent, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	out := []archive.File{
+		{Path: path.Join(g.Name, "Chart.yaml"), Content: chartContent},
+		{Path: path.Join(g.Name, "values.yaml"), Content: valuesContent},
+	}
+	for _, t := range templates {
+		out = append(out, archive.File{Path: path.Join(g.Name, "templates", t.Path), Content: t.Content})
+	}
+	return out, nil
+}
+
+// template encodes the objects and replaces the placeholders by references to values.
+// It also sets the default values for resources as they are not configurable on the k8s generator.
+func (g *Generator) template(values map[string]interface{}, name string, raw []byte, objs []runtime.Object) ([]byte, error) {
+	buf := bytes.NewBuffer(raw)
+	for _, obj := range objs {
+		b := bytes.Buffer{}
+		if err := g.templates.Encode(&b, obj); err != nil {
+			return nil, err
+		}
+		doc := map[string]interface{}{}
+		if err := yaml.Unmarshal(b.Bytes(), &doc); err != nil {
+			return nil, err
+		}
+		if kind := doc["kind"]; kind == "Deployment" || kind == "StatefulSet" {
+			spec := doc["spec"].(map[string]interface{})
+			spec["replicas"] = replicasPlaceholder
+			podSpec := spec["template"].(map[string]interface{})["spec"].(map[string]interface{})
+			for _, c := range podSpec["containers"].([]interface{}) {
+				container := c.(map[string]interface{})
+				if _, exists := values["resources"]; !exists {
+					values["resources"] = container["resources"]
+				}
+				container["resources"] = resourcesPlaceholder
+			}
+		}
+		res, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("---\n")
+		buf.Write(res)
+	}
+	out := buf.String()
+	out = strings.ReplaceAll(out, namespacePlaceholder, "{{ .Values.namespace }}")
+	out = strings.ReplaceAll(out, imagePlaceholder, "{{ .Values.image }}")
+	out = strings.ReplaceAll(out, strconv.Itoa(portPlaceholder), "{{ .Values.port }}")
+	out = strings.ReplaceAll(out, replicasPlaceholder, fmt.Sprintf(`{{ (index .Values.services "%s").replicas }}`, name))
+	out = resourcesRegexp.ReplaceAllStringFunc(out, func(s string) string {
+		indent := len(s) - len(strings.TrimLeft(s, " "))
+		return fmt.Sprintf("%sresources: {{- toYaml .Values.resources | nindent %d }}", s[:indent], indent+2)
+	})
+	return []byte(out), nil
+}
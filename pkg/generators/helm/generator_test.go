@@ -0,0 +1,132 @@
+package helm_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/helm"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/istio"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/kuma"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/linkerd"
+	"io"
+	"strings"
+	"testing"
+)
+
+var graph = apis.ServiceGraph{
+	Services: []apis.Service{
+		{Replicas: 2, Edges: apis.EdgesTo(1, 2), Idx: 0, Name: "frontend"},
+		{Replicas: 3, Edges: apis.EdgesTo(2), Idx: 1},
+		{Replicas: 1, Idx: 2},
+	},
+}
+
+func TestFiles(t *testing.T) {
+	generator, err := helm.NewGenerator("foo", append(apiplay.GeneratorOpts(), k8s.WithNamespace("foo"), k8s.WithNetworkPolicies())...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	files, err := generator.Files(graph)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	contents := map[string]string{}
+	for _, f := range files {
+		contents[f.Path] = string(f.Content)
+	}
+	for path, expected := range map[string][]string{
+		"foo/Chart.yaml":                  {"apiVersion: v2", "name: foo", "version: 0.1.0"},
+		"foo/values.yaml":                 {"namespace: foo", "image: ghcr.io/lahabana/api-play:main", "port: 8080", "  api-play-001:\n    replicas: 3\n", "  frontend:\n    replicas: 2\n", "    cpu: 100m"},
+		"foo/templates/common.yaml":       {"name: {{ .Values.namespace }}", "- port: {{ .Values.port }}"},
+		"foo/templates/frontend.yaml":     {`replicas: {{ (index .Values.services "frontend").replicas }}`, "image: {{ .Values.image }}", "resources: {{- toYaml .Values.resources | nindent 10 }}", "namespace: {{ .Values.namespace }}"},
+		"foo/templates/api-play-001.yaml": {`replicas: {{ (index .Values.services "api-play-001").replicas }}`},
+		"foo/templates/api-play-002.yaml": {"port: {{ .Values.port }}"},
+	} {
+		content, exists := contents[path]
+		if !exists {
+			t.Errorf("missing file: %s", path)
+			continue
+		}
+		for _, e := range expected {
+			if !strings.Contains(content, e) {
+				t.Errorf("expected %s to contain '%s' got:\n%s", path, e, content)
+			}
+		}
+		if strings.Contains(content, "placeholder") || strings.Contains(content, "PLACEHOLDER") || strings.Contains(content, "61999") {
+			t.Errorf("%s has placeholders left:\n%s", path, content)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	generator, err := helm.NewGenerator("foo", apiplay.GeneratorOpts()...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.Buffer{}
+	if err := generator.Apply(&buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("failed", err)
+		}
+		names = append(names, h.Name)
+	}
+	if len(names) != 6 || names[0] != "foo/Chart.yaml" {
+		t.Errorf("unexpected files in archive: %v", names)
+	}
+}
+
+func TestMeshes(t *testing.T) {
+	for name, opts := range map[string][]k8s.Option{
+		"kuma":    kuma.GeneratorOpts(kuma.DefaultConfig()),
+		"istio":   istio.GeneratorOpts(istio.DefaultConfig()),
+		"linkerd": linkerd.GeneratorOpts(linkerd.DefaultConfig()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			generator, err := helm.NewGenerator("foo", append(apiplay.GeneratorOpts(), opts...)...)
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			files, err := generator.Files(graph)
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			for _, f := range files {
+				content := string(f.Content)
+				if strings.Contains(content, "placeholder") || strings.Contains(content, "PLACEHOLDER") || strings.Contains(content, "61999") {
+					t.Errorf("%s has placeholders left:\n%s", f.Path, content)
+				}
+			}
+		})
+	}
+	t.Run("kuma service refs", func(t *testing.T) {
+		generator, err := helm.NewGenerator("foo", append(apiplay.GeneratorOpts(), kuma.GeneratorOpts(kuma.DefaultConfig())...)...)
+		if err != nil {
+			t.Fatal("failed", err)
+		}
+		files, err := generator.Files(graph)
+		if err != nil {
+			t.Fatal("failed", err)
+		}
+		for _, f := range files {
+			if f.Path == "foo/templates/common.yaml" && !strings.Contains(string(f.Content), "name: frontend_{{ .Values.namespace }}_svc_{{ .Values.port }}") {
+				t.Errorf("expected service refs to use values got:\n%s", f.Content)
+			}
+		}
+	})
+}
@@ -25,12 +25,27 @@ func podTemplateMutator(f k8s.Formatters, svc apis.Service, template *v1.PodTemp
 
 func configMapGenerator(port int) func(formatters k8s.Formatters, svc apis.Service) (string, error) {
 	return func(formatters k8s.Formatters, svc apis.Service) (string, error) {
-		calls := []map[string]string{}
-		for _, s := range svc.Edges {
-			calls = append(calls, map[string]string{
-				"url": formatters.Url(s, port) + "/api/dynamic/microservice_mesh",
-			})
-
+		calls := []map[string]interface{}{}
+		for _, e := range svc.Edges {
+			call := map[string]interface{}{
+				"url": formatters.Url(e.Target, port) + "/api/dynamic/microservice_mesh",
+			}
+			if e.LatencyMs > 0 {
+				call["latency_millis"] = e.LatencyMs
+			}
+			if e.ErrorRate > 0 {
+				call["error_rate"] = e.ErrorRate
+			}
+			if e.TimeoutMs > 0 {
+				call["timeout_millis"] = e.TimeoutMs
+			}
+			if e.Retries > 0 {
+				call["retries"] = e.Retries
+			}
+			// Calls are repeated to respect the weight of the edge
+			for i := 0; i < e.GetWeight(); i++ {
+				calls = append(calls, call)
+			}
 		}
 		res, err := json.MarshalIndent(map[string][]map[string]interface{}{
 			"apis": {
@@ -5,6 +5,7 @@ import (
 	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
+	"strings"
 	"testing"
 )
 
@@ -18,14 +19,29 @@ func TestSimple(t *testing.T) {
 	buf := bytes.NewBuffer([]byte{})
 	err = encoder.Apply(buf, apis.ServiceGraph{
 		Services: []apis.Service{
-			{Replicas: 2, Edges: []int{1, 2}, Idx: 0},
-			{Replicas: 2, Edges: []int{2}, Idx: 1},
-			{Replicas: 2, Edges: []int{3}, Idx: 2},
-			{Replicas: 2, Edges: []int{}, Idx: 3},
+			{Replicas: 2, Edges: apis.EdgesTo(1, 2), Idx: 0},
+			{Replicas: 2, Edges: []apis.Edge{{Target: 2, Weight: 2, LatencyMs: 10, ErrorRate: 0.1, TimeoutMs: 200, Retries: 1}}, Idx: 1},
+			{Replicas: 2, Edges: apis.EdgesTo(3), Idx: 2},
+			{Replicas: 2, Edges: apis.EdgesTo(), Idx: 3},
 		},
 	})
 	if err != nil {
 		t.Error("failed", err)
 	}
-	println(buf.String())
+	out := buf.String()
+	// Each call of the edge has its attributes.
+	call := `              {
+                "error_rate": 0.1,
+                "latency_millis": 10,
+                "retries": 1,
+                "timeout_millis": 200,
+                "url": "http://api-play-002:8080/api/dynamic/microservice_mesh"
+              }`
+	if got := strings.Count(out, call); got != 2 {
+		t.Errorf("expected 2 calls with attributes got %d in:\n%s", got, out)
+	}
+	if !strings.Contains(out, `                "url": "http://api-play-001:8080/api/dynamic/microservice_mesh"
+              },`) {
+		t.Errorf("expected calls without attributes to only have a url got:\n%s", out)
+	}
 }
@@ -14,6 +14,8 @@ type Generator struct {
 	CommonSetup       CommonSetup
 	WorkloadGenerator WorkloadGenerator
 	Serializer        *json.Serializer
+	// Settings what the generated workloads use (namespace, port...).
+	Settings Settings
 }
 
 var DefaultSerializer = json.NewSerializerWithOptions(json.DefaultMetaFactory, nil, nil, json.SerializerOptions{Yaml: true, Pretty: true, Strict: true})
@@ -27,26 +29,31 @@ func (e Generator) Apply(writer io.Writer, svc apis.ServiceGraph) error {
 		if _, err := writer.Write(raw); err != nil {
 			return err
 		}
-		if err := e.encode(writer, objs...); err != nil {
+		if err := e.Encode(writer, objs...); err != nil {
 			return err
 		}
 	}
+	workloadGenerator := e.WorkloadGenerator
+	if g, ok := workloadGenerator.(GraphAwareWorkloadGenerator); ok {
+		workloadGenerator = g.ForGraph(svc)
+	}
 	for _, s := range svc.Services {
-		objs, raw, err := e.WorkloadGenerator.Apply(s)
+		objs, raw, err := workloadGenerator.Apply(s)
 		if err != nil {
 			return &ServiceGeneratorError{idx: s.Idx, err: err}
 		}
 		if _, err := writer.Write(raw); err != nil {
 			return err
 		}
-		if err := e.encode(writer, objs...); err != nil {
+		if err := e.Encode(writer, objs...); err != nil {
 			return &ServiceGeneratorError{idx: s.Idx, err: err}
 		}
 	}
 	return nil
 }
 
-func (e Generator) encode(writer io.Writer, inputs ...runtime.Object) error {
+// Encode writes the objects as a multi-document yaml.
+func (e Generator) Encode(writer io.Writer, inputs ...runtime.Object) error {
 	for _, in := range inputs {
 		_, err := writer.Write([]byte("---\n"))
 		if err != nil {
@@ -89,6 +96,12 @@ type WorkloadGenerator interface {
 	Apply(svc apis.Service) ([]runtime.Object, []byte, error)
 }
 
+// GraphAwareWorkloadGenerator is a WorkloadGenerator which needs to know about the whole graph (to resolve names of other services for example).
+type GraphAwareWorkloadGenerator interface {
+	WorkloadGenerator
+	ForGraph(graph apis.ServiceGraph) WorkloadGenerator
+}
+
 type WorkloadGeneratorFn func(svc apis.Service) ([]runtime.Object, []byte, error)
 
 func (f WorkloadGeneratorFn) Apply(svc apis.Service) ([]runtime.Object, []byte, error) {
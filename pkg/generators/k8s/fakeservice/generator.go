@@ -1,12 +1,26 @@
 package fakeservice
 
 import (
+	"errors"
+	"fmt"
 	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
 	v1 "k8s.io/api/core/v1"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// ErrUnsupportedEdge is returned when the attributes of the edges of a service can't be mapped to fake-service.
+var ErrUnsupportedEdge = errors.New("edge not supported by fake-service")
+
+// GeneratorOpts generates fake-service workloads, the attributes of the edges are mapped to env vars of the caller:
+//   - the timeout becomes HTTP_CLIENT_REQUEST_TIMEOUT which applies to all upstreams so all edges must have the same timeout,
+//   - the latency becomes TIMING_50_PERCENTILE and the error rate ERROR_RATE of the caller itself,
+//     so they can only be set when the service has a single edge (the latency is multiplied and the error rate compounded by its weight),
+//   - retries are not supported by fake-service.
+//
+// Generation fails with ErrUnsupportedEdge when an edge has attributes which can't be mapped without changing the behaviour of the mesh.
 func GeneratorOpts() []k8s.Option {
 	return []k8s.Option{
 		k8s.WithPort(9090),
@@ -18,18 +32,59 @@ func GeneratorOpts() []k8s.Option {
 
 func mutatePodTemplate(formatters k8s.Formatters, svc apis.Service, template *v1.PodTemplateSpec) error {
 	var uris []string
-	for _, v := range svc.Edges {
-		uris = append(uris, formatters.Url(v, 9090))
+	var timeout, latency int
+	successRate := 1.0
+	for i, e := range svc.Edges {
+		uri := formatters.Url(e.Target, 9090)
+		if e.GetProtocol() == apis.ProtocolGRPC {
+			uri = "grpc://" + strings.TrimPrefix(uri, "http://")
+		}
+		if e.Retries > 0 {
+			return fmt.Errorf("%w: service %s has retries on its edge to %d", ErrUnsupportedEdge, formatters.Name(svc.Idx), e.Target)
+		}
+		if i > 0 && e.TimeoutMs != timeout {
+			return fmt.Errorf("%w: service %s has edges with different timeouts (there's a single timeout for all upstreams)", ErrUnsupportedEdge, formatters.Name(svc.Idx))
+		}
+		timeout = e.TimeoutMs
+		// fake-service can't inject latency or errors on a single upstream so they are added to the caller itself.
+		if (e.LatencyMs > 0 || e.ErrorRate > 0) && len(svc.Edges) > 1 {
+			return fmt.Errorf("%w: service %s has latency or errors on one of its multiple edges (they can only be injected on services with a single edge)", ErrUnsupportedEdge, formatters.Name(svc.Idx))
+		}
+		latency += e.LatencyMs * e.GetWeight()
+		// Upstreams are repeated to respect the weight of the edge
+		for i := 0; i < e.GetWeight(); i++ {
+			uris = append(uris, uri)
+			successRate *= 1 - e.ErrorRate
+		}
 	}
-	template.Spec.Containers[0].Env = append(template.Spec.Containers[0].Env,
-		v1.EnvVar{
+	env := []v1.EnvVar{
+		{
 			Name:  "SERVICE",
 			Value: formatters.Name(svc.Idx),
 		},
-		v1.EnvVar{
+		{
 			Name:  "UPSTREAM_URIS",
 			Value: strings.Join(uris, ","),
 		},
-	)
+	}
+	if timeout > 0 {
+		env = append(env, v1.EnvVar{
+			Name:  "HTTP_CLIENT_REQUEST_TIMEOUT",
+			Value: (time.Duration(timeout) * time.Millisecond).String(),
+		})
+	}
+	if latency > 0 {
+		env = append(env, v1.EnvVar{
+			Name:  "TIMING_50_PERCENTILE",
+			Value: fmt.Sprintf("%dms", latency),
+		})
+	}
+	if successRate < 1 {
+		env = append(env, v1.EnvVar{
+			Name:  "ERROR_RATE",
+			Value: strconv.FormatFloat(1-successRate, 'f', 4, 64),
+		})
+	}
+	template.Spec.Containers[0].Env = append(template.Spec.Containers[0].Env, env...)
 	return nil
 }
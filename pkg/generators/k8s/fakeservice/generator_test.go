@@ -2,9 +2,11 @@ package fakeservice_test
 
 import (
 	"bytes"
+	"errors"
 	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/fakeservice"
+	"strings"
 	"testing"
 )
 
@@ -18,14 +20,47 @@ func TestSimple(t *testing.T) {
 	buf := bytes.NewBuffer([]byte{})
 	err = encoder.Apply(buf, apis.ServiceGraph{
 		Services: []apis.Service{
-			{Replicas: 2, Edges: []int{1, 2}, Idx: 0},
-			{Replicas: 2, Edges: []int{2}, Idx: 1},
-			{Replicas: 2, Edges: []int{3}, Idx: 2},
-			{Replicas: 2, Edges: []int{}, Idx: 3},
+			{Replicas: 2, Edges: []apis.Edge{{Target: 1, TimeoutMs: 300}, {Target: 2, Protocol: apis.ProtocolGRPC, TimeoutMs: 300}}, Idx: 0},
+			{Replicas: 2, Edges: []apis.Edge{{Target: 2, Weight: 2, LatencyMs: 10, ErrorRate: 0.1, TimeoutMs: 200}}, Idx: 1},
+			{Replicas: 2, Edges: apis.EdgesTo(3), Idx: 2},
+			{Replicas: 2, Edges: apis.EdgesTo(), Idx: 3},
 		},
 	})
 	if err != nil {
 		t.Error("failed", err)
 	}
-	println(buf.String())
+	out := buf.String()
+	for _, expected := range []string{
+		"- name: UPSTREAM_URIS\n          value: http://fake-service-001:9090,grpc://fake-service-002:9090\n        - name: HTTP_CLIENT_REQUEST_TIMEOUT\n          value: 300ms\n",
+		// The latency and the error rate of the edge are on its caller multiplied by the weight.
+		"- name: UPSTREAM_URIS\n          value: http://fake-service-002:9090,http://fake-service-002:9090\n        - name: HTTP_CLIENT_REQUEST_TIMEOUT\n          value: 200ms\n        - name: TIMING_50_PERCENTILE\n          value: 20ms\n        - name: ERROR_RATE\n          value: \"0.1900\"\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s' got:\n%s", expected, out)
+		}
+	}
+}
+
+func TestUnsupportedEdges(t *testing.T) {
+	encoder, err := k8s.NewGenerator(fakeservice.GeneratorOpts()...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	for name, edges := range map[string][]apis.Edge{
+		"retries":                     {{Target: 1, Retries: 1}},
+		"different timeouts":          {{Target: 1, TimeoutMs: 100}, {Target: 2}},
+		"latency with multiple edges": {{Target: 1, LatencyMs: 10}, {Target: 2}},
+		"errors with multiple edges":  {{Target: 1}, {Target: 2, ErrorRate: 0.5}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := encoder.Apply(bytes.NewBuffer(nil), apis.ServiceGraph{Services: []apis.Service{
+				{Replicas: 1, Edges: edges, Idx: 0},
+				{Replicas: 1, Idx: 1},
+				{Replicas: 1, Idx: 2},
+			}})
+			if !errors.Is(err, fakeservice.ErrUnsupportedEdge) {
+				t.Errorf("expected ErrUnsupportedEdge got: %v", err)
+			}
+		})
+	}
 }
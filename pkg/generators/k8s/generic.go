@@ -14,13 +14,25 @@ import (
 
 // Generator for https://github.com/lahabana/api-play
 type generator struct {
-	asStatefulSet          bool
-	namespace              string
-	image                  string
-	port                   int32
-	formatters             Formatters
-	configMapGenerator     func(formatters Formatters, svc apis.Service) (string, error)
-	podTemplateSpecMutator func(formatters Formatters, svc apis.Service, template *v1.PodTemplateSpec) error
+	asStatefulSet           bool
+	serviceAccounts         bool
+	namespace               string
+	image                   string
+	port                    int32
+	formatters              Formatters
+	configMapGenerator      func(formatters Formatters, svc apis.Service) (string, error)
+	podTemplateSpecMutator  func(formatters Formatters, svc apis.Service, template *v1.PodTemplateSpec) error
+	podTemplateSpecMutators []func(formatters Formatters, svc apis.Service, template *v1.PodTemplateSpec) error
+	namespaceMutators       []func(ns *v1.Namespace) error
+	graphObjectsGenerators  []func(s Settings, graph apis.ServiceGraph) ([]runtime.Object, error)
+}
+
+// Settings is what is known about the generated workloads, it's passed to generators of objects which depend on the whole graph.
+type Settings struct {
+	Namespace  string
+	Image      string
+	Port       int
+	Formatters Formatters
 }
 
 type Formatters struct {
@@ -42,6 +54,31 @@ func SimpleFormatters(baseName string) Formatters {
 
 }
 
+// ForGraph returns formatters which use the name of the services in the graph when they are set.
+func (f Formatters) ForGraph(graph apis.ServiceGraph) Formatters {
+	nameOf := func(idx int) string {
+		if idx >= 0 && idx < len(graph.Services) {
+			return graph.Services[idx].Name
+		}
+		return ""
+	}
+	return Formatters{
+		BaseName: f.BaseName,
+		Name: func(idx int) string {
+			if n := nameOf(idx); n != "" {
+				return n
+			}
+			return f.Name(idx)
+		},
+		Url: func(idx int, port int) string {
+			if n := nameOf(idx); n != "" {
+				return fmt.Sprintf("http://%s:%d", n, port)
+			}
+			return f.Url(idx, port)
+		},
+	}
+}
+
 type Option interface {
 	Apply(g *generator) error
 }
@@ -58,6 +95,7 @@ func WithConfigMapGenerator(fn func(f Formatters, svc apis.Service) (string, err
 	})
 }
 
+// WithPodTemplateSpecMutator sets the function to modify the pod template of each service (it replaces any previous one).
 func WithPodTemplateSpecMutator(fn func(f Formatters, svc apis.Service, template *v1.PodTemplateSpec) error) Option {
 	return OptionFn(func(g *generator) error {
 		g.podTemplateSpecMutator = fn
@@ -65,6 +103,31 @@ func WithPodTemplateSpecMutator(fn func(f Formatters, svc apis.Service, template
 	})
 }
 
+// AddPodTemplateSpecMutator adds a function to modify the pod template of each service, it can be used multiple times.
+// These run in order after the one set with WithPodTemplateSpecMutator (to add mesh annotations for example).
+func AddPodTemplateSpecMutator(fn func(f Formatters, svc apis.Service, template *v1.PodTemplateSpec) error) Option {
+	return OptionFn(func(g *generator) error {
+		g.podTemplateSpecMutators = append(g.podTemplateSpecMutators, fn)
+		return nil
+	})
+}
+
+// WithNamespaceMutator adds a function to modify the namespace (to add labels for example), it can be used multiple times.
+func WithNamespaceMutator(fn func(ns *v1.Namespace) error) Option {
+	return OptionFn(func(g *generator) error {
+		g.namespaceMutators = append(g.namespaceMutators, fn)
+		return nil
+	})
+}
+
+// WithGraphObjectsGenerator adds a function to generate objects which depend on the whole graph (policies for example), it can be used multiple times.
+func WithGraphObjectsGenerator(fn func(s Settings, graph apis.ServiceGraph) ([]runtime.Object, error)) Option {
+	return OptionFn(func(g *generator) error {
+		g.graphObjectsGenerators = append(g.graphObjectsGenerators, fn)
+		return nil
+	})
+}
+
 func WithPort(p int) Option {
 	return OptionFn(func(g *generator) error {
 		g.port = int32(p)
@@ -100,6 +163,14 @@ func AsStatefulSet() Option {
 	})
 }
 
+// WithServiceAccounts creates a ServiceAccount for each service (useful for identity based policies).
+func WithServiceAccounts() Option {
+	return OptionFn(func(g *generator) error {
+		g.serviceAccounts = true
+		return nil
+	})
+}
+
 func NewGenerator(opts ...Option) (Generator, error) {
 	out := Generator{
 		Serializer: DefaultSerializer,
@@ -113,27 +184,70 @@ func NewGenerator(opts ...Option) (Generator, error) {
 		}
 	}
 	out.WorkloadGenerator = g
-	out.CommonSetup = commonSetup(g.namespace)
+	out.CommonSetup = CommonSetupFn(g.commonSetup)
+	out.Settings = g.settings()
 	return out, nil
 }
 
-func commonSetup(ns string) CommonSetupFn {
-	return func(svcs apis.ServiceGraph) ([]runtime.Object, []byte, error) {
-		ns := &v1.Namespace{
-			TypeMeta: metav1.TypeMeta{
-				APIVersion: "v1",
-				Kind:       "Namespace",
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Name: ns,
-			},
-			Spec: v1.NamespaceSpec{},
+// Labels returns the labels to set on all the objects of a service.
+func Labels(name string, svc apis.Service) map[string]string {
+	out := map[string]string{}
+	for k, v := range svc.Labels {
+		out[k] = v
+	}
+	if svc.Role != "" {
+		out["role"] = svc.Role
+	}
+	if svc.Tier != "" {
+		out["tier"] = svc.Tier
+	}
+	out["app"] = name
+	return out
+}
+
+func (g generator) commonSetup(svcs apis.ServiceGraph) ([]runtime.Object, []byte, error) {
+	ns := &v1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: g.namespace,
+		},
+		Spec: v1.NamespaceSpec{},
+	}
+	for _, fn := range g.namespaceMutators {
+		if err := fn(ns); err != nil {
+			return nil, nil, err
 		}
-		return []runtime.Object{
-			ns,
-		}, nil, nil
 	}
+	out := []runtime.Object{
+		ns,
+	}
+	settings := g.settings()
+	settings.Formatters = settings.Formatters.ForGraph(svcs)
+	for _, fn := range g.graphObjectsGenerators {
+		objs, err := fn(settings, svcs)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, objs...)
+	}
+	return out, nil, nil
+}
+
+func (g generator) settings() Settings {
+	return Settings{
+		Namespace:  g.namespace,
+		Image:      g.image,
+		Port:       int(g.port),
+		Formatters: g.formatters,
+	}
+}
 
+func (g generator) ForGraph(graph apis.ServiceGraph) WorkloadGenerator {
+	g.formatters = g.formatters.ForGraph(graph)
+	return g
 }
 
 func (g generator) Apply(svc apis.Service) ([]runtime.Object, []byte, error) {
@@ -147,9 +261,7 @@ func (g generator) Apply(svc apis.Service) ([]runtime.Object, []byte, error) {
 	baseObjectMeta := metav1.ObjectMeta{
 		Name:      name,
 		Namespace: g.namespace,
-		Labels: map[string]string{
-			"app": name,
-		},
+		Labels:    Labels(name, svc),
 	}
 	var workload runtime.Object
 	podTemplateSpec := v1.PodTemplateSpec{
@@ -209,9 +321,16 @@ func (g generator) Apply(svc apis.Service) ([]runtime.Object, []byte, error) {
 		},
 	}
 	baseObjectMeta.DeepCopyInto(&podTemplateSpec.ObjectMeta)
+	if g.serviceAccounts {
+		podTemplateSpec.Spec.ServiceAccountName = name
+	}
 	if g.podTemplateSpecMutator != nil {
-		err := g.podTemplateSpecMutator(g.formatters, svc, &podTemplateSpec)
-		if err != nil {
+		if err := g.podTemplateSpecMutator(g.formatters, svc, &podTemplateSpec); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, fn := range g.podTemplateSpecMutators {
+		if err := fn(g.formatters, svc, &podTemplateSpec); err != nil {
 			return nil, nil, err
 		}
 	}
@@ -299,22 +418,26 @@ func (g generator) Apply(svc apis.Service) ([]runtime.Object, []byte, error) {
 			Kind:       "ConfigMap",
 			APIVersion: "v1",
 		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: g.namespace,
-			Labels: map[string]string{
-				"app": name,
-			},
-		},
 		Data: map[string]string{
 			"config.yaml": conf,
 		},
 	}
 	baseObjectMeta.DeepCopyInto(&configMap.ObjectMeta)
 
-	return []runtime.Object{
+	out := []runtime.Object{
 		workload,
 		service,
 		configMap,
-	}, nil, nil
+	}
+	if g.serviceAccounts {
+		serviceAccount := &v1.ServiceAccount{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ServiceAccount",
+				APIVersion: "v1",
+			},
+		}
+		baseObjectMeta.DeepCopyInto(&serviceAccount.ObjectMeta)
+		out = append(out, serviceAccount)
+	}
+	return out, nil, nil
 }
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
 	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	v1 "k8s.io/api/core/v1"
+	"strings"
 	"testing"
 )
 
@@ -15,10 +17,10 @@ func TestSimple(t *testing.T) {
 	buf := bytes.NewBuffer([]byte{})
 	err = encoder.Apply(buf, apis.ServiceGraph{
 		Services: []apis.Service{
-			{Replicas: 2, Edges: []int{1, 2}, Idx: 0},
-			{Replicas: 2, Edges: []int{2}, Idx: 1},
-			{Replicas: 2, Edges: []int{3}, Idx: 2},
-			{Replicas: 2, Edges: []int{}, Idx: 3},
+			{Replicas: 2, Edges: apis.EdgesTo(1, 2), Idx: 0},
+			{Replicas: 2, Edges: apis.EdgesTo(2), Idx: 1},
+			{Replicas: 2, Edges: apis.EdgesTo(3), Idx: 2},
+			{Replicas: 2, Edges: apis.EdgesTo(), Idx: 3},
 		},
 	})
 	if err != nil {
@@ -26,3 +28,63 @@ func TestSimple(t *testing.T) {
 	}
 	println(buf.String())
 }
+
+func TestNamedServices(t *testing.T) {
+	encoder, err := k8s.NewGenerator(k8s.WithNamespace("foo"), k8s.WithImage("nginx"), k8s.WithPort(8080))
+	if err != nil {
+		t.Fatal("failed creating a simple generator", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	err = encoder.Apply(buf, apis.ServiceGraph{
+		Services: []apis.Service{
+			{Replicas: 1, Edges: apis.EdgesTo(1), Idx: 0, Name: "frontend", Role: apis.RoleFrontend},
+			{Replicas: 1, Idx: 1, Labels: map[string]string{"team": "storage"}},
+		},
+	})
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{"name: frontend", "role: frontend", "name: microservice-001", "team: storage"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+}
+
+func TestPodTemplateSpecMutators(t *testing.T) {
+	annotate := func(key string) func(f k8s.Formatters, svc apis.Service, template *v1.PodTemplateSpec) error {
+		return func(f k8s.Formatters, svc apis.Service, template *v1.PodTemplateSpec) error {
+			if template.Annotations == nil {
+				template.Annotations = map[string]string{}
+			}
+			template.Annotations[key] = "true"
+			return nil
+		}
+	}
+	encoder, err := k8s.NewGenerator(k8s.WithNamespace("foo"), k8s.WithImage("nginx"), k8s.WithPort(8080),
+		k8s.AddPodTemplateSpecMutator(annotate("added-first")),
+		k8s.WithPodTemplateSpecMutator(annotate("replaced")),
+		k8s.WithPodTemplateSpecMutator(annotate("set")),
+		k8s.AddPodTemplateSpecMutator(annotate("added-second")),
+	)
+	if err != nil {
+		t.Fatal("failed creating a simple generator", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	err = encoder.Apply(buf, apis.ServiceGraph{
+		Services: []apis.Service{{Replicas: 1, Idx: 0}},
+	})
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{"added-first: \"true\"", "set: \"true\"", "added-second: \"true\""} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+	if strings.Contains(out, "replaced:") {
+		t.Errorf("expected WithPodTemplateSpecMutator to replace the previous mutator")
+	}
+}
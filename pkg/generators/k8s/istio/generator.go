@@ -0,0 +1,163 @@
+package istio
+
+import (
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"time"
+)
+
+type Config struct {
+	// TrustDomain the trust domain of the mesh used in the principals of authorization policies.
+	TrustDomain string
+	// SystemNamespace the namespace where Istio is installed (sidecars are always allowed to reach it).
+	SystemNamespace string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		TrustDomain:     "cluster.local",
+		SystemNamespace: "istio-system",
+	}
+}
+
+// GeneratorOpts adds sidecar injection to the namespace, a ServiceAccount per service and per service:
+// a Sidecar restricting egress to the services called, an AuthorizationPolicy which only allows callers from the graph,
+// a VirtualService when calls have timeouts or retries and a DestinationRule when circuit breaking is enabled.
+func GeneratorOpts(conf Config) []k8s.Option {
+	return []k8s.Option{
+		k8s.WithServiceAccounts(),
+		k8s.WithNamespaceMutator(func(ns *v1.Namespace) error {
+			if ns.Labels == nil {
+				ns.Labels = map[string]string{}
+			}
+			ns.Labels["istio-injection"] = "enabled"
+			return nil
+		}),
+		k8s.WithGraphObjectsGenerator(conf.resources),
+	}
+}
+
+func (conf Config) resources(s k8s.Settings, graph apis.ServiceGraph) ([]runtime.Object, error) {
+	var out []runtime.Object
+	callers := graph.Callers()
+	defaults := apis.Defaults{}
+	if graph.Defaults != nil {
+		defaults = *graph.Defaults
+	}
+	for _, srv := range graph.Services {
+		name := s.Formatters.Name(srv.Idx)
+		selector := map[string]interface{}{"app": name}
+
+		hosts := []interface{}{conf.SystemNamespace + "/*"}
+		seen := map[int]struct{}{}
+		for _, e := range srv.Edges {
+			if _, exists := seen[e.Target]; exists {
+				continue
+			}
+			seen[e.Target] = struct{}{}
+			hosts = append(hosts, "./"+host(s, e.Target))
+		}
+		out = append(out, object("networking.istio.io/v1beta1", "Sidecar", name, s.Namespace, map[string]interface{}{
+			"workloadSelector": map[string]interface{}{"labels": selector},
+			"egress":           []interface{}{map[string]interface{}{"hosts": hosts}},
+			"outboundTrafficPolicy": map[string]interface{}{
+				"mode": "REGISTRY_ONLY",
+			},
+		}))
+
+		// Services with no callers are entry points so we don't restrict them.
+		if len(callers[srv.Idx]) > 0 {
+			var principals []interface{}
+			for _, c := range callers[srv.Idx] {
+				principals = append(principals, fmt.Sprintf("%s/ns/%s/sa/%s", conf.TrustDomain, s.Namespace, s.Formatters.Name(c)))
+			}
+			out = append(out, object("security.istio.io/v1", "AuthorizationPolicy", name, s.Namespace, map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": selector},
+				"action":   "ALLOW",
+				"rules": []interface{}{
+					map[string]interface{}{
+						"from": []interface{}{
+							map[string]interface{}{"source": map[string]interface{}{"principals": principals}},
+						},
+					},
+				},
+			}))
+		}
+
+		// Timeouts and retries are set on the destination so we route depending on the caller.
+		var routes []interface{}
+		for _, c := range callers[srv.Idx] {
+			for _, e := range graph.Services[c].Edges {
+				if e.Target != srv.Idx || (e.TimeoutMs == 0 && e.Retries == 0) {
+					continue
+				}
+				route := httpRoute(s, srv.Idx, e.TimeoutMs, e.Retries)
+				route["match"] = []interface{}{
+					map[string]interface{}{"sourceLabels": map[string]interface{}{"app": s.Formatters.Name(c)}},
+				}
+				routes = append(routes, route)
+				break
+			}
+		}
+		if len(routes) > 0 || defaults.TimeoutMs > 0 || defaults.Retries > 0 {
+			routes = append(routes, httpRoute(s, srv.Idx, defaults.TimeoutMs, defaults.Retries))
+			out = append(out, object("networking.istio.io/v1beta1", "VirtualService", name, s.Namespace, map[string]interface{}{
+				"hosts": []interface{}{host(s, srv.Idx)},
+				"http":  routes,
+			}))
+		}
+		if defaults.CircuitBreakerErrors > 0 {
+			out = append(out, object("networking.istio.io/v1beta1", "DestinationRule", name, s.Namespace, map[string]interface{}{
+				"host": host(s, srv.Idx),
+				"trafficPolicy": map[string]interface{}{
+					"outlierDetection": map[string]interface{}{
+						"consecutive5xxErrors": int64(defaults.CircuitBreakerErrors),
+						"interval":             "10s",
+						"baseEjectionTime":     "30s",
+					},
+				},
+			}))
+		}
+	}
+	return out, nil
+}
+
+func host(s k8s.Settings, idx int) string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", s.Formatters.Name(idx), s.Namespace)
+}
+
+func httpRoute(s k8s.Settings, idx int, timeoutMs int, retries int) map[string]interface{} {
+	out := map[string]interface{}{
+		"route": []interface{}{
+			map[string]interface{}{"destination": map[string]interface{}{"host": host(s, idx)}},
+		},
+	}
+	if timeoutMs > 0 {
+		out["timeout"] = (time.Duration(timeoutMs) * time.Millisecond).String()
+	}
+	if retries > 0 {
+		out["retries"] = map[string]interface{}{
+			"attempts": int64(retries),
+			"retryOn":  "5xx,reset,connect-failure",
+		}
+	}
+	return out
+}
+
+func object(apiVersion string, kind string, name string, namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+			"spec": spec,
+		},
+	}
+}
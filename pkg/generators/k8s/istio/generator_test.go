@@ -0,0 +1,54 @@
+package istio_test
+
+import (
+	"bytes"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/istio"
+	"strings"
+	"testing"
+)
+
+func TestSimple(t *testing.T) {
+	opts := apiplay.GeneratorOpts()
+	opts = append(opts, k8s.WithNamespace("foo"))
+	opts = append(opts, istio.GeneratorOpts(istio.DefaultConfig())...)
+	encoder, err := k8s.NewGenerator(opts...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	err = encoder.Apply(buf, apis.ServiceGraph{
+		Services: []apis.Service{
+			{Replicas: 2, Edges: apis.EdgesTo(1, 2), Idx: 0},
+			{Replicas: 2, Edges: []apis.Edge{{Target: 2, TimeoutMs: 500, Retries: 3}}, Idx: 1},
+			{Replicas: 2, Edges: apis.EdgesTo(3), Idx: 2},
+			{Replicas: 2, Edges: apis.EdgesTo(), Idx: 3},
+		},
+		Defaults: &apis.Defaults{CircuitBreakerErrors: 5},
+	})
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"istio-injection: enabled",
+		"serviceAccountName: api-play-001",
+		"kind: ServiceAccount",
+		"./api-play-002.foo.svc.cluster.local",
+		"cluster.local/ns/foo/sa/api-play-001",
+		"timeout: 500ms",
+		"consecutive5xxErrors: 5",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+	for kind, count := range map[string]int{"Sidecar": 4, "AuthorizationPolicy": 3, "VirtualService": 1, "DestinationRule": 4} {
+		if got := strings.Count(out, "kind: "+kind+"\n"); got != count {
+			t.Errorf("expected %d %s got: %d", count, kind, got)
+		}
+	}
+	println(out)
+}
@@ -0,0 +1,199 @@
+package kuma
+
+import (
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"time"
+)
+
+type Config struct {
+	// Mesh the name of the Kuma mesh to use.
+	Mesh string
+	// SystemNamespace the namespace where Kuma is installed (policies are created there).
+	SystemNamespace string
+	// MTLS adds the Mesh with builtin mTLS, MeshTrafficPermissions have no effect without mTLS
+	// so if disabled the mesh must already have mTLS enabled.
+	MTLS bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Mesh:            "default",
+		SystemNamespace: "kuma-system",
+		MTLS:            true,
+	}
+}
+
+// GeneratorOpts adds sidecar injection to the namespace, the Mesh with mTLS and policies which only allow the calls in the graph.
+// MeshTimeout, MeshRetry and MeshCircuitBreaker are added when the graph or its edges define timeouts, retries or circuit breaking.
+func GeneratorOpts(conf Config) []k8s.Option {
+	return []k8s.Option{
+		k8s.WithNamespaceMutator(func(ns *v1.Namespace) error {
+			if ns.Labels == nil {
+				ns.Labels = map[string]string{}
+			}
+			ns.Labels["kuma.io/sidecar-injection"] = "enabled"
+			ns.Labels["kuma.io/mesh"] = conf.Mesh
+			return nil
+		}),
+		k8s.WithGraphObjectsGenerator(conf.policies),
+	}
+}
+
+func (conf Config) policies(s k8s.Settings, graph apis.ServiceGraph) ([]runtime.Object, error) {
+	var out []runtime.Object
+	if conf.MTLS {
+		out = append(out, conf.mesh())
+	}
+	callers := graph.Callers()
+	// Only allow calls which are in the graph, services with no callers are entry points and keep the default permissions.
+	for _, srv := range graph.Services {
+		if len(callers[srv.Idx]) == 0 {
+			continue
+		}
+		from := []interface{}{
+			entry(meshRef(), map[string]interface{}{"action": "Deny"}),
+		}
+		for _, c := range callers[srv.Idx] {
+			from = append(from, entry(conf.serviceRef(s, c), map[string]interface{}{"action": "Allow"}))
+		}
+		out = append(out, conf.policy("MeshTrafficPermission", s.Namespace+"-"+s.Formatters.Name(srv.Idx), map[string]interface{}{
+			"targetRef": conf.serviceRef(s, srv.Idx),
+			"from":      from,
+		}))
+	}
+
+	defaults := apis.Defaults{}
+	if graph.Defaults != nil {
+		defaults = *graph.Defaults
+	}
+	if defaults.TimeoutMs > 0 {
+		out = append(out, conf.policy("MeshTimeout", s.Namespace, map[string]interface{}{
+			"targetRef": meshRef(),
+			"to":        []interface{}{entry(meshRef(), timeoutConf(defaults.TimeoutMs))},
+		}))
+	}
+	if defaults.Retries > 0 {
+		out = append(out, conf.policy("MeshRetry", s.Namespace, map[string]interface{}{
+			"targetRef": meshRef(),
+			"to":        []interface{}{entry(meshRef(), retryConf(defaults.Retries))},
+		}))
+	}
+	if defaults.CircuitBreakerErrors > 0 {
+		out = append(out, conf.policy("MeshCircuitBreaker", s.Namespace, map[string]interface{}{
+			"targetRef": meshRef(),
+			"to": []interface{}{entry(meshRef(), map[string]interface{}{
+				"outlierDetection": map[string]interface{}{
+					"detectors": map[string]interface{}{
+						"totalFailures": map[string]interface{}{
+							"consecutive": int64(defaults.CircuitBreakerErrors),
+						},
+					},
+				},
+			})},
+		}))
+	}
+	// Edges which override the defaults get their own policies
+	for _, srv := range graph.Services {
+		var timeouts, retries []interface{}
+		for _, e := range srv.Edges {
+			if e.TimeoutMs > 0 && e.TimeoutMs != defaults.TimeoutMs {
+				timeouts = append(timeouts, entry(conf.serviceRef(s, e.Target), timeoutConf(e.TimeoutMs)))
+			}
+			if e.Retries > 0 && e.Retries != defaults.Retries {
+				retries = append(retries, entry(conf.serviceRef(s, e.Target), retryConf(e.Retries)))
+			}
+		}
+		if len(timeouts) > 0 {
+			out = append(out, conf.policy("MeshTimeout", s.Namespace+"-"+s.Formatters.Name(srv.Idx), map[string]interface{}{
+				"targetRef": conf.serviceRef(s, srv.Idx),
+				"to":        timeouts,
+			}))
+		}
+		if len(retries) > 0 {
+			out = append(out, conf.policy("MeshRetry", s.Namespace+"-"+s.Formatters.Name(srv.Idx), map[string]interface{}{
+				"targetRef": conf.serviceRef(s, srv.Idx),
+				"to":        retries,
+			}))
+		}
+	}
+	return out, nil
+}
+
+// mesh enables mTLS with a builtin CA, it is required for MeshTrafficPermissions to be enforced.
+func (conf Config) mesh() *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "kuma.io/v1alpha1",
+			"kind":       "Mesh",
+			"metadata": map[string]interface{}{
+				"name": conf.Mesh,
+			},
+			"spec": map[string]interface{}{
+				"mtls": map[string]interface{}{
+					"enabledBackend": "ca-1",
+					"backends": []interface{}{
+						map[string]interface{}{"name": "ca-1", "type": "builtin"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (conf Config) policy(kind string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "kuma.io/v1alpha1",
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": conf.SystemNamespace,
+				"labels": map[string]interface{}{
+					"kuma.io/mesh": conf.Mesh,
+				},
+			},
+			"spec": spec,
+		},
+	}
+}
+
+// serviceRef uses the name Kuma gives to kubernetes services: <name>_<namespace>_svc_<port>
+func (conf Config) serviceRef(s k8s.Settings, idx int) map[string]interface{} {
+	return map[string]interface{}{
+		"kind": "MeshService",
+		"name": fmt.Sprintf("%s_%s_svc_%d", s.Formatters.Name(idx), s.Namespace, s.Port),
+	}
+}
+
+func meshRef() map[string]interface{} {
+	return map[string]interface{}{"kind": "Mesh"}
+}
+
+// entry is an item of `from` or `to` in a policy.
+func entry(ref map[string]interface{}, conf map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"targetRef": ref, "default": conf}
+}
+
+func timeoutConf(timeoutMs int) map[string]interface{} {
+	return map[string]interface{}{
+		"http": map[string]interface{}{
+			"requestTimeout": (time.Duration(timeoutMs) * time.Millisecond).String(),
+		},
+	}
+}
+
+func retryConf(retries int) map[string]interface{} {
+	return map[string]interface{}{
+		"http": map[string]interface{}{
+			"numRetries": int64(retries),
+		},
+		"grpc": map[string]interface{}{
+			"numRetries": int64(retries),
+		},
+	}
+}
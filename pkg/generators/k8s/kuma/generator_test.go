@@ -0,0 +1,71 @@
+package kuma_test
+
+import (
+	"bytes"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/kuma"
+	"strings"
+	"testing"
+)
+
+func TestSimple(t *testing.T) {
+	opts := apiplay.GeneratorOpts()
+	opts = append(opts, k8s.WithNamespace("foo"))
+	opts = append(opts, kuma.GeneratorOpts(kuma.DefaultConfig())...)
+	encoder, err := k8s.NewGenerator(opts...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	err = encoder.Apply(buf, apis.ServiceGraph{
+		Services: []apis.Service{
+			{Replicas: 2, Edges: apis.EdgesTo(1, 2), Idx: 0},
+			{Replicas: 2, Edges: []apis.Edge{{Target: 2, TimeoutMs: 500, Retries: 3}}, Idx: 1},
+			{Replicas: 2, Edges: apis.EdgesTo(3), Idx: 2},
+			{Replicas: 2, Edges: apis.EdgesTo(), Idx: 3},
+		},
+		Defaults: &apis.Defaults{TimeoutMs: 200, Retries: 1, CircuitBreakerErrors: 5},
+	})
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"kuma.io/sidecar-injection: enabled",
+		"\nkind: Mesh\n",
+		"enabledBackend: ca-1",
+		"type: builtin",
+		"name: api-play-002_foo_svc_8080",
+		"kind: MeshTimeout",
+		"requestTimeout: 500ms",
+		"kind: MeshRetry",
+		"kind: MeshCircuitBreaker",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+	// The entry point has no callers so it has no traffic permission
+	if strings.Count(out, "kind: MeshTrafficPermission") != 3 {
+		t.Errorf("expected 3 MeshTrafficPermission got: %d", strings.Count(out, "kind: MeshTrafficPermission"))
+	}
+	println(out)
+}
+
+func TestWithoutMTLS(t *testing.T) {
+	conf := kuma.DefaultConfig()
+	conf.MTLS = false
+	encoder, err := k8s.NewGenerator(append(apiplay.GeneratorOpts(), kuma.GeneratorOpts(conf)...)...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := encoder.Apply(buf, apis.ServiceGraph{Services: []apis.Service{{Replicas: 1, Edges: apis.EdgesTo(1), Idx: 0}, {Replicas: 1, Idx: 1}}}); err != nil {
+		t.Fatal("failed", err)
+	}
+	if strings.Contains(buf.String(), "\nkind: Mesh\n") {
+		t.Errorf("expected no Mesh")
+	}
+}
@@ -0,0 +1,162 @@
+package linkerd
+
+import (
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"math"
+	"time"
+)
+
+type Config struct {
+	// ClusterDomain the domain of the cluster used in the names of the ServiceProfiles.
+	ClusterDomain string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ClusterDomain: "cluster.local",
+	}
+}
+
+// GeneratorOpts annotates workloads for proxy injection, creates a ServiceAccount per service and per service:
+// a Server, HTTPRoutes and AuthorizationPolicies which only allow callers from the graph (probes are always allowed)
+// and a ServiceProfile when calls have timeouts or retries.
+func GeneratorOpts(conf Config) []k8s.Option {
+	return []k8s.Option{
+		k8s.WithServiceAccounts(),
+		k8s.AddPodTemplateSpecMutator(func(f k8s.Formatters, svc apis.Service, template *v1.PodTemplateSpec) error {
+			if template.Annotations == nil {
+				template.Annotations = map[string]string{}
+			}
+			template.Annotations["linkerd.io/inject"] = "enabled"
+			return nil
+		}),
+		k8s.WithGraphObjectsGenerator(conf.resources),
+	}
+}
+
+func (conf Config) resources(s k8s.Settings, graph apis.ServiceGraph) ([]runtime.Object, error) {
+	callers := graph.Callers()
+	defaults := apis.Defaults{}
+	if graph.Defaults != nil {
+		defaults = *graph.Defaults
+	}
+	out := []runtime.Object{
+		object("policy.linkerd.io/v1alpha1", "NetworkAuthentication", "probes", s.Namespace, map[string]interface{}{
+			"networks": []interface{}{
+				map[string]interface{}{"cidr": "0.0.0.0/0"},
+				map[string]interface{}{"cidr": "::/0"},
+			},
+		}),
+	}
+	for _, srv := range graph.Services {
+		name := s.Formatters.Name(srv.Idx)
+		// Services with no callers are entry points so we don't restrict them.
+		if len(callers[srv.Idx]) > 0 {
+			var identities []interface{}
+			for _, c := range callers[srv.Idx] {
+				identities = append(identities, map[string]interface{}{"kind": "ServiceAccount", "name": s.Formatters.Name(c)})
+			}
+			probesName := name + "-probes"
+			out = append(out,
+				object("policy.linkerd.io/v1beta1", "Server", name, s.Namespace, map[string]interface{}{
+					"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": name}},
+					"port":        int64(s.Port),
+				}),
+				object("policy.linkerd.io/v1beta3", "HTTPRoute", name, s.Namespace, map[string]interface{}{
+					"parentRefs": []interface{}{serverRef(name)},
+					"rules": []interface{}{
+						map[string]interface{}{"matches": []interface{}{pathMatch("PathPrefix", "/")}},
+					},
+				}),
+				object("policy.linkerd.io/v1alpha1", "MeshTLSAuthentication", name, s.Namespace, map[string]interface{}{
+					"identityRefs": identities,
+				}),
+				object("policy.linkerd.io/v1alpha1", "AuthorizationPolicy", name, s.Namespace, map[string]interface{}{
+					"targetRef":                  policyRef("HTTPRoute", name),
+					"requiredAuthenticationRefs": []interface{}{policyRef("MeshTLSAuthentication", name)},
+				}),
+				object("policy.linkerd.io/v1beta3", "HTTPRoute", probesName, s.Namespace, map[string]interface{}{
+					"parentRefs": []interface{}{serverRef(name)},
+					"rules": []interface{}{
+						map[string]interface{}{"matches": []interface{}{pathMatch("Exact", "/health"), pathMatch("Exact", "/ready")}},
+					},
+				}),
+				object("policy.linkerd.io/v1alpha1", "AuthorizationPolicy", probesName, s.Namespace, map[string]interface{}{
+					"targetRef":                  policyRef("HTTPRoute", probesName),
+					"requiredAuthenticationRefs": []interface{}{policyRef("NetworkAuthentication", "probes")},
+				}),
+			)
+		}
+
+		// ServiceProfiles are on the destination so we use the strictest settings of all the callers.
+		timeoutMs, retries := defaults.TimeoutMs, defaults.Retries
+		for _, c := range callers[srv.Idx] {
+			for _, e := range graph.Services[c].Edges {
+				if e.Target != srv.Idx {
+					continue
+				}
+				if e.TimeoutMs > 0 && (timeoutMs == 0 || e.TimeoutMs < timeoutMs) {
+					timeoutMs = e.TimeoutMs
+				}
+				if e.Retries > retries {
+					retries = e.Retries
+				}
+			}
+		}
+		if timeoutMs == 0 && retries == 0 {
+			continue
+		}
+		route := map[string]interface{}{
+			"name":      "all",
+			"condition": map[string]interface{}{"pathRegex": "/.*"},
+		}
+		if timeoutMs > 0 {
+			route["timeout"] = (time.Duration(timeoutMs) * time.Millisecond).String()
+		}
+		spec := map[string]interface{}{
+			"routes": []interface{}{route},
+		}
+		if retries > 0 {
+			route["isRetryable"] = true
+			// Each retry allowed on an edge adds 10% of extra load to the budget.
+			spec["retryBudget"] = map[string]interface{}{
+				"retryRatio":          math.Min(float64(retries)*0.1, 1),
+				"minRetriesPerSecond": int64(10),
+				"ttl":                 "10s",
+			}
+		}
+		out = append(out, object("linkerd.io/v1alpha2", "ServiceProfile", fmt.Sprintf("%s.%s.svc.%s", name, s.Namespace, conf.ClusterDomain), s.Namespace, spec))
+	}
+	return out, nil
+}
+
+func serverRef(name string) map[string]interface{} {
+	return map[string]interface{}{"group": "policy.linkerd.io", "kind": "Server", "name": name}
+}
+
+func policyRef(kind string, name string) map[string]interface{} {
+	return map[string]interface{}{"group": "policy.linkerd.io", "kind": kind, "name": name}
+}
+
+func pathMatch(kind string, value string) map[string]interface{} {
+	return map[string]interface{}{"path": map[string]interface{}{"type": kind, "value": value}}
+}
+
+func object(apiVersion string, kind string, name string, namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+			"spec": spec,
+		},
+	}
+}
@@ -0,0 +1,52 @@
+package linkerd_test
+
+import (
+	"bytes"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/linkerd"
+	"strings"
+	"testing"
+)
+
+func TestSimple(t *testing.T) {
+	opts := apiplay.GeneratorOpts()
+	opts = append(opts, k8s.WithNamespace("foo"))
+	opts = append(opts, linkerd.GeneratorOpts(linkerd.DefaultConfig())...)
+	encoder, err := k8s.NewGenerator(opts...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	err = encoder.Apply(buf, apis.ServiceGraph{
+		Services: []apis.Service{
+			{Replicas: 2, Edges: apis.EdgesTo(1, 2), Idx: 0},
+			{Replicas: 2, Edges: []apis.Edge{{Target: 2, TimeoutMs: 500, Retries: 3}}, Idx: 1},
+			{Replicas: 2, Edges: apis.EdgesTo(3), Idx: 2},
+			{Replicas: 2, Edges: apis.EdgesTo(), Idx: 3},
+		},
+	})
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"linkerd.io/inject: enabled",
+		"serviceAccountName: api-play-001",
+		"name: api-play-002.foo.svc.cluster.local",
+		"timeout: 500ms",
+		"isRetryable: true",
+		"retryRatio: 0.3",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+	for kind, count := range map[string]int{"Server": 3, "HTTPRoute": 6, "MeshTLSAuthentication": 3, "AuthorizationPolicy": 6, "NetworkAuthentication": 1, "ServiceProfile": 1} {
+		if got := strings.Count(out, "\nkind: "+kind+"\n"); got != count {
+			t.Errorf("expected %d %s got: %d", count, kind, got)
+		}
+	}
+	println(out)
+}
@@ -0,0 +1,62 @@
+package k8s
+
+import (
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// WithNetworkPolicies adds a default-deny ingress NetworkPolicy for the namespace and one NetworkPolicy per service
+// which only allows the pods of its callers on the service port.
+// Services without callers are the entry points of the mesh so they accept traffic from anywhere on the service port.
+// Egress is left untouched so that DNS and the control plane of a mesh keep working.
+func WithNetworkPolicies() Option {
+	return WithGraphObjectsGenerator(networkPolicies)
+}
+
+func networkPolicies(s Settings, graph apis.ServiceGraph) ([]runtime.Object, error) {
+	out := []runtime.Object{
+		networkPolicy(s.Namespace, "default-deny", metav1.LabelSelector{}, nil),
+	}
+	port := intstr.FromInt(s.Port)
+	callers := graph.Callers()
+	for _, svc := range graph.Services {
+		name := s.Formatters.Name(svc.Idx)
+		rule := networkingv1.NetworkPolicyIngressRule{
+			Ports: []networkingv1.NetworkPolicyPort{{Port: &port}},
+		}
+		for _, c := range callers[svc.Idx] {
+			rule.From = append(rule.From, networkingv1.NetworkPolicyPeer{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"app": s.Formatters.Name(c),
+					},
+				},
+			})
+		}
+		np := networkPolicy(s.Namespace, name, metav1.LabelSelector{MatchLabels: map[string]string{"app": name}}, []networkingv1.NetworkPolicyIngressRule{rule})
+		np.Labels = Labels(name, svc)
+		out = append(out, np)
+	}
+	return out, nil
+}
+
+func networkPolicy(namespace string, name string, selector metav1.LabelSelector, ingress []networkingv1.NetworkPolicyIngressRule) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: selector,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     ingress,
+		},
+	}
+}
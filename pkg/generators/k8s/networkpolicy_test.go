@@ -0,0 +1,39 @@
+package k8s_test
+
+import (
+	"bytes"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"strings"
+	"testing"
+)
+
+func TestNetworkPolicies(t *testing.T) {
+	encoder, err := k8s.NewGenerator(k8s.WithNamespace("foo"), k8s.WithImage("nginx"), k8s.WithPort(8080), k8s.WithNetworkPolicies())
+	if err != nil {
+		t.Fatal("failed creating a simple generator", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	err = encoder.Apply(buf, apis.ServiceGraph{
+		Services: []apis.Service{
+			{Replicas: 1, Edges: apis.EdgesTo(1, 2), Idx: 0, Name: "frontend"},
+			{Replicas: 1, Edges: apis.EdgesTo(2), Idx: 1},
+			{Replicas: 1, Idx: 2},
+		},
+	})
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	if got := strings.Count(out, "kind: NetworkPolicy\n"); got != 4 {
+		t.Errorf("expected 4 NetworkPolicy got: %d", got)
+	}
+	for _, expected := range []string{
+		"name: default-deny",
+		"  - from:\n    - podSelector:\n        matchLabels:\n          app: frontend\n    - podSelector:\n        matchLabels:\n          app: microservice-001\n    ports:\n    - port: 8080\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+}
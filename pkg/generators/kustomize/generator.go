@@ -0,0 +1,346 @@
+package kustomize
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/archive"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"io"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"path"
+	"reflect"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+const (
+	MeshEnabledOverlay = "mesh-enabled"
+	ScaledDownOverlay  = "scaled-down"
+)
+
+// Generator outputs a kustomize layout: a base with one file per service and overlays on top of it.
+type Generator struct {
+	name               string
+	base               k8s.Generator
+	meshOpts           []k8s.Option
+	mesh               *k8s.Generator
+	scaledDown         bool
+	scaledDownReplicas int
+}
+
+type Option interface {
+	Apply(g *Generator) error
+}
+
+type OptionFn func(g *Generator) error
+
+func (f OptionFn) Apply(g *Generator) error {
+	return f(g)
+}
+
+// WithMeshOverlay adds an overlay named `mesh-enabled` with the differences between the base and the base generated with meshOpts on top,
+// new objects are added as resources and modified objects as patches.
+func WithMeshOverlay(meshOpts ...k8s.Option) Option {
+	return OptionFn(func(g *Generator) error {
+		g.meshOpts = meshOpts
+		return nil
+	})
+}
+
+// WithScaledDownOverlay adds an overlay named `scaled-down` where all workloads have `replicas` replicas.
+func WithScaledDownOverlay(replicas int) Option {
+	return OptionFn(func(g *Generator) error {
+		if replicas < 0 {
+			return fmt.Errorf("replicas must be positive got: %d", replicas)
+		}
+		g.scaledDown = true
+		g.scaledDownReplicas = replicas
+		return nil
+	})
+}
+
+// NewGenerator creates a generator of kustomize layout where the base is generated with the options of k8s.NewGenerator.
+func NewGenerator(name string, baseOpts []k8s.Option, opts ...Option) (*Generator, error) {
+	base, err := k8s.NewGenerator(baseOpts...)
+	if err != nil {
+		return nil, err
+	}
+	g := &Generator{
+		name: name,
+		base: base,
+	}
+	for _, o := range opts {
+		if err := o.Apply(g); err != nil {
+			return nil, err
+		}
+	}
+	if len(g.meshOpts) > 0 {
+		mesh, err := k8s.NewGenerator(append(append([]k8s.Option{}, baseOpts...), g.meshOpts...)...)
+		if err != nil {
+			return nil, err
+		}
+		g.mesh = &mesh
+	}
+	return g, nil
+}
+
+// Apply writes the layout as a .tgz.
+func (g *Generator) Apply(writer io.Writer, graph apis.ServiceGraph) error {
+	files, err := g.Files(graph)
+	if err != nil {
+		return err
+	}
+	return archive.WriteTarGz(writer, files)
+}
+
+// WriteDir writes the layout in a directory named after the generator inside dir.
+func (g *Generator) WriteDir(dir string, graph apis.ServiceGraph) error {
+	files, err := g.Files(graph)
+	if err != nil {
+		return err
+	}
+	return archive.WriteDir(dir, files)
+}
+
+// Files returns all the files of the layout, their path starts with the name of the generator.
+func (g *Generator) Files(graph apis.ServiceGraph) ([]archive.File, error) {
+	baseFiles, err := render(g.base, graph)
+	if err != nil {
+		return nil, err
+	}
+	var out []archive.File
+	var resources []string
+	for _, f := range baseFiles {
+		out = append(out, archive.File{Path: path.Join(g.name, "base", f.Path), Content: f.Content})
+		resources = append(resources, f.Path)
+	}
+	content, err := yaml.Marshal(kustomization(resources))
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, archive.File{Path: path.Join(g.name, "base", "kustomization.yaml"), Content: content})
+
+	baseDocs, err := documents(baseFiles)
+	if err != nil {
+		return nil, err
+	}
+	if g.mesh != nil {
+		meshFiles, err := render(*g.mesh, graph)
+		if err != nil {
+			return nil, err
+		}
+		meshDocs, err := documents(meshFiles)
+		if err != nil {
+			return nil, err
+		}
+		files, err := meshOverlay(baseDocs, meshDocs)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			out = append(out, archive.File{Path: path.Join(g.name, "overlays", MeshEnabledOverlay, f.Path), Content: f.Content})
+		}
+	}
+	if g.scaledDown {
+		k := kustomization([]string{"../../base"})
+		var replicas []interface{}
+		for _, doc := range baseDocs {
+			if kind := doc["kind"]; kind == "Deployment" || kind == "StatefulSet" {
+				replicas = append(replicas, map[string]interface{}{"name": name(doc), "count": g.scaledDownReplicas})
+			}
+		}
+		if len(replicas) > 0 {
+			k["replicas"] = replicas
+		}
+		content, err := yaml.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, archive.File{Path: path.Join(g.name, "overlays", ScaledDownOverlay, "kustomization.yaml"), Content: content})
+	}
+	return out, nil
+}
+
+// meshOverlay returns the files of an overlay which transforms the base documents into the mesh documents.
+func meshOverlay(baseDocs []map[string]interface{}, meshDocs []map[string]interface{}) ([]archive.File, error) {
+	baseByKey := map[string]map[string]interface{}{}
+	for _, doc := range baseDocs {
+		baseByKey[key(doc)] = doc
+	}
+	meshKeys := map[string]bool{}
+	var out []archive.File
+	var patches []interface{}
+	addPatch := func(doc map[string]interface{}) error {
+		content, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		p := fmt.Sprintf("%s-%s.yaml", name(doc), strings.ToLower(doc["kind"].(string)))
+		out = append(out, archive.File{Path: p, Content: content})
+		patches = append(patches, map[string]interface{}{"path": p})
+		return nil
+	}
+	added := bytes.Buffer{}
+	for _, doc := range meshDocs {
+		k := key(doc)
+		meshKeys[k] = true
+		baseDoc, exists := baseByKey[k]
+		if !exists {
+			content, err := yaml.Marshal(doc)
+			if err != nil {
+				return nil, err
+			}
+			added.WriteString("---\n")
+			added.Write(content)
+			continue
+		}
+		patch := diff(baseDoc, doc)
+		if len(patch) == 0 {
+			continue
+		}
+		if err := addPatch(withIdentity(doc, patch)); err != nil {
+			return nil, err
+		}
+	}
+	for _, doc := range baseDocs {
+		if !meshKeys[key(doc)] {
+			if err := addPatch(withIdentity(doc, map[string]interface{}{"$patch": "delete"})); err != nil {
+				return nil, err
+			}
+		}
+	}
+	resources := []string{"../../base"}
+	if added.Len() > 0 {
+		out = append(out, archive.File{Path: "mesh.yaml", Content: added.Bytes()})
+		resources = append(resources, "mesh.yaml")
+	}
+	k := kustomization(resources)
+	if len(patches) > 0 {
+		k["patches"] = patches
+	}
+	content, err := yaml.Marshal(k)
+	if err != nil {
+		return nil, err
+	}
+	return append([]archive.File{{Path: "kustomization.yaml", Content: content}}, out...), nil
+}
+
+// render returns a file per service plus a `common.yaml` with the objects shared by all services.
+func render(gen k8s.Generator, graph apis.ServiceGraph) ([]archive.File, error) {
+	var out []archive.File
+	objs, raw, err := gen.CommonSetup.Generate(graph)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(raw)
+	if err := gen.Encode(buf, objs...); err != nil {
+		return nil, err
+	}
+	out = append(out, archive.File{Path: "common.yaml", Content: buf.Bytes()})
+	workloadGenerator := gen.WorkloadGenerator
+	if wg, ok := workloadGenerator.(k8s.GraphAwareWorkloadGenerator); ok {
+		workloadGenerator = wg.ForGraph(graph)
+	}
+	formatters := gen.Settings.Formatters.ForGraph(graph)
+	for _, svc := range graph.Services {
+		objs, raw, err := workloadGenerator.Apply(svc)
+		if err != nil {
+			return nil, err
+		}
+		buf := bytes.NewBuffer(raw)
+		if err := gen.Encode(buf, objs...); err != nil {
+			return nil, err
+		}
+		out = append(out, archive.File{Path: formatters.Name(svc.Idx) + ".yaml", Content: buf.Bytes()})
+	}
+	return out, nil
+}
+
+func documents(files []archive.File) ([]map[string]interface{}, error) {
+	var out []map[string]interface{}
+	for _, f := range files {
+		decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(f.Content), 4096)
+		for {
+			doc := map[string]interface{}{}
+			if err := decoder.Decode(&doc); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("failed decoding %s: %w", f.Path, err)
+			}
+			if len(doc) > 0 {
+				out = append(out, doc)
+			}
+		}
+	}
+	return out, nil
+}
+
+func kustomization(resources []string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  resources,
+	}
+}
+
+func metadata(doc map[string]interface{}) map[string]interface{} {
+	m, _ := doc["metadata"].(map[string]interface{})
+	return m
+}
+
+func name(doc map[string]interface{}) string {
+	n, _ := metadata(doc)["name"].(string)
+	return n
+}
+
+func key(doc map[string]interface{}) string {
+	return fmt.Sprintf("%s/%s/%s/%s", doc["apiVersion"], doc["kind"], metadata(doc)["namespace"], name(doc))
+}
+
+// withIdentity adds to the patch what's needed for kustomize to find the object to patch.
+func withIdentity(doc map[string]interface{}, patch map[string]interface{}) map[string]interface{} {
+	meta := map[string]interface{}{"name": name(doc)}
+	if ns, ok := metadata(doc)["namespace"]; ok {
+		meta["namespace"] = ns
+	}
+	if m, ok := patch["metadata"].(map[string]interface{}); ok {
+		for k, v := range m {
+			meta[k] = v
+		}
+	}
+	patch["apiVersion"] = doc["apiVersion"]
+	patch["kind"] = doc["kind"]
+	patch["metadata"] = meta
+	return patch
+}
+
+// diff returns a merge patch to go from base to target, lists are replaced entirely and removed keys are set to null.
+func diff(base map[string]interface{}, target map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range target {
+		bv, exists := base[k]
+		if !exists {
+			out[k] = v
+			continue
+		}
+		bm, baseIsMap := bv.(map[string]interface{})
+		tm, targetIsMap := v.(map[string]interface{})
+		if baseIsMap && targetIsMap {
+			if d := diff(bm, tm); len(d) > 0 {
+				out[k] = d
+			}
+			continue
+		}
+		if !reflect.DeepEqual(bv, v) {
+			out[k] = v
+		}
+	}
+	for k := range base {
+		if _, exists := target[k]; !exists {
+			out[k] = nil
+		}
+	}
+	return out
+}
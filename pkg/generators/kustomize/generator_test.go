@@ -0,0 +1,58 @@
+package kustomize_test
+
+import (
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/linkerd"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/kustomize"
+	"strings"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	generator, err := kustomize.NewGenerator("foo", append(apiplay.GeneratorOpts(), k8s.WithNamespace("foo")),
+		kustomize.WithMeshOverlay(linkerd.GeneratorOpts(linkerd.DefaultConfig())...),
+		kustomize.WithScaledDownOverlay(1),
+	)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	files, err := generator.Files(apis.ServiceGraph{
+		Services: []apis.Service{
+			{Replicas: 2, Edges: apis.EdgesTo(1), Idx: 0, Name: "frontend"},
+			{Replicas: 3, Idx: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	contents := map[string]string{}
+	for _, f := range files {
+		contents[f.Path] = string(f.Content)
+	}
+	for path, expected := range map[string][]string{
+		"foo/base/kustomization.yaml":                        {"kind: Kustomization", "resources:\n- common.yaml\n- frontend.yaml\n- api-play-001.yaml\n"},
+		"foo/base/common.yaml":                               {"kind: Namespace"},
+		"foo/base/frontend.yaml":                             {"kind: Deployment", "replicas: 2", "kind: ConfigMap"},
+		"foo/base/api-play-001.yaml":                         {"replicas: 3"},
+		"foo/overlays/mesh-enabled/kustomization.yaml":       {"- ../../base\n- mesh.yaml\n", "- path: frontend-deployment.yaml\n", "- path: api-play-001-deployment.yaml\n"},
+		"foo/overlays/mesh-enabled/mesh.yaml":                {"kind: ServiceAccount", "kind: Server", "kind: AuthorizationPolicy"},
+		"foo/overlays/mesh-enabled/frontend-deployment.yaml": {"kind: Deployment", "name: frontend", "namespace: foo", "linkerd.io/inject: enabled", "serviceAccountName: frontend"},
+		"foo/overlays/scaled-down/kustomization.yaml":        {"replicas:\n- count: 1\n  name: frontend\n- count: 1\n  name: api-play-001\n"},
+	} {
+		content, exists := contents[path]
+		if !exists {
+			t.Errorf("missing file: %s", path)
+			continue
+		}
+		for _, e := range expected {
+			if !strings.Contains(content, e) {
+				t.Errorf("expected %s to contain '%s' got:\n%s", path, e, content)
+			}
+		}
+	}
+	if strings.Contains(contents["foo/overlays/mesh-enabled/frontend-deployment.yaml"], "image:") {
+		t.Errorf("patch should only contain what changed got:\n%s", contents["foo/overlays/mesh-enabled/frontend-deployment.yaml"])
+	}
+}
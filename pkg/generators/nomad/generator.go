@@ -0,0 +1,334 @@
+package nomad
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"io"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Config struct {
+	// Datacenters where the job runs.
+	Datacenters []string
+	// UpstreamPortBase the upstream to service `idx` is bound on localhost on port `UpstreamPortBase + idx`.
+	UpstreamPortBase int
+	// JSON outputs the job in the JSON format of the Nomad API instead of HCL.
+	JSON bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Datacenters:      []string{"dc1"},
+		UpstreamPortBase: 20000,
+	}
+}
+
+// Generator outputs a Nomad job with a task group per service registered in Consul and calls going through Consul Connect upstreams.
+// It reuses the k8s generator of an app (api-play or fake-service) and translates its pod template and config maps.
+type Generator struct {
+	conf    Config
+	k8sOpts []k8s.Option
+	k8s     k8s.Generator
+}
+
+// NewGenerator creates a Nomad generator from the options of k8s.NewGenerator.
+func NewGenerator(conf Config, k8sOpts ...k8s.Option) (*Generator, error) {
+	if conf.UpstreamPortBase <= 0 || conf.UpstreamPortBase > 65535 {
+		return nil, fmt.Errorf("invalid upstream port base: %d", conf.UpstreamPortBase)
+	}
+	k8sGenerator, err := k8s.NewGenerator(k8sOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{conf: conf, k8sOpts: k8sOpts, k8s: k8sGenerator}, nil
+}
+
+type job struct {
+	name   string
+	groups []group
+}
+
+type group struct {
+	name      string
+	count     int
+	port      int
+	upstreams []upstream
+	image     string
+	args      []string
+	env       map[string]string
+	files     []file
+}
+
+type upstream struct {
+	name string
+	port int
+}
+
+type file struct {
+	content string
+	target  string
+}
+
+func (g *Generator) Apply(writer io.Writer, graph apis.ServiceGraph) error {
+	j, err := g.job(graph)
+	if err != nil {
+		return err
+	}
+	if g.conf.JSON {
+		return g.writeJSON(writer, j)
+	}
+	return g.writeHCL(writer, j)
+}
+
+func (g *Generator) job(graph apis.ServiceGraph) (job, error) {
+	formatters := g.k8s.Settings.Formatters.ForGraph(graph)
+	// Calls go through the upstreams of the sidecar which listen on localhost.
+	connectFormatters := k8s.Formatters{
+		BaseName: formatters.BaseName,
+		Name:     formatters.Name,
+		Url: func(idx int, port int) string {
+			return fmt.Sprintf("http://127.0.0.1:%d", g.upstreamPort(idx))
+		},
+	}
+	k8sGenerator, err := k8s.NewGenerator(append(append([]k8s.Option{}, g.k8sOpts...), k8s.WithFormatters(connectFormatters))...)
+	if err != nil {
+		return job{}, err
+	}
+	name := g.k8s.Settings.Namespace
+	if name == "" {
+		name = formatters.BaseName
+	}
+	out := job{name: name}
+	for _, svc := range graph.Services {
+		objs, _, err := k8sGenerator.WorkloadGenerator.Apply(svc)
+		if err != nil {
+			return job{}, err
+		}
+		var podSpec *v1.PodSpec
+		configMaps := map[string]map[string]string{}
+		for _, obj := range objs {
+			switch o := obj.(type) {
+			case *appsv1.Deployment:
+				podSpec = &o.Spec.Template.Spec
+			case *appsv1.StatefulSet:
+				podSpec = &o.Spec.Template.Spec
+			case *v1.ConfigMap:
+				configMaps[o.Name] = o.Data
+			}
+		}
+		if podSpec == nil || len(podSpec.Containers) == 0 {
+			return job{}, errors.New("no workload generated for service")
+		}
+		container := podSpec.Containers[0]
+		grp := group{
+			name:  formatters.Name(svc.Idx),
+			count: svc.Replicas,
+			port:  g.k8s.Settings.Port,
+			image: container.Image,
+			args:  container.Args,
+			env:   map[string]string{},
+		}
+		for _, e := range container.Env {
+			grp.env[e.Name] = e.Value
+		}
+		for _, mount := range container.VolumeMounts {
+			for _, volume := range podSpec.Volumes {
+				if volume.Name != mount.Name || volume.ConfigMap == nil {
+					continue
+				}
+				data := configMaps[volume.ConfigMap.Name]
+				keys := make([]string, 0, len(data))
+				for k := range data {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					if data[k] != "" {
+						grp.files = append(grp.files, file{content: data[k], target: path.Join(mount.MountPath, k)})
+					}
+				}
+			}
+		}
+		seen := map[int]bool{}
+		for _, e := range svc.Edges {
+			if !seen[e.Target] {
+				seen[e.Target] = true
+				grp.upstreams = append(grp.upstreams, upstream{name: formatters.Name(e.Target), port: g.upstreamPort(e.Target)})
+			}
+		}
+		out.groups = append(out.groups, grp)
+	}
+	return out, nil
+}
+
+func (g *Generator) upstreamPort(idx int) int {
+	return g.conf.UpstreamPortBase + idx
+}
+
+func (f file) localPath() string {
+	return path.Join("local", path.Base(f.target))
+}
+
+// rightDelimiter the closing delimiter of templates, there's nothing to close as the left delimiter never appears in the content.
+const rightDelimiter = "%]"
+
+// leftDelimiter a template delimiter which doesn't appear in the content so consul-template renders it as is.
+func (f file) leftDelimiter() string {
+	return unusedToken(f.content, "[%")
+}
+
+func (g *Generator) writeHCL(writer io.Writer, j job) error {
+	b := &strings.Builder{}
+	var datacenters []string
+	for _, dc := range g.conf.Datacenters {
+		datacenters = append(datacenters, hclString(dc))
+	}
+	fmt.Fprintf(b, "job %s {\n", hclString(j.name))
+	fmt.Fprintf(b, "  datacenters = [%s]\n", strings.Join(datacenters, ", "))
+	fmt.Fprintf(b, "  type        = \"service\"\n")
+	for _, grp := range j.groups {
+		fmt.Fprintf(b, "\n  group %s {\n", hclString(grp.name))
+		fmt.Fprintf(b, "    count = %d\n\n", grp.count)
+		fmt.Fprintf(b, "    network {\n      mode = \"bridge\"\n    }\n\n")
+		fmt.Fprintf(b, "    service {\n")
+		fmt.Fprintf(b, "      name = %s\n", hclString(grp.name))
+		fmt.Fprintf(b, "      port = \"%d\"\n\n", grp.port)
+		fmt.Fprintf(b, "      check {\n        type     = \"http\"\n        path     = \"/health\"\n        interval = \"10s\"\n        timeout  = \"2s\"\n        expose   = true\n      }\n\n")
+		fmt.Fprintf(b, "      connect {\n        sidecar_service {")
+		if len(grp.upstreams) == 0 {
+			fmt.Fprintf(b, "}\n")
+		} else {
+			fmt.Fprintf(b, "\n          proxy {\n")
+			for _, u := range grp.upstreams {
+				fmt.Fprintf(b, "            upstreams {\n              destination_name = %s\n              local_bind_port  = %d\n            }\n", hclString(u.name), u.port)
+			}
+			fmt.Fprintf(b, "          }\n        }\n")
+		}
+		fmt.Fprintf(b, "      }\n    }\n\n")
+		fmt.Fprintf(b, "    task \"app\" {\n      driver = \"docker\"\n\n")
+		fmt.Fprintf(b, "      config {\n        image = %s\n", hclString(grp.image))
+		if len(grp.args) > 0 {
+			var args []string
+			for _, a := range grp.args {
+				args = append(args, hclString(a))
+			}
+			fmt.Fprintf(b, "        args  = [%s]\n", strings.Join(args, ", "))
+		}
+		for _, f := range grp.files {
+			fmt.Fprintf(b, "\n        mount {\n          type   = \"bind\"\n          source = %s\n          target = %s\n        }\n", hclString(f.localPath()), hclString(f.target))
+		}
+		fmt.Fprintf(b, "      }\n")
+		if len(grp.env) > 0 {
+			keys := make([]string, 0, len(grp.env))
+			for k := range grp.env {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fmt.Fprintf(b, "\n      env {\n")
+			for _, k := range keys {
+				fmt.Fprintf(b, "        %s = %s\n", k, hclString(grp.env[k]))
+			}
+			fmt.Fprintf(b, "      }\n")
+		}
+		for _, f := range grp.files {
+			marker := unusedToken(f.content, "EOT")
+			fmt.Fprintf(b, "\n      template {\n        destination     = %s\n        left_delimiter  = %s\n        right_delimiter = %s\n        data            = <<%s\n%s\n%s\n      }\n",
+				hclString(f.localPath()), hclString(f.leftDelimiter()), hclString(rightDelimiter), marker, hclEscape(f.content), marker)
+		}
+		fmt.Fprintf(b, "    }\n  }\n")
+	}
+	fmt.Fprintf(b, "}\n")
+	_, err := io.WriteString(writer, b.String())
+	return err
+}
+
+func (g *Generator) writeJSON(writer io.Writer, j job) error {
+	var groups []interface{}
+	for _, grp := range j.groups {
+		var upstreams []interface{}
+		for _, u := range grp.upstreams {
+			upstreams = append(upstreams, map[string]interface{}{"DestinationName": u.name, "LocalBindPort": u.port})
+		}
+		sidecar := map[string]interface{}{}
+		if len(upstreams) > 0 {
+			sidecar["Proxy"] = map[string]interface{}{"Upstreams": upstreams}
+		}
+		config := map[string]interface{}{"image": grp.image}
+		if len(grp.args) > 0 {
+			config["args"] = grp.args
+		}
+		var mounts, templates []interface{}
+		for _, f := range grp.files {
+			mounts = append(mounts, map[string]interface{}{"type": "bind", "source": f.localPath(), "target": f.target})
+			templates = append(templates, map[string]interface{}{"DestPath": f.localPath(), "EmbeddedTmpl": f.content, "LeftDelim": f.leftDelimiter(), "RightDelim": rightDelimiter})
+		}
+		if len(mounts) > 0 {
+			config["mount"] = mounts
+		}
+		task := map[string]interface{}{
+			"Name":   "app",
+			"Driver": "docker",
+			"Config": config,
+		}
+		if len(grp.env) > 0 {
+			task["Env"] = grp.env
+		}
+		if len(templates) > 0 {
+			task["Templates"] = templates
+		}
+		groups = append(groups, map[string]interface{}{
+			"Name":     grp.name,
+			"Count":    grp.count,
+			"Networks": []interface{}{map[string]interface{}{"Mode": "bridge"}},
+			"Services": []interface{}{map[string]interface{}{
+				"Name":      grp.name,
+				"PortLabel": strconv.Itoa(grp.port),
+				"Checks": []interface{}{map[string]interface{}{
+					"Type": "http", "Path": "/health", "Interval": 10_000_000_000, "Timeout": 2_000_000_000, "Expose": true,
+				}},
+				"Connect": map[string]interface{}{"SidecarService": sidecar},
+			}},
+			"Tasks": []interface{}{task},
+		})
+	}
+	res, err := json.MarshalIndent(map[string]interface{}{
+		"Job": map[string]interface{}{
+			"ID":          j.name,
+			"Name":        j.name,
+			"Type":        "service",
+			"Datacenters": g.conf.Datacenters,
+			"TaskGroups":  groups,
+		},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(res, '\n'))
+	return err
+}
+
+// hclEscape escapes the sequences HCL would interpret as interpolations or directives.
+func hclEscape(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(s)
+}
+
+// unusedToken returns the token, followed by a number if needed, so that it doesn't appear in s.
+func unusedToken(s string, token string) string {
+	out := token
+	for i := 1; strings.Contains(s, out); i++ {
+		out = token + strconv.Itoa(i)
+	}
+	return out
+}
+
+func hclString(s string) string {
+	return hclEscape(strconv.Quote(s))
+}
@@ -0,0 +1,136 @@
+package nomad_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/fakeservice"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/nomad"
+	"strings"
+	"testing"
+)
+
+var graph = apis.ServiceGraph{
+	Services: []apis.Service{
+		{Replicas: 2, Edges: apis.EdgesTo(1, 2), Idx: 0, Name: "frontend"},
+		{Replicas: 3, Edges: apis.EdgesTo(2), Idx: 1},
+		{Replicas: 1, Idx: 2},
+	},
+}
+
+func TestHCL(t *testing.T) {
+	generator, err := nomad.NewGenerator(nomad.DefaultConfig(), append(apiplay.GeneratorOpts(), k8s.WithNamespace("foo"))...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := generator.Apply(buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"job \"foo\" {\n  datacenters = [\"dc1\"]\n",
+		"  group \"frontend\" {\n    count = 2\n",
+		"  group \"api-play-001\" {\n    count = 3\n",
+		"              destination_name = \"api-play-001\"\n              local_bind_port  = 20001\n",
+		"              destination_name = \"api-play-002\"\n              local_bind_port  = 20002\n",
+		"http://127.0.0.1:20002/api/dynamic/microservice_mesh",
+		"      port = \"8080\"\n",
+		"        args  = [\"-config-file\", \"/etc/config/config.yaml\"]\n",
+		"          source = \"local/config.yaml\"\n          target = \"/etc/config/config.yaml\"\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain '%s'", expected)
+		}
+	}
+	if got := strings.Count(out, "  group "); got != 3 {
+		t.Errorf("expected 3 groups got: %d", got)
+	}
+	println(out)
+}
+
+func TestJSON(t *testing.T) {
+	conf := nomad.DefaultConfig()
+	conf.JSON = true
+	generator, err := nomad.NewGenerator(conf, fakeservice.GeneratorOpts()...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := generator.Apply(buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	res := struct {
+		Job struct {
+			TaskGroups []struct {
+				Name  string
+				Count int
+				Tasks []struct {
+					Env map[string]string
+				}
+			}
+		}
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatal("failed", err)
+	}
+	if len(res.Job.TaskGroups) != 3 || res.Job.TaskGroups[1].Count != 3 {
+		t.Fatalf("unexpected task groups: %+v", res.Job.TaskGroups)
+	}
+	if uris := res.Job.TaskGroups[0].Tasks[0].Env["UPSTREAM_URIS"]; uris != "http://127.0.0.1:20001,http://127.0.0.1:20002" {
+		t.Errorf("unexpected UPSTREAM_URIS: %s", uris)
+	}
+}
+
+func TestTemplateEscaping(t *testing.T) {
+	content := "{{ env \"HOME\" }}\nEOT\n${foo} [%"
+	opts := append(apiplay.GeneratorOpts(), k8s.WithConfigMapGenerator(func(f k8s.Formatters, svc apis.Service) (string, error) {
+		return content, nil
+	}))
+	generator, err := nomad.NewGenerator(nomad.DefaultConfig(), opts...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := generator.Apply(buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	out := buf.String()
+	expected := "        left_delimiter  = \"[%1\"\n        right_delimiter = \"%]\"\n        data            = <<EOT1\n{{ env \"HOME\" }}\nEOT\n$${foo} [%\nEOT1\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected output to contain '%s' got:\n%s", expected, out)
+	}
+
+	conf := nomad.DefaultConfig()
+	conf.JSON = true
+	generator, err = nomad.NewGenerator(conf, opts...)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	buf.Reset()
+	if err := generator.Apply(buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	res := struct {
+		Job struct {
+			TaskGroups []struct {
+				Tasks []struct {
+					Templates []struct {
+						EmbeddedTmpl string
+						LeftDelim    string
+						RightDelim   string
+					}
+				}
+			}
+		}
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatal("failed", err)
+	}
+	tmpl := res.Job.TaskGroups[0].Tasks[0].Templates[0]
+	if tmpl.EmbeddedTmpl != content || tmpl.LeftDelim != "[%1" || tmpl.RightDelim != "%]" {
+		t.Errorf("unexpected template: %+v", tmpl)
+	}
+}
@@ -0,0 +1,230 @@
+package importers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"math"
+	"sort"
+	"strings"
+)
+
+type Config struct {
+	// Anonymize replaces the names of the services with `svc-<idx>`.
+	Anonymize bool
+	// Replicas the number of replicas of each service.
+	Replicas int
+	// MaxWeight the maximum weight of an edge.
+	MaxWeight int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Replicas:  1,
+		MaxWeight: 10,
+	}
+}
+
+// Call calls observed from a service to another one.
+type Call struct {
+	From string
+	To   string
+	// Count the number of calls observed, it can be a rate (and therefore fractional).
+	Count float64
+	// LatencyMs the latency observed on the calls (0 if unknown).
+	LatencyMs int
+	// ErrorRate the ratio of calls which failed (between 0 and 1).
+	ErrorRate float64
+}
+
+// Result the graph built from the calls and what had to be dropped to make it valid.
+type Result struct {
+	Graph apis.ServiceGraph
+	// Dropped the calls removed because they were creating a cycle or were calling the service itself.
+	Dropped []Call
+}
+
+// BuildGraph builds a ServiceGraph from observed calls:
+//   - calls between the same services are merged (latencies and error rates are averaged weighted by count),
+//   - cycles are broken by dropping the calls with the lowest count (ties are broken by name) so the result is deterministic,
+//   - the weight of an edge is the number of calls for each request received by the caller (capped by MaxWeight),
+//     requests received are the calls to the service or, for entry services, the count of their least called edge,
+//   - services are ordered so that callers come before their callees.
+func BuildGraph(calls []Call, conf Config) (Result, error) {
+	if conf.Replicas <= 0 {
+		return Result{}, errors.New("replicas must be strictly positive")
+	}
+	if conf.MaxWeight <= 0 {
+		return Result{}, errors.New("maxWeight must be strictly positive")
+	}
+	out := Result{}
+	merged := map[[2]string]*Call{}
+	services := map[string]struct{}{}
+	latencies := map[[2]string]float64{}
+	errorRates := map[[2]string]float64{}
+	for _, c := range calls {
+		if c.From == "" || c.To == "" {
+			return Result{}, fmt.Errorf("call with an empty service name: '%s' -> '%s'", c.From, c.To)
+		}
+		if c.Count < 0 {
+			return Result{}, fmt.Errorf("negative count for call %s -> %s", c.From, c.To)
+		}
+		services[c.From] = struct{}{}
+		services[c.To] = struct{}{}
+		if c.From == c.To {
+			out.Dropped = append(out.Dropped, c)
+			continue
+		}
+		key := [2]string{c.From, c.To}
+		m, exists := merged[key]
+		if !exists {
+			m = &Call{From: c.From, To: c.To}
+			merged[key] = m
+		}
+		// Keep the sums weighted by count and divide once everything is merged.
+		m.Count += c.Count
+		latencies[key] += float64(c.LatencyMs) * c.Count
+		errorRates[key] += c.ErrorRate * c.Count
+	}
+	if len(services) == 0 {
+		return Result{}, errors.New("no calls found")
+	}
+	var sorted []Call
+	for k, c := range merged {
+		if c.Count > 0 {
+			c.LatencyMs = int(math.Round(latencies[k] / c.Count))
+			c.ErrorRate = math.Round(errorRates[k]/c.Count*1000) / 1000
+		}
+		sorted = append(sorted, *c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		if sorted[i].From != sorted[j].From {
+			return sorted[i].From < sorted[j].From
+		}
+		return sorted[i].To < sorted[j].To
+	})
+	// Add calls from the most to the least frequent and drop the ones which would create a cycle.
+	callees := map[string][]string{}
+	var reaches func(from, to string, visited map[string]bool) bool
+	reaches = func(from, to string, visited map[string]bool) bool {
+		if from == to {
+			return true
+		}
+		visited[from] = true
+		for _, next := range callees[from] {
+			if !visited[next] && reaches(next, to, visited) {
+				return true
+			}
+		}
+		return false
+	}
+	var kept []Call
+	for _, c := range sorted {
+		if reaches(c.To, c.From, map[string]bool{}) {
+			out.Dropped = append(out.Dropped, c)
+			continue
+		}
+		callees[c.From] = append(callees[c.From], c.To)
+		kept = append(kept, c)
+	}
+
+	order := topologicalOrder(services, kept)
+	idx := map[string]int{}
+	for i, name := range order {
+		idx[name] = i
+	}
+	received := map[string]float64{}
+	minSent := map[string]float64{}
+	for _, c := range kept {
+		received[c.To] += c.Count
+		if m, exists := minSent[c.From]; !exists || c.Count < m {
+			minSent[c.From] = c.Count
+		}
+	}
+	names := uniqueNames(order, conf.Anonymize)
+	graph := apis.ServiceGraph{}
+	for i := range order {
+		graph.Services = append(graph.Services, apis.Service{Idx: i, Name: names[i], Replicas: conf.Replicas})
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		if idx[kept[i].From] != idx[kept[j].From] {
+			return idx[kept[i].From] < idx[kept[j].From]
+		}
+		return idx[kept[i].To] < idx[kept[j].To]
+	})
+	for _, c := range kept {
+		requests := received[c.From]
+		if requests == 0 {
+			requests = minSent[c.From]
+		}
+		weight := 1
+		if requests > 0 {
+			weight = int(math.Round(c.Count / requests))
+		}
+		weight = max(1, min(weight, conf.MaxWeight))
+		edge := apis.Edge{Target: idx[c.To], LatencyMs: c.LatencyMs, ErrorRate: c.ErrorRate}
+		if weight > 1 {
+			edge.Weight = weight
+		}
+		from := idx[c.From]
+		graph.Services[from].Edges = append(graph.Services[from].Edges, edge)
+	}
+	out.Graph = graph
+	return out, nil
+}
+
+// topologicalOrder orders services so callers come first, picking the first service alphabetically when there's a choice.
+func topologicalOrder(services map[string]struct{}, calls []Call) []string {
+	inDegree := map[string]int{}
+	callees := map[string][]string{}
+	for _, c := range calls {
+		inDegree[c.To]++
+		callees[c.From] = append(callees[c.From], c.To)
+	}
+	var ready []string
+	for s := range services {
+		if inDegree[s] == 0 {
+			ready = append(ready, s)
+		}
+	}
+	var out []string
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		next := ready[0]
+		ready = ready[1:]
+		out = append(out, next)
+		for _, c := range callees[next] {
+			inDegree[c]--
+			if inDegree[c] == 0 {
+				ready = append(ready, c)
+			}
+		}
+	}
+	return out
+}
+
+// uniqueNames turns names into unique DNS-1123 labels.
+func uniqueNames(names []string, anonymize bool) []string {
+	out := make([]string, len(names))
+	used := map[string]bool{}
+	for i, n := range names {
+		name := fmt.Sprintf("svc-%03d", i)
+		if !anonymize {
+			name = apis.SanitizeName(n)
+			if name == "" {
+				name = fmt.Sprintf("svc-%03d", i)
+			}
+		}
+		candidate := name
+		for suffix := 2; used[candidate]; suffix++ {
+			s := fmt.Sprintf("-%d", suffix)
+			candidate = strings.TrimRight(name[:min(len(name), 63-len(s))], "-") + s
+		}
+		used[candidate] = true
+		out[i] = candidate
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package importers_test
+
+import (
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers"
+	"reflect"
+	"testing"
+)
+
+var calls = []importers.Call{
+	{From: "frontend", To: "cart", Count: 60},
+	{From: "frontend", To: "cart", Count: 40},
+	{From: "frontend", To: "catalog", Count: 200},
+	{From: "cart", To: "db", Count: 300},
+	{From: "db", To: "cart", Count: 5},
+	{From: "catalog", To: "catalog", Count: 10},
+}
+
+func TestBuildGraph(t *testing.T) {
+	res, err := importers.BuildGraph(calls, importers.DefaultConfig())
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	expected := []apis.Service{
+		{Idx: 0, Name: "frontend", Replicas: 1, Edges: []apis.Edge{{Target: 1}, {Target: 2, Weight: 2}}},
+		{Idx: 1, Name: "cart", Replicas: 1, Edges: []apis.Edge{{Target: 3, Weight: 3}}},
+		{Idx: 2, Name: "catalog", Replicas: 1},
+		{Idx: 3, Name: "db", Replicas: 1},
+	}
+	if !reflect.DeepEqual(res.Graph.Services, expected) {
+		t.Errorf("unexpected services: %+v", res.Graph.Services)
+	}
+	if !reflect.DeepEqual(res.Dropped, []importers.Call{{From: "catalog", To: "catalog", Count: 10}, {From: "db", To: "cart", Count: 5}}) {
+		t.Errorf("unexpected dropped calls: %+v", res.Dropped)
+	}
+	if err := res.Graph.Validate(); err != nil {
+		t.Errorf("invalid graph: %s", err)
+	}
+}
+
+func TestBuildGraphOptions(t *testing.T) {
+	conf := importers.DefaultConfig()
+	conf.Anonymize = true
+	conf.MaxWeight = 2
+	conf.Replicas = 3
+	res, err := importers.BuildGraph(calls, conf)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	if res.Graph.Services[1].Name != "svc-001" || res.Graph.Services[1].Edges[0].Weight != 2 || res.Graph.Services[1].Replicas != 3 {
+		t.Errorf("unexpected service: %+v", res.Graph.Services[1])
+	}
+
+	if _, err := importers.BuildGraph(nil, conf); err == nil {
+		t.Errorf("expected an error without calls")
+	}
+}
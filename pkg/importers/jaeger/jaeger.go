@@ -0,0 +1,43 @@
+package jaeger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers"
+)
+
+// Dependency a link between services as returned by the dependencies API of Jaeger.
+type Dependency struct {
+	Parent    string `json:"parent"`
+	Child     string `json:"child"`
+	CallCount int64  `json:"callCount"`
+}
+
+// Import reads the dependencies of Jaeger either as returned by `/api/dependencies` (`{"data": [...]}`) or as a plain list.
+func Import(b []byte, conf importers.Config) (apis.ServiceGraph, error) {
+	var dependencies []Dependency
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		res := struct {
+			Data []Dependency `json:"data"`
+		}{}
+		if err := json.Unmarshal(trimmed, &res); err != nil {
+			return apis.ServiceGraph{}, fmt.Errorf("failed to parse jaeger dependencies: %w", err)
+		}
+		dependencies = res.Data
+	} else if err := json.Unmarshal(trimmed, &dependencies); err != nil {
+		return apis.ServiceGraph{}, fmt.Errorf("failed to parse jaeger dependencies: %w", err)
+	}
+	var calls []importers.Call
+	for _, d := range dependencies {
+		calls = append(calls, importers.Call{From: d.Parent, To: d.Child, Count: float64(d.CallCount)})
+	}
+	res, err := importers.BuildGraph(calls, conf)
+	if err != nil {
+		return apis.ServiceGraph{}, err
+	}
+	res.Graph.GenerationParams = fmt.Sprintf("name:jaeger,dependencies:%d,droppedEdges:%d,anonymized:%t", len(dependencies), len(res.Dropped), conf.Anonymize)
+	return res.Graph, nil
+}
@@ -0,0 +1,40 @@
+package jaeger_test
+
+import (
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers/jaeger"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	for name, input := range map[string]string{
+		"api":  `{"data": [{"parent": "frontend", "child": "Cart", "callCount": 10}, {"parent": "Cart", "child": "redis", "callCount": 30}, {"parent": "redis", "child": "frontend", "callCount": 1}], "total": 3}`,
+		"list": `[{"parent": "frontend", "child": "Cart", "callCount": 10}, {"parent": "Cart", "child": "redis", "callCount": 30}, {"parent": "redis", "child": "frontend", "callCount": 1}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			graph, err := jaeger.Import([]byte(input), importers.DefaultConfig())
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			if err := graph.Validate(); err != nil {
+				t.Fatal("invalid graph", err)
+			}
+			if len(graph.Services) != 3 || graph.Services[0].Name != "frontend" || graph.Services[1].Name != "cart" {
+				t.Fatalf("unexpected services: %+v", graph.Services)
+			}
+			if e := graph.Services[1].Edges; len(e) != 1 || e[0].Target != 2 || e[0].Weight != 3 {
+				t.Errorf("unexpected edges: %+v", e)
+			}
+			if len(graph.Services[2].Edges) != 0 {
+				t.Errorf("expected the cycle to be broken: %+v", graph.Services[2])
+			}
+			if graph.GenerationParams != "name:jaeger,dependencies:3,droppedEdges:1,anonymized:false" {
+				t.Errorf("unexpected generation params: %s", graph.GenerationParams)
+			}
+		})
+	}
+
+	if _, err := jaeger.Import([]byte("not json"), importers.DefaultConfig()); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,285 @@
+package manifests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"io"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"math"
+	"net/url"
+	"sigs.k8s.io/yaml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// baseNames the base names used by the formatters of the apps, workloads named `<baseName>-<idx>` are services without a name.
+var baseNames = []string{"api-play", "fake-service"}
+
+// workload a Deployment or StatefulSet of a service.
+type workload struct {
+	namespace string
+	name      string
+	labels    map[string]string
+	replicas  *int32
+	template  v1.PodTemplateSpec
+}
+
+type config struct {
+	Apis []struct {
+		Path string `json:"path"`
+		Conf struct {
+			Call []call `json:"call"`
+		} `json:"conf"`
+	} `json:"apis"`
+}
+
+type call struct {
+	Url           string  `json:"url"`
+	LatencyMillis int     `json:"latency_millis"`
+	ErrorRate     float64 `json:"error_rate"`
+	TimeoutMillis int     `json:"timeout_millis"`
+	Retries       int     `json:"retries"`
+}
+
+// Import reads a stream of kubernetes manifests and rebuilds the ServiceGraph of the services run with api-play or fake-service:
+//   - services are the Deployments and StatefulSets in the order of the stream with their replicas and `role`, `tier` and other labels,
+//   - api-play calls are read from the `config.yaml` of the ConfigMap mounted in the pod,
+//   - fake-service calls are read from the `UPSTREAM_URIS` environment variable, as latency, errors and timeouts are set on the caller
+//     they are only set on the edge when the service has a single upstream (timeouts are set on all edges).
+//
+// Repeated consecutive calls to the same service are merged in a single edge with a weight.
+func Import(b []byte) (apis.ServiceGraph, error) {
+	var workloads []workload
+	configMaps := map[string]map[string]string{}
+	decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+	for {
+		obj := unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return apis.ServiceGraph{}, fmt.Errorf("failed to parse manifests: %w", err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		var err error
+		switch obj.GroupVersionKind().GroupKind().String() {
+		case "Deployment.apps":
+			d := appsv1.Deployment{}
+			if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &d); err == nil {
+				workloads = append(workloads, workload{namespace: d.Namespace, name: d.Name, labels: d.Labels, replicas: d.Spec.Replicas, template: d.Spec.Template})
+			}
+		case "StatefulSet.apps":
+			s := appsv1.StatefulSet{}
+			if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &s); err == nil {
+				workloads = append(workloads, workload{namespace: s.Namespace, name: s.Name, labels: s.Labels, replicas: s.Spec.Replicas, template: s.Spec.Template})
+			}
+		case "ConfigMap":
+			cm := v1.ConfigMap{}
+			if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &cm); err == nil {
+				configMaps[cm.Namespace+"/"+cm.Name] = cm.Data
+			}
+		}
+		if err != nil {
+			return apis.ServiceGraph{}, fmt.Errorf("invalid %s '%s': %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+
+	// Only keep the workloads of the apps.
+	var services []workload
+	for _, w := range workloads {
+		if len(w.template.Spec.Containers) == 0 {
+			continue
+		}
+		if _, ok := envVar(w.template.Spec.Containers[0], "UPSTREAM_URIS"); ok || appConfig(w, configMaps) != nil {
+			services = append(services, w)
+		}
+	}
+	if len(services) == 0 {
+		return apis.ServiceGraph{}, errors.New("no Deployment or StatefulSet of api-play or fake-service found")
+	}
+	idx := map[string]int{}
+	for i, w := range services {
+		if _, exists := idx[w.name]; exists {
+			return apis.ServiceGraph{}, fmt.Errorf("multiple workloads named '%s'", w.name)
+		}
+		idx[w.name] = i
+	}
+
+	out := apis.ServiceGraph{GenerationParams: fmt.Sprintf("name:k8s,workloads:%d", len(services))}
+	for i, w := range services {
+		svc := apis.Service{Idx: i, Replicas: 1}
+		if w.replicas != nil {
+			svc.Replicas = int(*w.replicas)
+		}
+		if !isDefaultName(w.name, i) {
+			svc.Name = w.name
+		}
+		for k, v := range w.labels {
+			switch k {
+			case "app":
+			case "role":
+				svc.Role = v
+			case "tier":
+				svc.Tier = v
+			default:
+				if svc.Labels == nil {
+					svc.Labels = map[string]string{}
+				}
+				svc.Labels[k] = v
+			}
+		}
+		var err error
+		if conf := appConfig(w, configMaps); conf != nil {
+			svc.Edges, err = apiPlayEdges(conf, idx)
+		} else {
+			svc.Edges, err = fakeServiceEdges(w.template.Spec.Containers[0], idx)
+		}
+		if err != nil {
+			return apis.ServiceGraph{}, fmt.Errorf("invalid calls for workload '%s': %w", w.name, err)
+		}
+		out.Services = append(out.Services, svc)
+	}
+	if err := out.Validate(); err != nil {
+		return apis.ServiceGraph{}, err
+	}
+	return out, nil
+}
+
+func isDefaultName(name string, idx int) bool {
+	for _, base := range baseNames {
+		if name == fmt.Sprintf("%s-%03d", base, idx) {
+			return true
+		}
+	}
+	return false
+}
+
+func envVar(container v1.Container, name string) (string, bool) {
+	for _, e := range container.Env {
+		if e.Name == name {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+// appConfig returns the api-play config of a workload (nil if it doesn't mount one).
+func appConfig(w workload, configMaps map[string]map[string]string) *config {
+	for _, volume := range w.template.Spec.Volumes {
+		if volume.ConfigMap == nil {
+			continue
+		}
+		data := configMaps[w.namespace+"/"+volume.ConfigMap.Name]["config.yaml"]
+		if data == "" {
+			continue
+		}
+		conf := config{}
+		if err := yaml.Unmarshal([]byte(data), &conf); err != nil || len(conf.Apis) == 0 {
+			continue
+		}
+		return &conf
+	}
+	return nil
+}
+
+// target returns the idx of the service called by a url (`http://<name>[.<namespace>...]:<port>`).
+func target(rawUrl string, idx map[string]int) (int, string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return 0, "", err
+	}
+	name := strings.Split(u.Hostname(), ".")[0]
+	i, exists := idx[name]
+	if !exists {
+		return 0, "", fmt.Errorf("no workload for upstream '%s'", rawUrl)
+	}
+	return i, u.Scheme, nil
+}
+
+func apiPlayEdges(conf *config, idx map[string]int) ([]apis.Edge, error) {
+	var out []apis.Edge
+	var previous *call
+	for _, a := range conf.Apis {
+		if a.Path != "microservice_mesh" {
+			continue
+		}
+		for i, c := range a.Conf.Call {
+			if previous != nil && *previous == c {
+				out[len(out)-1].Weight = out[len(out)-1].GetWeight() + 1
+				continue
+			}
+			previous = &a.Conf.Call[i]
+			t, _, err := target(c.Url, idx)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, apis.Edge{Target: t, LatencyMs: c.LatencyMillis, ErrorRate: c.ErrorRate, TimeoutMs: c.TimeoutMillis, Retries: c.Retries})
+		}
+	}
+	return out, nil
+}
+
+func fakeServiceEdges(container v1.Container, idx map[string]int) ([]apis.Edge, error) {
+	uris, _ := envVar(container, "UPSTREAM_URIS")
+	var out []apis.Edge
+	previous := ""
+	for _, uri := range strings.Split(uris, ",") {
+		uri = strings.TrimSpace(uri)
+		if uri == "" {
+			continue
+		}
+		if uri == previous {
+			out[len(out)-1].Weight = out[len(out)-1].GetWeight() + 1
+			continue
+		}
+		previous = uri
+		t, scheme, err := target(uri, idx)
+		if err != nil {
+			return nil, err
+		}
+		edge := apis.Edge{Target: t}
+		if scheme == "grpc" {
+			edge.Protocol = apis.ProtocolGRPC
+		}
+		out = append(out, edge)
+	}
+	if v, ok := envVar(container, "HTTP_CLIENT_REQUEST_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HTTP_CLIENT_REQUEST_TIMEOUT: %w", err)
+		}
+		for i := range out {
+			out[i].TimeoutMs = int(timeout.Milliseconds())
+		}
+	}
+	if len(out) != 1 {
+		return out, nil
+	}
+	// With a single upstream the latency and errors of the caller are the ones of the edge.
+	weight := out[0].GetWeight()
+	if v, ok := envVar(container, "TIMING_50_PERCENTILE"); ok {
+		latency, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TIMING_50_PERCENTILE: %w", err)
+		}
+		out[0].LatencyMs = int(latency.Milliseconds()) / weight
+	}
+	if v, ok := envVar(container, "ERROR_RATE"); ok {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ERROR_RATE: %w", err)
+		}
+		// Each of the `weight` calls fails independently.
+		out[0].ErrorRate = math.Round((1-math.Pow(1-rate, 1/float64(weight)))*10000) / 10000
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package manifests_test
+
+import (
+	"bytes"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/apiplay"
+	"github.com/lahabana/microservice-mesh-generator/pkg/generators/k8s/fakeservice"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers/manifests"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts  []k8s.Option
+		graph apis.ServiceGraph
+	}{
+		"api-play": {
+			opts: append(apiplay.GeneratorOpts(), k8s.WithNamespace("mesh")),
+			graph: apis.ServiceGraph{Services: []apis.Service{
+				{Idx: 0, Name: "frontend", Replicas: 2, Role: "gateway", Tier: "edge", Labels: map[string]string{"team": "web"}, Edges: []apis.Edge{{Target: 1, Weight: 2, LatencyMs: 10, ErrorRate: 0.1, TimeoutMs: 200, Retries: 1}, {Target: 2}}},
+				{Idx: 1, Replicas: 3, Edges: []apis.Edge{{Target: 2, LatencyMs: 5}}},
+				{Idx: 2, Replicas: 1, Role: "database"},
+			}},
+		},
+		"fake-service as statefulsets": {
+			opts: append(fakeservice.GeneratorOpts(), k8s.WithNamespace("mesh"), k8s.AsStatefulSet()),
+			graph: apis.ServiceGraph{Services: []apis.Service{
+				{Idx: 0, Replicas: 2, Tier: "edge", Edges: []apis.Edge{{Target: 1, Protocol: apis.ProtocolGRPC, TimeoutMs: 500}, {Target: 2, Weight: 3, TimeoutMs: 500}}},
+				{Idx: 1, Name: "cart", Replicas: 1, Edges: []apis.Edge{{Target: 2, Weight: 2, LatencyMs: 20, ErrorRate: 0.05}}},
+				{Idx: 2, Replicas: 4},
+			}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			generator, err := k8s.NewGenerator(tc.opts...)
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err := generator.Apply(buf, tc.graph); err != nil {
+				t.Fatal("failed", err)
+			}
+			graph, err := manifests.Import(buf.Bytes())
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			if !reflect.DeepEqual(graph.Services, tc.graph.Services) {
+				t.Errorf("graph doesn't round trip, expected:\n%+v\ngot:\n%+v", tc.graph.Services, graph.Services)
+			}
+			if graph.GenerationParams != "name:k8s,workloads:3" {
+				t.Errorf("unexpected generation params: %s", graph.GenerationParams)
+			}
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	for name, input := range map[string]string{
+		"no workloads": "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: foo\n",
+		"invalid":      "kind: [\n",
+		"unknown upstream": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        env:
+        - name: UPSTREAM_URIS
+          value: http://b:9090
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := manifests.Import([]byte(input)); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
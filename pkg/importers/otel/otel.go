@@ -0,0 +1,286 @@
+package otel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	RequestTotal = "traces_service_graph_request_total"
+	FailedTotal  = "traces_service_graph_request_failed_total"
+)
+
+// latencyHistograms the histograms of the latency of calls in the order they are used (the server one is the closest to the actual latency).
+var latencyHistograms = []string{
+	"traces_service_graph_request_server_seconds",
+	"traces_service_graph_request_client_seconds",
+	"traces_service_graph_request_duration_seconds",
+}
+
+// EdgeStats what was observed on the calls between 2 services.
+type EdgeStats struct {
+	Client   string  `json:"client"`
+	Server   string  `json:"server"`
+	Requests int64   `json:"requests"`
+	Failed   int64   `json:"failed"`
+	P50Ms    float64 `json:"p50Ms"`
+	P90Ms    float64 `json:"p90Ms"`
+	P99Ms    float64 `json:"p99Ms"`
+}
+
+type Result struct {
+	// Graph the edges have the observed p50 as latency and the ratio of failed requests as error rate.
+	Graph apis.ServiceGraph
+	// Edges the observed stats of each pair of client and server sorted by client and server.
+	Edges []EdgeStats
+}
+
+// sample a value of a series.
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// Import reads the metrics of the servicegraph connector of the OpenTelemetry collector either in the Prometheus text format
+// or as the JSON response of a Prometheus query (instant or range, the last value of each series is used).
+// Series without a name in a JSON dump (e.g. the result of `sum by (client, server) (...)`) are considered to be request totals.
+func Import(b []byte, conf importers.Config) (Result, error) {
+	var samples []sample
+	var err error
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		samples, err = parseJSON(trimmed)
+	} else {
+		samples, err = parseText(trimmed)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	type key struct {
+		client, server string
+	}
+	requests := map[key]float64{}
+	failed := map[key]float64{}
+	// buckets per histogram name and edge indexed by upper bound.
+	buckets := map[string]map[key]map[float64]float64{}
+	for _, s := range samples {
+		k := key{client: s.labels["client"], server: s.labels["server"]}
+		if k.client == "" || k.server == "" {
+			continue
+		}
+		switch s.name {
+		case RequestTotal, "":
+			requests[k] += s.value
+		case FailedTotal:
+			failed[k] += s.value
+		default:
+			for _, h := range latencyHistograms {
+				if s.name != h+"_bucket" {
+					continue
+				}
+				le, err := strconv.ParseFloat(s.labels["le"], 64)
+				if err != nil {
+					return Result{}, fmt.Errorf("invalid bucket '%s' for %s -> %s", s.labels["le"], k.client, k.server)
+				}
+				if buckets[h] == nil {
+					buckets[h] = map[key]map[float64]float64{}
+				}
+				if buckets[h][k] == nil {
+					buckets[h][k] = map[float64]float64{}
+				}
+				// Series can be split on other labels (connection_type...) so they are summed.
+				buckets[h][k][le] += s.value
+			}
+		}
+	}
+	if len(requests) == 0 {
+		return Result{}, fmt.Errorf("no %s series with client and server labels found", RequestTotal)
+	}
+
+	out := Result{}
+	var calls []importers.Call
+	for k, total := range requests {
+		stats := EdgeStats{Client: k.client, Server: k.server, Requests: int64(math.Round(total)), Failed: int64(math.Round(failed[k]))}
+		for _, h := range latencyHistograms {
+			if bounds, exists := buckets[h][k]; exists {
+				stats.P50Ms = quantile(0.5, bounds) * 1000
+				stats.P90Ms = quantile(0.9, bounds) * 1000
+				stats.P99Ms = quantile(0.99, bounds) * 1000
+				break
+			}
+		}
+		stats.P50Ms, stats.P90Ms, stats.P99Ms = round(stats.P50Ms), round(stats.P90Ms), round(stats.P99Ms)
+		out.Edges = append(out.Edges, stats)
+		call := importers.Call{From: k.client, To: k.server, Count: total, LatencyMs: int(math.Round(stats.P50Ms))}
+		if total > 0 {
+			call.ErrorRate = math.Min(1, failed[k]/total)
+		}
+		calls = append(calls, call)
+	}
+	sort.Slice(out.Edges, func(i, j int) bool {
+		if out.Edges[i].Client != out.Edges[j].Client {
+			return out.Edges[i].Client < out.Edges[j].Client
+		}
+		return out.Edges[i].Server < out.Edges[j].Server
+	})
+	// Calls are sorted so that errors are deterministic.
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].From != calls[j].From {
+			return calls[i].From < calls[j].From
+		}
+		return calls[i].To < calls[j].To
+	})
+	res, err := importers.BuildGraph(calls, conf)
+	if err != nil {
+		return Result{}, err
+	}
+	out.Graph = res.Graph
+	out.Graph.GenerationParams = fmt.Sprintf("name:otel-servicegraph,edges:%d,droppedEdges:%d,anonymized:%t", len(out.Edges), len(res.Dropped), conf.Anonymize)
+	return out, nil
+}
+
+// quantile estimates a quantile from cumulative buckets with a linear interpolation inside the bucket (like `histogram_quantile`).
+func quantile(q float64, buckets map[float64]float64) float64 {
+	var bounds []float64
+	for le := range buckets {
+		bounds = append(bounds, le)
+	}
+	sort.Float64s(bounds)
+	if len(bounds) == 0 {
+		return 0
+	}
+	total := buckets[bounds[len(bounds)-1]]
+	if total == 0 {
+		return 0
+	}
+	rank := q * total
+	lower, prevCount := 0.0, 0.0
+	for _, le := range bounds {
+		count := buckets[le]
+		if count >= rank {
+			if math.IsInf(le, 1) {
+				// The highest finite bound is the best estimate we have.
+				return lower
+			}
+			if count == prevCount {
+				return le
+			}
+			return lower + (le-lower)*(rank-prevCount)/(count-prevCount)
+		}
+		lower, prevCount = le, count
+	}
+	return lower
+}
+
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+func parseText(b []byte) ([]sample, error) {
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(append(b, '\n')))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prometheus metrics: %w", err)
+	}
+	var out []sample
+	for name, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				out = append(out, sample{name: name, labels: labels, value: m.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				out = append(out, sample{name: name, labels: labels, value: m.GetGauge().GetValue()})
+			case dto.MetricType_UNTYPED:
+				out = append(out, sample{name: name, labels: labels, value: m.GetUntyped().GetValue()})
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				hasInf := false
+				for _, bucket := range h.GetBucket() {
+					hasInf = hasInf || math.IsInf(bucket.GetUpperBound(), 1)
+					out = append(out, sample{name: name + "_bucket", labels: withLabel(labels, "le", bucket.GetUpperBound()), value: float64(bucket.GetCumulativeCount())})
+				}
+				if !hasInf {
+					out = append(out, sample{name: name + "_bucket", labels: withLabel(labels, "le", math.Inf(1)), value: float64(h.GetSampleCount())})
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+func withLabel(labels map[string]string, name string, value float64) map[string]string {
+	out := map[string]string{name: strconv.FormatFloat(value, 'g', -1, 64)}
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
+
+type series struct {
+	Metric map[string]string `json:"metric"`
+	// Value the value of an instant query as [timestamp, "value"].
+	Value []interface{} `json:"value"`
+	// Values the values of a range query.
+	Values [][]interface{} `json:"values"`
+}
+
+func parseJSON(b []byte) ([]sample, error) {
+	var result []series
+	if b[0] == '[' {
+		if err := json.Unmarshal(b, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse prometheus query result: %w", err)
+		}
+	} else {
+		// Either the whole response of the API or only its data.
+		res := struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+			Data   struct {
+				Result []series `json:"result"`
+			} `json:"data"`
+			Result []series `json:"result"`
+		}{}
+		if err := json.Unmarshal(b, &res); err != nil {
+			return nil, fmt.Errorf("failed to parse prometheus query response: %w", err)
+		}
+		if res.Status == "error" {
+			return nil, fmt.Errorf("prometheus query failed: %s", res.Error)
+		}
+		result = append(res.Data.Result, res.Result...)
+	}
+	var out []sample
+	for _, s := range result {
+		value := s.Value
+		if len(s.Values) > 0 {
+			value = s.Values[len(s.Values)-1]
+		}
+		if len(value) != 2 {
+			continue
+		}
+		str, ok := value[1].(string)
+		if !ok {
+			return nil, errors.New("values must be formatted as [timestamp, \"value\"]")
+		}
+		v, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value '%s': %w", str, err)
+		}
+		out = append(out, sample{name: s.Metric["__name__"], labels: s.Metric, value: v})
+	}
+	return out, nil
+}
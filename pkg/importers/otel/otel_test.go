@@ -0,0 +1,116 @@
+package otel_test
+
+import (
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers"
+	"github.com/lahabana/microservice-mesh-generator/pkg/importers/otel"
+	"reflect"
+	"testing"
+)
+
+const text = `# HELP traces_service_graph_request_total Total count of requests between two nodes
+# TYPE traces_service_graph_request_total counter
+traces_service_graph_request_total{client="frontend",connection_type="",server="cart"} 60
+traces_service_graph_request_total{client="frontend",connection_type="messaging_system",server="cart"} 40
+traces_service_graph_request_total{client="cart",connection_type="",server="db"} 300
+# TYPE traces_service_graph_request_failed_total counter
+traces_service_graph_request_failed_total{client="frontend",connection_type="",server="cart"} 10
+# TYPE traces_service_graph_request_server_seconds histogram
+traces_service_graph_request_server_seconds_bucket{client="frontend",server="cart",le="0.01"} 20
+traces_service_graph_request_server_seconds_bucket{client="frontend",server="cart",le="0.05"} 60
+traces_service_graph_request_server_seconds_bucket{client="frontend",server="cart",le="0.1"} 90
+traces_service_graph_request_server_seconds_bucket{client="frontend",server="cart",le="+Inf"} 100
+traces_service_graph_request_server_seconds_sum{client="frontend",server="cart"} 4
+traces_service_graph_request_server_seconds_count{client="frontend",server="cart"} 100
+`
+
+const query = `{
+  "status": "success",
+  "data": {
+    "resultType": "vector",
+    "result": [
+      {"metric": {"__name__": "traces_service_graph_request_total", "client": "frontend", "server": "cart"}, "value": [1700000000, "100"]},
+      {"metric": {"client": "cart", "server": "db"}, "value": [1700000000, "300"]},
+      {"metric": {"__name__": "traces_service_graph_request_failed_total", "client": "frontend", "server": "cart"}, "value": [1700000000, "10"]},
+      {"metric": {"__name__": "traces_service_graph_request_server_seconds_bucket", "client": "frontend", "server": "cart", "le": "0.01"}, "value": [1700000000, "20"]},
+      {"metric": {"__name__": "traces_service_graph_request_server_seconds_bucket", "client": "frontend", "server": "cart", "le": "0.05"}, "value": [1700000000, "60"]},
+      {"metric": {"__name__": "traces_service_graph_request_server_seconds_bucket", "client": "frontend", "server": "cart", "le": "0.1"}, "value": [1700000000, "90"]},
+      {"metric": {"__name__": "traces_service_graph_request_server_seconds_bucket", "client": "frontend", "server": "cart", "le": "+Inf"}, "value": [1700000000, "100"]}
+    ]
+  }
+}`
+
+func TestImport(t *testing.T) {
+	for name, input := range map[string]string{"text": text, "json": query} {
+		t.Run(name, func(t *testing.T) {
+			res, err := otel.Import([]byte(input), importers.DefaultConfig())
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			expected := []otel.EdgeStats{
+				{Client: "cart", Server: "db", Requests: 300},
+				{Client: "frontend", Server: "cart", Requests: 100, Failed: 10, P50Ms: 40, P90Ms: 100, P99Ms: 100},
+			}
+			if !reflect.DeepEqual(res.Edges, expected) {
+				t.Errorf("unexpected edges: %+v", res.Edges)
+			}
+			expectedServices := []apis.Service{
+				{Idx: 0, Name: "frontend", Replicas: 1, Edges: []apis.Edge{{Target: 1, LatencyMs: 40, ErrorRate: 0.1}}},
+				{Idx: 1, Name: "cart", Replicas: 1, Edges: []apis.Edge{{Target: 2, Weight: 3}}},
+				{Idx: 2, Name: "db", Replicas: 1},
+			}
+			if !reflect.DeepEqual(res.Graph.Services, expectedServices) {
+				t.Errorf("unexpected services: %+v", res.Graph.Services)
+			}
+			if res.Graph.GenerationParams != "name:otel-servicegraph,edges:2,droppedEdges:0,anonymized:false" {
+				t.Errorf("unexpected generation params: %s", res.Graph.GenerationParams)
+			}
+		})
+	}
+}
+
+// rates the same mesh as query but from `rate(...)` so values are fractional requests per second.
+const rates = `{
+  "status": "success",
+  "data": {
+    "resultType": "vector",
+    "result": [
+      {"metric": {"client": "frontend", "server": "cart"}, "value": [1700000000, "0.2"]},
+      {"metric": {"client": "cart", "server": "db"}, "value": [1700000000, "0.6"]},
+      {"metric": {"__name__": "traces_service_graph_request_failed_total", "client": "frontend", "server": "cart"}, "value": [1700000000, "0.02"]},
+      {"metric": {"__name__": "traces_service_graph_request_server_seconds_bucket", "client": "frontend", "server": "cart", "le": "0.01"}, "value": [1700000000, "0.04"]},
+      {"metric": {"__name__": "traces_service_graph_request_server_seconds_bucket", "client": "frontend", "server": "cart", "le": "0.05"}, "value": [1700000000, "0.12"]},
+      {"metric": {"__name__": "traces_service_graph_request_server_seconds_bucket", "client": "frontend", "server": "cart", "le": "0.1"}, "value": [1700000000, "0.18"]},
+      {"metric": {"__name__": "traces_service_graph_request_server_seconds_bucket", "client": "frontend", "server": "cart", "le": "+Inf"}, "value": [1700000000, "0.2"]}
+    ]
+  }
+}`
+
+func TestImportRates(t *testing.T) {
+	res, err := otel.Import([]byte(rates), importers.DefaultConfig())
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	expectedServices := []apis.Service{
+		{Idx: 0, Name: "frontend", Replicas: 1, Edges: []apis.Edge{{Target: 1, LatencyMs: 40, ErrorRate: 0.1}}},
+		{Idx: 1, Name: "cart", Replicas: 1, Edges: []apis.Edge{{Target: 2, Weight: 3}}},
+		{Idx: 2, Name: "db", Replicas: 1},
+	}
+	if !reflect.DeepEqual(res.Graph.Services, expectedServices) {
+		t.Errorf("unexpected services: %+v", res.Graph.Services)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	for name, input := range map[string]string{
+		"no series": "up 1\n",
+		"invalid":   "{not json",
+		"failed":    `{"status": "error", "error": "bad query"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := otel.Import([]byte(input), importers.DefaultConfig()); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
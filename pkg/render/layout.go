@@ -0,0 +1,364 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"math"
+	"sort"
+)
+
+const (
+	charWidth  = 8.0
+	lineHeight = 16.0
+	padding    = 10.0
+	layerGap   = 60.0
+	nodeGap    = 30.0
+	margin     = 20.0
+	// sweeps the number of passes of the crossing reduction.
+	sweeps = 24
+)
+
+// The cost of a layout grows with the number of dummy vertices (the layers spanned by edges) and the cost of an image with its size.
+const (
+	// MaxEdgeSpan the maximum of the sum over all edges of the number of layers they span.
+	MaxEdgeSpan = 10_000
+	// MaxPixels the maximum number of pixels of an image (the layout is in pixels in SVG and each unit is pngScale² pixels in PNG).
+	MaxPixels = 25_000_000
+)
+
+// ErrTooLarge is returned when a graph goes over MaxEdgeSpan or MaxPixels.
+var ErrTooLarge = errors.New("graph is too large to be rendered")
+
+type Point struct {
+	X, Y float64
+}
+
+// Node a service placed in the layout, X and Y are its top left corner.
+type Node struct {
+	Idx    int
+	X, Y   float64
+	Width  float64
+	Height float64
+	// Lines the text of the node (name and replicas).
+	Lines []string
+	// Fill the color of the node (empty if the service has neither tier nor role).
+	Fill string
+}
+
+// Edge a call drawn as a polyline from the bottom of the caller to the top of the callee.
+type Edge struct {
+	From, To int
+	Points   []Point
+	// Label the attributes of the call, empty for plain http calls.
+	Label string
+}
+
+type Layout struct {
+	Width, Height float64
+	Nodes         []Node
+	Edges         []Edge
+}
+
+// vertex a service or a dummy vertex added where an edge crosses a layer.
+type vertex struct {
+	service int
+	width   float64
+	up      []int
+	down    []int
+	// center the horizontal position of the vertex.
+	center float64
+}
+
+// NewLayout places the services of a valid graph top to bottom with a layered (Sugiyama) layout:
+//   - services are put in the layer of their depth (the longest chain of calls leading to them),
+//   - edges spanning multiple layers go through dummy vertices in each layer they cross,
+//   - vertices are ordered in each layer with the barycenter heuristic keeping the order with the fewest crossings,
+//   - vertices are moved towards the median of their neighbours without overlapping.
+//
+// It fails with ErrTooLarge if the graph goes over MaxEdgeSpan or MaxPixels.
+func NewLayout(graph apis.ServiceGraph) (Layout, error) {
+	if err := graph.Validate(); err != nil {
+		return Layout{}, fmt.Errorf("invalid graph: %w", err)
+	}
+	out := Layout{}
+	if len(graph.Services) == 0 {
+		return out, nil
+	}
+	depths := apis.Depths(graph)
+	span := 0
+	for _, srv := range graph.Services {
+		for _, e := range srv.Edges {
+			span += depths[e.Target] - depths[srv.Idx]
+		}
+	}
+	if span > MaxEdgeSpan {
+		return Layout{}, fmt.Errorf("%w: edges span %d layers in total (max %d)", ErrTooLarge, span, MaxEdgeSpan)
+	}
+	colors := apis.Colors(graph)
+	numLayers := 0
+	for _, d := range depths {
+		numLayers = max(numLayers, d+1)
+	}
+	layers := make([][]int, numLayers)
+	var vertices []*vertex
+	for _, srv := range graph.Services {
+		node := Node{
+			Idx:   srv.Idx,
+			Lines: []string{srv.DisplayName(), fmt.Sprintf("replicas:%d", srv.Replicas)},
+			Fill:  colors[srv.Idx],
+		}
+		for _, l := range node.Lines {
+			node.Width = max(node.Width, float64(len(l))*charWidth+2*padding)
+		}
+		node.Height = float64(len(node.Lines))*lineHeight + padding
+		out.Nodes = append(out.Nodes, node)
+		vertices = append(vertices, &vertex{service: srv.Idx, width: node.Width})
+		layers[depths[srv.Idx]] = append(layers[depths[srv.Idx]], srv.Idx)
+	}
+	// chains the vertices each edge goes through.
+	var chains [][]int
+	for _, srv := range graph.Services {
+		for _, e := range srv.Edges {
+			chain := []int{srv.Idx}
+			for d := depths[srv.Idx] + 1; d < depths[e.Target]; d++ {
+				vertices = append(vertices, &vertex{service: -1})
+				layers[d] = append(layers[d], len(vertices)-1)
+				chain = append(chain, len(vertices)-1)
+			}
+			chain = append(chain, e.Target)
+			for i := 1; i < len(chain); i++ {
+				vertices[chain[i-1]].down = append(vertices[chain[i-1]].down, chain[i])
+				vertices[chain[i]].up = append(vertices[chain[i]].up, chain[i-1])
+			}
+			chains = append(chains, chain)
+			label := apis.EdgeLabel(e)
+			if label == apis.ProtocolHTTP {
+				label = ""
+			}
+			out.Edges = append(out.Edges, Edge{From: srv.Idx, To: e.Target, Label: label})
+		}
+	}
+
+	orderLayers(layers, vertices)
+	placeVertices(layers, vertices)
+
+	// Shift everything so the leftmost vertex is at the margin.
+	left := math.Inf(1)
+	for _, v := range vertices {
+		left = min(left, v.center-v.width/2)
+	}
+	for _, v := range vertices {
+		v.center += margin - left
+		out.Width = max(out.Width, v.center+v.width/2+margin)
+	}
+	layerTops := make([]float64, numLayers)
+	layerHeights := make([]float64, numLayers)
+	y := margin
+	for d, layer := range layers {
+		for _, v := range layer {
+			if s := vertices[v].service; s >= 0 {
+				layerHeights[d] = max(layerHeights[d], out.Nodes[s].Height)
+			}
+		}
+		layerTops[d] = y
+		y += layerHeights[d] + layerGap
+	}
+	out.Height = y - layerGap + margin
+	if out.Width*out.Height > MaxPixels {
+		return Layout{}, fmt.Errorf("%w: the image would be %.0fx%.0f pixels (max %d pixels)", ErrTooLarge, out.Width, out.Height, MaxPixels)
+	}
+	for i := range out.Nodes {
+		n := &out.Nodes[i]
+		d := depths[n.Idx]
+		n.X = vertices[n.Idx].center - n.Width/2
+		// Nodes are vertically centered in their layer.
+		n.Y = layerTops[d] + (layerHeights[d]-n.Height)/2
+	}
+	for i, chain := range chains {
+		from, to := out.Nodes[chain[0]], out.Nodes[chain[len(chain)-1]]
+		points := []Point{{X: from.X + from.Width/2, Y: from.Y + from.Height}}
+		for d, v := range chain[1 : len(chain)-1] {
+			layer := depths[from.Idx] + 1 + d
+			x := vertices[v].center
+			points = append(points, Point{X: x, Y: layerTops[layer]}, Point{X: x, Y: layerTops[layer] + layerHeights[layer]})
+		}
+		points = append(points, Point{X: to.X + to.Width/2, Y: to.Y})
+		out.Edges[i].Points = points
+	}
+	return out, nil
+}
+
+// orderLayers reorders the vertices of each layer to reduce the number of crossing edges.
+func orderLayers(layers [][]int, vertices []*vertex) {
+	positions := make([]float64, len(vertices))
+	updatePositions := func() {
+		for _, layer := range layers {
+			for i, v := range layer {
+				positions[v] = float64(i)
+			}
+		}
+	}
+	copyLayers := func() [][]int {
+		out := make([][]int, len(layers))
+		for i, l := range layers {
+			out[i] = append([]int{}, l...)
+		}
+		return out
+	}
+	updatePositions()
+	best, bestCrossings := copyLayers(), crossings(layers, vertices, positions)
+	for sweep := 0; sweep < sweeps && bestCrossings > 0; sweep++ {
+		down := sweep%2 == 0
+		for i := range layers {
+			d := i
+			if !down {
+				d = len(layers) - 1 - i
+			}
+			layer := layers[d]
+			barycenters := map[int]float64{}
+			for _, v := range layer {
+				neighbours := vertices[v].up
+				if !down {
+					neighbours = vertices[v].down
+				}
+				if len(neighbours) == 0 {
+					// Vertices without neighbours keep their position.
+					barycenters[v] = positions[v]
+					continue
+				}
+				sum := 0.0
+				for _, n := range neighbours {
+					sum += positions[n]
+				}
+				barycenters[v] = sum / float64(len(neighbours))
+			}
+			sort.SliceStable(layer, func(a, b int) bool {
+				return barycenters[layer[a]] < barycenters[layer[b]]
+			})
+			for p, v := range layer {
+				positions[v] = float64(p)
+			}
+		}
+		if c := crossings(layers, vertices, positions); c < bestCrossings {
+			best, bestCrossings = copyLayers(), c
+		}
+	}
+	copy(layers, best)
+}
+
+// crossings counts the pairs of edges crossing between consecutive layers.
+func crossings(layers [][]int, vertices []*vertex, positions []float64) int {
+	total := 0
+	for d := 0; d+1 < len(layers); d++ {
+		// Edges sorted by the position of their top vertex, crossings are the inversions of the positions of their bottom vertex.
+		var bottoms []int
+		for _, v := range layers[d] {
+			down := append([]int{}, vertices[v].down...)
+			sort.Slice(down, func(a, b int) bool {
+				return positions[down[a]] < positions[down[b]]
+			})
+			for _, w := range down {
+				bottoms = append(bottoms, int(positions[w]))
+			}
+		}
+		total += inversions(bottoms, len(layers[d+1]))
+	}
+	return total
+}
+
+// inversions counts the pairs i < j with values[i] > values[j] using a Fenwick tree (values are in [0, size)).
+func inversions(values []int, size int) int {
+	tree := make([]int, size+1)
+	total := 0
+	for i, v := range values {
+		// Count the values seen so far that are <= v.
+		seen := 0
+		for j := v + 1; j > 0; j -= j & -j {
+			seen += tree[j]
+		}
+		total += i - seen
+		for j := v + 1; j <= size; j += j & -j {
+			tree[j]++
+		}
+	}
+	return total
+}
+
+// placeVertices sets the horizontal position of the vertices, each vertex is moved towards the median of its neighbours
+// while keeping the order of the layer and a gap between vertices.
+func placeVertices(layers [][]int, vertices []*vertex) {
+	gap := func(a, b int) float64 {
+		g := nodeGap
+		if vertices[a].service < 0 && vertices[b].service < 0 {
+			// Edges going through the same layer can be closer.
+			g = nodeGap / 3
+		}
+		return vertices[a].width/2 + g + vertices[b].width/2
+	}
+	widest := 0.0
+	for _, layer := range layers {
+		x := 0.0
+		for i, v := range layer {
+			if i > 0 {
+				x += gap(layer[i-1], v)
+			}
+			vertices[v].center = x
+		}
+		widest = max(widest, x)
+	}
+	// Center the layers before refining.
+	for _, layer := range layers {
+		if len(layer) == 0 {
+			continue
+		}
+		shift := (widest - vertices[layer[len(layer)-1]].center) / 2
+		for _, v := range layer {
+			vertices[v].center += shift
+		}
+	}
+	for sweep := 0; sweep < 8; sweep++ {
+		down := sweep%2 == 0
+		for i := range layers {
+			d := i
+			if !down {
+				d = len(layers) - 1 - i
+			}
+			layer := layers[d]
+			desired := make([]float64, len(layer))
+			for p, v := range layer {
+				neighbours := vertices[v].up
+				if !down {
+					neighbours = vertices[v].down
+				}
+				if len(neighbours) == 0 {
+					desired[p] = vertices[v].center
+					continue
+				}
+				var centers []float64
+				for _, n := range neighbours {
+					centers = append(centers, vertices[n].center)
+				}
+				sort.Float64s(centers)
+				m := len(centers) / 2
+				desired[p] = centers[m]
+				if len(centers)%2 == 0 {
+					desired[p] = (centers[m-1] + centers[m]) / 2
+				}
+			}
+			// Push right to remove overlaps, then left to get back towards the desired positions and right again so nothing overlaps.
+			for p := 1; p < len(layer); p++ {
+				desired[p] = max(desired[p], desired[p-1]+gap(layer[p-1], layer[p]))
+			}
+			for p := len(layer) - 2; p >= 0; p-- {
+				desired[p] = min(desired[p], desired[p+1]-gap(layer[p], layer[p+1]))
+			}
+			for p := 1; p < len(layer); p++ {
+				desired[p] = max(desired[p], desired[p-1]+gap(layer[p-1], layer[p]))
+			}
+			for p, v := range layer {
+				vertices[v].center = desired[p]
+			}
+		}
+	}
+}
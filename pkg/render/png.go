@@ -0,0 +1,152 @@
+package render
+
+import (
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"unicode"
+)
+
+// pngScale the number of pixels per unit of the layout (the text of the bitmap font is too small otherwise).
+const pngScale = 2
+
+// PNGGenerator outputs a PNG image of the service graph.
+var PNGGenerator = apis.GeneratorFunc(func(writer io.Writer, graph apis.ServiceGraph) error {
+	layout, err := NewLayout(graph)
+	if err != nil {
+		return err
+	}
+	return layout.WritePNG(writer)
+})
+
+// WritePNG rasterizes the layout as a PNG image.
+func (l Layout) WritePNG(writer io.Writer) error {
+	if l.Width*l.Height*pngScale*pngScale > MaxPixels {
+		return fmt.Errorf("%w: the image would be %.0fx%.0f pixels (max %d pixels)", ErrTooLarge, l.Width*pngScale, l.Height*pngScale, MaxPixels)
+	}
+	c := canvas{img: image.NewRGBA(image.Rect(0, 0, int(math.Ceil(l.Width*pngScale)), int(math.Ceil(l.Height*pngScale))))}
+	c.fillRect(0, 0, l.Width, l.Height, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	edge := parseColor(edgeColor)
+	for _, e := range l.Edges {
+		for i := 1; i < len(e.Points); i++ {
+			c.line(e.Points[i-1], e.Points[i], edge)
+		}
+		c.arrowHead(e.Points[len(e.Points)-2], e.Points[len(e.Points)-1], edge)
+		if e.Label != "" {
+			p := e.labelPosition()
+			c.text(e.Label, p.X+4, p.Y-4, edge)
+		}
+	}
+	stroke := parseColor(strokeColor)
+	for _, n := range l.Nodes {
+		fill := n.Fill
+		if fill == "" {
+			fill = defaultFill
+		}
+		c.fillRect(n.X, n.Y, n.Width, n.Height, parseColor(fill))
+		c.strokeRect(n.X, n.Y, n.Width, n.Height, stroke)
+		for i, line := range n.Lines {
+			width := float64(len(line)) * 6
+			c.text(line, n.X+(n.Width-width)/2, n.Y+padding/2+float64(i)*lineHeight+4, stroke)
+		}
+	}
+	return png.Encode(writer, c.img)
+}
+
+// canvas draws in layout units on an image scaled by pngScale.
+type canvas struct {
+	img *image.RGBA
+}
+
+func (c canvas) fillRect(x, y, w, h float64, col color.RGBA) {
+	for py := int(y * pngScale); py < int((y+h)*pngScale); py++ {
+		for px := int(x * pngScale); px < int((x+w)*pngScale); px++ {
+			c.img.SetRGBA(px, py, col)
+		}
+	}
+}
+
+func (c canvas) strokeRect(x, y, w, h float64, col color.RGBA) {
+	c.fillRect(x, y, w, 1/float64(pngScale), col)
+	c.fillRect(x, y+h-1/float64(pngScale), w, 1/float64(pngScale), col)
+	c.fillRect(x, y, 1/float64(pngScale), h, col)
+	c.fillRect(x+w-1/float64(pngScale), y, 1/float64(pngScale), h, col)
+}
+
+// line draws a line of one layout unit of width.
+func (c canvas) line(a, b Point, col color.RGBA) {
+	steps := int(math.Ceil(math.Max(math.Abs(b.X-a.X), math.Abs(b.Y-a.Y)) * pngScale))
+	for i := 0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		x, y := (a.X+(b.X-a.X)*t)*pngScale, (a.Y+(b.Y-a.Y)*t)*pngScale
+		for dy := 0; dy < pngScale; dy++ {
+			for dx := 0; dx < pngScale; dx++ {
+				c.img.SetRGBA(int(x)+dx-pngScale/2, int(y)+dy-pngScale/2, col)
+			}
+		}
+	}
+}
+
+// arrowHead fills a triangle pointing at `to` along the direction of the segment.
+func (c canvas) arrowHead(from, to Point, col color.RGBA) {
+	length := math.Hypot(to.X-from.X, to.Y-from.Y)
+	if length == 0 {
+		return
+	}
+	ux, uy := (to.X-from.X)/length, (to.Y-from.Y)/length
+	const size = 8.0
+	base := Point{X: to.X - ux*size, Y: to.Y - uy*size}
+	p1 := Point{X: base.X - uy*size/2, Y: base.Y + ux*size/2}
+	p2 := Point{X: base.X + uy*size/2, Y: base.Y - ux*size/2}
+	minX, maxX := math.Min(to.X, math.Min(p1.X, p2.X)), math.Max(to.X, math.Max(p1.X, p2.X))
+	minY, maxY := math.Min(to.Y, math.Min(p1.Y, p2.Y)), math.Max(to.Y, math.Max(p1.Y, p2.Y))
+	side := func(p, a, b Point) float64 {
+		return (b.X-a.X)*(p.Y-a.Y) - (b.Y-a.Y)*(p.X-a.X)
+	}
+	for py := int(minY * pngScale); py <= int(maxY*pngScale); py++ {
+		for px := int(minX * pngScale); px <= int(maxX*pngScale); px++ {
+			p := Point{X: float64(px) / pngScale, Y: float64(py) / pngScale}
+			s1, s2, s3 := side(p, to, p1), side(p, p1, p2), side(p, p2, to)
+			if (s1 >= 0 && s2 >= 0 && s3 >= 0) || (s1 <= 0 && s2 <= 0 && s3 <= 0) {
+				c.img.SetRGBA(px, py, col)
+			}
+		}
+	}
+}
+
+// text draws a string with the bitmap font, x and y are the top left corner, each glyph is 5x7 units with a unit of spacing.
+func (c canvas) text(s string, x, y float64, col color.RGBA) {
+	for i, r := range []rune(s) {
+		glyph, exists := glyphs[unicode.ToLower(r)]
+		if !exists {
+			glyph = glyphs['?']
+		}
+		for row, bits := range glyph {
+			for column := 0; column < 5; column++ {
+				if bits&(1<<(4-column)) != 0 {
+					c.fillRect(x+float64(i*6+column), y+float64(row), 1, 1, col)
+				}
+			}
+		}
+	}
+}
+
+// parseColor parses a `#rrggbb` color (black if invalid).
+func parseColor(s string) color.RGBA {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{A: 255}
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}
+}
@@ -0,0 +1,157 @@
+package render_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/render"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	// 0 calls 3 which is 2 layers below so the edge goes through a dummy vertex.
+	graph := apis.ServiceGraph{Services: []apis.Service{
+		{Idx: 0, Name: "frontend", Replicas: 2, Edges: []apis.Edge{{Target: 2}, {Target: 1}, {Target: 3, Protocol: apis.ProtocolGRPC, Weight: 2}}},
+		{Idx: 1, Replicas: 1, Edges: apis.EdgesTo(4)},
+		{Idx: 2, Replicas: 1, Edges: apis.EdgesTo(3)},
+		{Idx: 3, Replicas: 1},
+		{Idx: 4, Replicas: 1},
+	}}
+	layout, err := render.NewLayout(graph)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	if len(layout.Nodes) != 5 || len(layout.Edges) != 5 {
+		t.Fatalf("unexpected layout: %+v", layout)
+	}
+	for _, n := range layout.Nodes {
+		if n.X < 0 || n.Y < 0 || n.X+n.Width > layout.Width || n.Y+n.Height > layout.Height {
+			t.Errorf("node %d is outside of the image: %+v", n.Idx, n)
+		}
+		for _, other := range layout.Nodes {
+			if other.Idx != n.Idx && n.X < other.X+other.Width && other.X < n.X+n.Width && n.Y < other.Y+other.Height && other.Y < n.Y+n.Height {
+				t.Errorf("nodes %d and %d overlap", n.Idx, other.Idx)
+			}
+		}
+	}
+	if layout.Nodes[0].Lines[0] != "frontend" || layout.Nodes[0].Lines[1] != "replicas:2" {
+		t.Errorf("unexpected lines: %v", layout.Nodes[0].Lines)
+	}
+	for _, e := range layout.Edges {
+		// Edges go downward from the bottom of the caller to the top of the callee.
+		from, to := layout.Nodes[e.From], layout.Nodes[e.To]
+		if e.Points[0].Y != from.Y+from.Height || e.Points[len(e.Points)-1].Y != to.Y {
+			t.Errorf("edge %d -> %d doesn't join its nodes: %v", e.From, e.To, e.Points)
+		}
+		for i := 1; i < len(e.Points); i++ {
+			if e.Points[i].Y < e.Points[i-1].Y {
+				t.Errorf("edge %d -> %d goes up: %v", e.From, e.To, e.Points)
+			}
+		}
+		if e.From == 0 && e.To == 3 {
+			if len(e.Points) != 4 {
+				t.Errorf("edge 0 -> 3 should go through a dummy vertex: %v", e.Points)
+			}
+			if e.Label != "grpc x2" {
+				t.Errorf("unexpected label: %s", e.Label)
+			}
+		} else if e.Label != "" {
+			t.Errorf("http calls shouldn't have a label: %s", e.Label)
+		}
+	}
+	// 1 and 2 are ordered like their callees to avoid crossings.
+	if (layout.Nodes[1].X < layout.Nodes[2].X) != (layout.Nodes[4].X < layout.Nodes[3].X) {
+		t.Errorf("edges cross: %+v", layout.Nodes)
+	}
+}
+
+func TestLayoutInvalid(t *testing.T) {
+	_, err := render.NewLayout(apis.ServiceGraph{Services: []apis.Service{{Idx: 0, Edges: apis.EdgesTo(0)}}})
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestLayoutTooLarge(t *testing.T) {
+	// Every service of a chain calls all the services below it: edges span 1+2+...+199 layers for the first service.
+	chain := apis.ServiceGraph{}
+	for i := 0; i < 200; i++ {
+		srv := apis.Service{Idx: i, Replicas: 1}
+		for j := i + 1; j < min(i+51, 200); j++ {
+			srv.Edges = append(srv.Edges, apis.Edge{Target: j})
+		}
+		chain.Services = append(chain.Services, srv)
+	}
+	// Services without edges are all in the same layer.
+	row := apis.ServiceGraph{}
+	for i := 0; i < 5000; i++ {
+		row.Services = append(row.Services, apis.Service{Idx: i, Replicas: 1})
+	}
+	for name, graph := range map[string]apis.ServiceGraph{"span": chain, "pixels": row} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := render.NewLayout(graph); !errors.Is(err, render.ErrTooLarge) {
+				t.Errorf("expected ErrTooLarge got: %v", err)
+			}
+			for _, g := range []apis.Generator{render.SVGGenerator, render.PNGGenerator} {
+				if err := g.Apply(io.Discard, graph); !errors.Is(err, render.ErrTooLarge) {
+					t.Errorf("expected ErrTooLarge got: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	mesh, err := apis.GenerateTieredMesh(1, []int{2, 3, 4, 2}, []int{50, 50, 50}, 1, 3)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	t.Run("svg", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		if err := render.SVGGenerator.Apply(buf, mesh); err != nil {
+			t.Fatal("failed", err)
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+		nodes := 0
+		for {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal("invalid svg", err)
+			}
+			if start, ok := token.(xml.StartElement); ok && start.Name.Local == "g" {
+				for _, attr := range start.Attr {
+					if attr.Name.Local == "class" && attr.Value == "node" {
+						nodes++
+					}
+				}
+			}
+		}
+		if nodes != len(mesh.Services) {
+			t.Errorf("expected %d nodes got %d", len(mesh.Services), nodes)
+		}
+		if !strings.Contains(buf.String(), "<desc>"+mesh.GenerationParams+"</desc>") {
+			t.Errorf("missing description")
+		}
+	})
+	t.Run("png", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		if err := render.PNGGenerator.Apply(buf, mesh); err != nil {
+			t.Fatal("failed", err)
+		}
+		img, err := png.Decode(buf)
+		if err != nil {
+			t.Fatal("invalid png", err)
+		}
+		layout, _ := render.NewLayout(mesh)
+		if img.Bounds().Dx() < int(layout.Width) || img.Bounds().Dy() < int(layout.Height) {
+			t.Errorf("image is smaller than the layout: %v", img.Bounds())
+		}
+	})
+}
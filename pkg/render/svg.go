@@ -0,0 +1,84 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"io"
+	"strings"
+)
+
+const (
+	edgeColor   = "#555555"
+	strokeColor = "#333333"
+	defaultFill = "#f5f5f5"
+)
+
+// SVGGenerator outputs an SVG image of the service graph.
+var SVGGenerator = apis.GeneratorFunc(func(writer io.Writer, graph apis.ServiceGraph) error {
+	layout, err := NewLayout(graph)
+	if err != nil {
+		return err
+	}
+	return layout.WriteSVG(writer, graph.GenerationParams)
+})
+
+// WriteSVG writes the layout as an SVG image, the description is added as the `<desc>` of the image.
+func (l Layout) WriteSVG(writer io.Writer, description string) error {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" font-family="monospace" font-size="12">`+"\n",
+		num(l.Width), num(l.Height), num(l.Width), num(l.Height))
+	if description != "" {
+		fmt.Fprintf(buf, "<desc>%s</desc>\n", escape(description))
+	}
+	fmt.Fprintf(buf, `<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><path d="M 0 0 L 10 5 L 0 10 z" fill="%s"/></marker></defs>`+"\n", edgeColor)
+	buf.WriteString(`<rect width="100%" height="100%" fill="white"/>` + "\n")
+	buf.WriteString(`<g class="edges">` + "\n")
+	for _, e := range l.Edges {
+		var points []string
+		for _, p := range e.Points {
+			points = append(points, num(p.X)+","+num(p.Y))
+		}
+		fmt.Fprintf(buf, `<polyline class="edge" data-from="%d" data-to="%d" points="%s" fill="none" stroke="%s" stroke-width="1.5" marker-end="url(#arrow)"/>`+"\n",
+			e.From, e.To, strings.Join(points, " "), edgeColor)
+		if e.Label != "" {
+			p := e.labelPosition()
+			fmt.Fprintf(buf, `<text class="edge-label" x="%s" y="%s" fill="%s" font-size="10">%s</text>`+"\n", num(p.X+4), num(p.Y), edgeColor, escape(e.Label))
+		}
+	}
+	buf.WriteString("</g>\n")
+	buf.WriteString(`<g class="nodes">` + "\n")
+	for _, n := range l.Nodes {
+		fill := n.Fill
+		if fill == "" {
+			fill = defaultFill
+		}
+		fmt.Fprintf(buf, `<g class="node" data-idx="%d"><title>%s</title>`, n.Idx, escape(n.Lines[0]))
+		fmt.Fprintf(buf, `<rect x="%s" y="%s" width="%s" height="%s" rx="6" fill="%s" stroke="%s"/>`, num(n.X), num(n.Y), num(n.Width), num(n.Height), fill, strokeColor)
+		for i, line := range n.Lines {
+			fmt.Fprintf(buf, `<text x="%s" y="%s" text-anchor="middle">%s</text>`, num(n.X+n.Width/2), num(n.Y+padding/2+float64(i+1)*lineHeight-4), escape(line))
+		}
+		buf.WriteString("</g>\n")
+	}
+	buf.WriteString("</g>\n</svg>\n")
+	_, err := writer.Write(buf.Bytes())
+	return err
+}
+
+// labelPosition the middle of the segment in the middle of the edge.
+func (e Edge) labelPosition() Point {
+	i := (len(e.Points) - 1) / 2
+	a, b := e.Points[i], e.Points[i+1]
+	return Point{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2}
+}
+
+func num(f float64) string {
+	return fmt.Sprintf("%.1f", f)
+}
+
+func escape(s string) string {
+	buf := &bytes.Buffer{}
+	_ = xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
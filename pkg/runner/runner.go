@@ -0,0 +1,260 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Path the path served by each service which calls its edges (same as api-play).
+const Path = "/api/dynamic/microservice_mesh"
+
+type Config struct {
+	// Host the address the services listen on.
+	Host string
+	// BasePort service `idx` listens on `BasePort + idx`, a random port is used for each service when 0.
+	BasePort int
+	// Seed the seed used to inject errors.
+	Seed int64
+	// ShutdownTimeout how long to wait for in-flight requests when stopping.
+	ShutdownTimeout time.Duration
+	Logger          *slog.Logger
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Host:            "127.0.0.1",
+		ShutdownTimeout: 5 * time.Second,
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// Mesh services of a ServiceGraph running as HTTP servers in the current process.
+type Mesh struct {
+	addrs   []string
+	servers []*http.Server
+	wg      sync.WaitGroup
+	errs    chan error
+}
+
+// CallResult the result of calling an edge.
+type CallResult struct {
+	Url        string `json:"url"`
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Attempts   int    `json:"attempts"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Response what's returned by Path.
+type Response struct {
+	Service  string       `json:"service"`
+	Replicas int          `json:"replicas"`
+	Calls    []CallResult `json:"calls"`
+}
+
+// Start starts a server per service and returns once they all listen, they are stopped when ctx is cancelled.
+func Start(ctx context.Context, graph apis.ServiceGraph, conf Config) (*Mesh, error) {
+	if err := graph.Validate(); err != nil {
+		return nil, err
+	}
+	if conf.Logger == nil {
+		conf.Logger = DefaultConfig().Logger
+	}
+	// Each server can fail serving and shutting down.
+	m := &Mesh{errs: make(chan error, 2*len(graph.Services))}
+	var listeners []net.Listener
+	for _, svc := range graph.Services {
+		port := 0
+		if conf.BasePort > 0 {
+			port = conf.BasePort + svc.Idx
+		}
+		l, err := net.Listen("tcp", net.JoinHostPort(conf.Host, fmt.Sprint(port)))
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen for service %s: %w", svc.DisplayName(), err)
+		}
+		listeners = append(listeners, l)
+		m.addrs = append(m.addrs, l.Addr().String())
+	}
+	client := &http.Client{}
+	for i, svc := range graph.Services {
+		h := &handler{
+			svc:      svc,
+			defaults: graph.Defaults,
+			mesh:     m,
+			client:   client,
+			random:   rand.New(rand.NewSource(conf.Seed + int64(svc.Idx))),
+			l:        conf.Logger.With("service", svc.DisplayName()),
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/health", ok)
+		mux.HandleFunc("/ready", ok)
+		mux.Handle(Path, h)
+		server := &http.Server{Handler: mux}
+		m.servers = append(m.servers, server)
+		m.wg.Add(1)
+		go func(l net.Listener) {
+			defer m.wg.Done()
+			if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				m.errs <- err
+			}
+		}(listeners[i])
+		conf.Logger.Info("service started", "service", svc.DisplayName(), "url", m.Url(svc.Idx))
+	}
+	// The shutdown is part of the WaitGroup so Wait returns once in-flight requests are drained and gets the shutdown errors.
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+		defer cancel()
+		for _, s := range m.servers {
+			if err := s.Shutdown(shutdownCtx); err != nil {
+				m.errs <- err
+			}
+		}
+	}()
+	return m, nil
+}
+
+// Addr the address service `idx` listens on.
+func (m *Mesh) Addr(idx int) string {
+	return m.addrs[idx]
+}
+
+// Url the url which calls the edges of service `idx`.
+func (m *Mesh) Url(idx int) string {
+	return fmt.Sprintf("http://%s%s", m.addrs[idx], Path)
+}
+
+// Wait blocks until all servers are stopped (after ctx is cancelled and in-flight requests are drained)
+// and returns the first error encountered.
+func (m *Mesh) Wait() error {
+	m.wg.Wait()
+	select {
+	case err := <-m.errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+func ok(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+type handler struct {
+	svc      apis.Service
+	defaults *apis.Defaults
+	mesh     *Mesh
+	client   *http.Client
+	l        *slog.Logger
+
+	sync.Mutex
+	random *rand.Rand
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var edges []apis.Edge
+	// Calls are repeated to respect the weight of the edge
+	for _, e := range h.svc.Edges {
+		for i := 0; i < e.GetWeight(); i++ {
+			edges = append(edges, e)
+		}
+	}
+	res := Response{Service: h.svc.DisplayName(), Replicas: h.svc.Replicas, Calls: make([]CallResult, len(edges))}
+	wg := sync.WaitGroup{}
+	for i, e := range edges {
+		wg.Add(1)
+		go func(i int, e apis.Edge) {
+			defer wg.Done()
+			res.Calls[i] = h.call(r.Context(), e)
+		}(i, e)
+	}
+	wg.Wait()
+	status := http.StatusOK
+	for _, c := range res.Calls {
+		if c.Error != "" {
+			status = http.StatusBadGateway
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// call calls an edge: latency is added to each attempt, errorRate is the chance an attempt fails and attempts are retried on failure.
+func (h *handler) call(ctx context.Context, e apis.Edge) CallResult {
+	timeoutMs, retries := e.TimeoutMs, e.Retries
+	if h.defaults != nil {
+		if timeoutMs == 0 {
+			timeoutMs = h.defaults.TimeoutMs
+		}
+		if retries == 0 {
+			retries = h.defaults.Retries
+		}
+	}
+	res := CallResult{Url: h.mesh.Url(e.Target)}
+	start := time.Now()
+	for attempt := 0; attempt <= retries; attempt++ {
+		res.Attempts++
+		res.Status, res.Error = h.attempt(ctx, e, res.Url, timeoutMs)
+		if res.Error == "" || ctx.Err() != nil {
+			break
+		}
+	}
+	res.DurationMs = time.Since(start).Milliseconds()
+	if res.Error != "" {
+		h.l.DebugContext(ctx, "call failed", "url", res.Url, "error", res.Error, "attempts", res.Attempts)
+	}
+	return res
+}
+
+func (h *handler) attempt(ctx context.Context, e apis.Edge, url string, timeoutMs int) (int, string) {
+	if timeoutMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
+		defer cancel()
+	}
+	if e.LatencyMs > 0 {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err().Error()
+		case <-time.After(time.Duration(e.LatencyMs) * time.Millisecond):
+		}
+	}
+	if e.ErrorRate > 0 {
+		h.Lock()
+		failed := h.random.Float64() < e.ErrorRate
+		h.Unlock()
+		if failed {
+			return http.StatusServiceUnavailable, "injected error"
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err.Error()
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 400 {
+		return resp.StatusCode, fmt.Sprintf("unexpected status: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, ""
+}
@@ -0,0 +1,139 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/runner"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mesh, err := runner.Start(ctx, apis.ServiceGraph{
+		Services: []apis.Service{
+			{Replicas: 1, Edges: []apis.Edge{{Target: 1, Weight: 2}, {Target: 2, LatencyMs: 10}}, Idx: 0, Name: "frontend"},
+			{Replicas: 1, Edges: []apis.Edge{{Target: 2, ErrorRate: 1, Retries: 2}}, Idx: 1},
+			{Replicas: 1, Idx: 2},
+		},
+	}, runner.DefaultConfig())
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	for _, p := range []string{"/health", "/ready"} {
+		resp, err := http.Get("http://" + mesh.Addr(2) + p)
+		if err != nil {
+			t.Fatal("failed", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected 200 on %s got: %d", p, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(mesh.Url(0))
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	res := runner.Response{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal("failed", err)
+	}
+	resp.Body.Close()
+	// Service 1 always fails its call to 2 so the frontend's calls to 1 fail too
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected 502 got: %d", resp.StatusCode)
+	}
+	if res.Service != "frontend" || len(res.Calls) != 3 {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+	if res.Calls[0].Status != http.StatusBadGateway || res.Calls[1].Status != http.StatusBadGateway {
+		t.Errorf("expected calls to service 1 to fail: %+v", res.Calls)
+	}
+	if res.Calls[2].Status != http.StatusOK || res.Calls[2].DurationMs < 10 {
+		t.Errorf("expected call to service 2 to succeed with latency: %+v", res.Calls[2])
+	}
+
+	resp, err = http.Get(mesh.Url(1))
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	res = runner.Response{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal("failed", err)
+	}
+	resp.Body.Close()
+	if len(res.Calls) != 1 || res.Calls[0].Attempts != 3 || res.Calls[0].Error != "injected error" {
+		t.Errorf("expected 3 attempts with injected errors: %+v", res.Calls)
+	}
+
+	cancel()
+	if err := mesh.Wait(); err != nil {
+		t.Error("failed to stop", err)
+	}
+	if _, err := http.Get("http://" + mesh.Addr(0) + "/health"); err == nil {
+		t.Error("expected servers to be stopped")
+	}
+}
+
+func TestWaitDrains(t *testing.T) {
+	graph := apis.ServiceGraph{
+		Services: []apis.Service{
+			{Replicas: 1, Idx: 0},
+			// The slow service is the last one to be shut down.
+			{Replicas: 1, Edges: []apis.Edge{{Target: 0, LatencyMs: 300}}, Idx: 1},
+		},
+	}
+	for _, tc := range []struct {
+		desc    string
+		timeout time.Duration
+		fails   bool
+	}{
+		{desc: "drained", timeout: 5 * time.Second},
+		{desc: "timeout", timeout: 10 * time.Millisecond, fails: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			conf := runner.DefaultConfig()
+			conf.ShutdownTimeout = tc.timeout
+			mesh, err := runner.Start(ctx, graph, conf)
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			start := time.Now()
+			done := make(chan int, 1)
+			go func() {
+				resp, err := http.Get(mesh.Url(1))
+				if err != nil {
+					done <- 0
+					return
+				}
+				resp.Body.Close()
+				done <- resp.StatusCode
+			}()
+			// Let the request start before stopping.
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+			err = mesh.Wait()
+			if tc.fails {
+				if err == nil {
+					t.Error("expected the shutdown timeout to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Error("failed to stop", err)
+			}
+			// The call of service 1 takes 300ms so Wait can't return before it's done.
+			if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+				t.Errorf("Wait returned before the in-flight request was drained: %s", elapsed)
+			}
+			// Service 0 is already stopped when the call is made so only the response of service 1 matters.
+			if status := <-done; status == 0 {
+				t.Error("expected the in-flight request to get a response")
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package simulate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+type Config struct {
+	// Requests the number of requests sent to each entry service (services without callers).
+	Requests int
+	// Seed the seed of the random generator.
+	Seed int64
+	// Parallel whether a service calls its edges in parallel or one after the other.
+	Parallel bool
+	// LatencySigma the latency of an edge follows a log-normal distribution with a median of LatencyMs and this sigma (0 means constant latency).
+	LatencySigma float64
+	// MaxCallsPerRequest the simulation fails if a single request leads to more calls than this (retries included).
+	MaxCallsPerRequest int
+	// JSON outputs the report in JSON instead of a table.
+	JSON bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Requests:           1000,
+		LatencySigma:       0.5,
+		MaxCallsPerRequest: 100_000,
+	}
+}
+
+// Stats statistics of the invocations of a service.
+type Stats struct {
+	Requests    int     `json:"requests"`
+	SuccessRate float64 `json:"successRate"`
+	MeanMs      float64 `json:"meanMs"`
+	P50Ms       float64 `json:"p50Ms"`
+	P99Ms       float64 `json:"p99Ms"`
+}
+
+type ServiceStats struct {
+	Service string `json:"service"`
+	Stats
+}
+
+// PathStats statistics of the calls to the last service of the path as seen by the previous one (retries included).
+type PathStats struct {
+	Path []string `json:"path"`
+	Stats
+}
+
+type Report struct {
+	// Entries end-to-end statistics of the requests sent to each entry service.
+	Entries []ServiceStats `json:"entries"`
+	// Services statistics of every invocation of each service (retries included).
+	Services []ServiceStats `json:"services"`
+	Paths    []PathStats    `json:"paths"`
+}
+
+type samples struct {
+	durations []float64
+	successes int
+}
+
+func (s *samples) add(d float64, ok bool) {
+	s.durations = append(s.durations, d)
+	if ok {
+		s.successes++
+	}
+}
+
+func (s *samples) stats() Stats {
+	if len(s.durations) == 0 {
+		return Stats{}
+	}
+	sorted := append([]float64{}, s.durations...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, d := range sorted {
+		sum += d
+	}
+	return Stats{
+		Requests:    len(sorted),
+		SuccessRate: round(float64(s.successes) / float64(len(sorted))),
+		MeanMs:      round(sum / float64(len(sorted))),
+		P50Ms:       round(percentile(sorted, 0.5)),
+		P99Ms:       round(percentile(sorted, 0.99)),
+	}
+}
+
+// percentile uses the nearest-rank method.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+type simulation struct {
+	conf     Config
+	graph    apis.ServiceGraph
+	random   *rand.Rand
+	services []samples
+	paths    map[string]*samples
+	// calls the number of calls (retries included) done for the current request, the simulation of the request stops
+	// once it is over conf.MaxCallsPerRequest.
+	calls int
+}
+
+// Run simulates conf.Requests requests on each entry service of the graph.
+func Run(graph apis.ServiceGraph, conf Config) (Report, error) {
+	if err := graph.Validate(); err != nil {
+		return Report{}, err
+	}
+	if conf.Requests <= 0 {
+		return Report{}, errors.New("requests must be strictly positive")
+	}
+	if conf.LatencySigma < 0 {
+		return Report{}, errors.New("latencySigma must be positive")
+	}
+	s := &simulation{
+		conf:     conf,
+		graph:    graph,
+		random:   rand.New(rand.NewSource(conf.Seed)),
+		services: make([]samples, len(graph.Services)),
+		paths:    map[string]*samples{},
+	}
+	callers := graph.Callers()
+	var entries []int
+	for _, svc := range graph.Services {
+		if len(callers[svc.Idx]) == 0 {
+			entries = append(entries, svc.Idx)
+		}
+	}
+	// Fail early when a request goes over the maximum even without retries.
+	calls := s.callsPerRequest()
+	for _, e := range entries {
+		if conf.MaxCallsPerRequest > 0 && calls[e] > conf.MaxCallsPerRequest {
+			return Report{}, fmt.Errorf("a request to service %s leads to %d calls which is more than the maximum: %d", graph.Services[e].DisplayName(), calls[e], conf.MaxCallsPerRequest)
+		}
+	}
+
+	entrySamples := make([]samples, len(entries))
+	for i := 0; i < conf.Requests; i++ {
+		for j, e := range entries {
+			s.calls = 0
+			d, ok := s.invoke(e, []int{e})
+			if s.tooManyCalls() {
+				return Report{}, fmt.Errorf("a request to service %s leads to more calls than the maximum: %d (retries included)", graph.Services[e].DisplayName(), conf.MaxCallsPerRequest)
+			}
+			entrySamples[j].add(d, ok)
+		}
+	}
+
+	out := Report{}
+	for j, e := range entries {
+		out.Entries = append(out.Entries, ServiceStats{Service: graph.Services[e].DisplayName(), Stats: entrySamples[j].stats()})
+	}
+	for _, svc := range graph.Services {
+		out.Services = append(out.Services, ServiceStats{Service: svc.DisplayName(), Stats: s.services[svc.Idx].stats()})
+	}
+	var keys []string
+	for k := range s.paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out.Paths = append(out.Paths, PathStats{Path: strings.Split(k, pathSeparator), Stats: s.paths[k].stats()})
+	}
+	return out, nil
+}
+
+const pathSeparator = " -> "
+
+// callsPerRequest the number of calls a request to each service leads to (without retries).
+func (s *simulation) callsPerRequest() []int {
+	out := make([]int, len(s.graph.Services))
+	done := make([]bool, len(s.graph.Services))
+	var count func(idx int) int
+	count = func(idx int) int {
+		if done[idx] {
+			return out[idx]
+		}
+		total := 0
+		for _, e := range s.graph.Services[idx].Edges {
+			total += e.GetWeight() * (1 + count(e.Target))
+			if total > math.MaxInt32 {
+				total = math.MaxInt32
+			}
+		}
+		out[idx], done[idx] = total, true
+		return total
+	}
+	for i := range s.graph.Services {
+		count(i)
+	}
+	return out
+}
+
+// invoke simulates a request to a service and returns how long it took and whether it succeeded.
+func (s *simulation) invoke(idx int, path []int) (float64, bool) {
+	total, ok := 0.0, true
+	for _, e := range s.graph.Services[idx].Edges {
+		for i := 0; i < e.GetWeight() && !s.tooManyCalls(); i++ {
+			d, callOk := s.call(e, append(path[:len(path):len(path)], e.Target))
+			if s.conf.Parallel {
+				total = math.Max(total, d)
+			} else {
+				total += d
+			}
+			ok = ok && callOk
+		}
+	}
+	s.services[idx].add(total, ok)
+	return total, ok
+}
+
+// call simulates a call with its retries and returns how long it took and whether it succeeded.
+func (s *simulation) call(e apis.Edge, path []int) (float64, bool) {
+	timeoutMs, retries := e.TimeoutMs, e.Retries
+	if s.graph.Defaults != nil {
+		if timeoutMs == 0 {
+			timeoutMs = s.graph.Defaults.TimeoutMs
+		}
+		if retries == 0 {
+			retries = s.graph.Defaults.Retries
+		}
+	}
+	total, ok := 0.0, false
+	for attempt := 0; attempt <= retries && !ok && !s.tooManyCalls(); attempt++ {
+		s.calls++
+		d, calleeOk := s.invoke(e.Target, path)
+		d += s.latency(e.LatencyMs)
+		ok = calleeOk && (e.ErrorRate == 0 || s.random.Float64() >= e.ErrorRate)
+		if timeoutMs > 0 && d > float64(timeoutMs) {
+			d, ok = float64(timeoutMs), false
+		}
+		total += d
+	}
+	names := make([]string, len(path))
+	for i, idx := range path {
+		names[i] = s.graph.Services[idx].DisplayName()
+	}
+	key := strings.Join(names, pathSeparator)
+	if s.paths[key] == nil {
+		s.paths[key] = &samples{}
+	}
+	s.paths[key].add(total, ok)
+	return total, ok
+}
+
+func (s *simulation) tooManyCalls() bool {
+	return s.conf.MaxCallsPerRequest > 0 && s.calls > s.conf.MaxCallsPerRequest
+}
+
+func (s *simulation) latency(medianMs int) float64 {
+	if medianMs == 0 {
+		return 0
+	}
+	if s.conf.LatencySigma == 0 {
+		return float64(medianMs)
+	}
+	return float64(medianMs) * math.Exp(s.random.NormFloat64()*s.conf.LatencySigma)
+}
+
+// Generator runs the simulation and outputs the report.
+type Generator struct {
+	Config Config
+}
+
+func (g Generator) Apply(writer io.Writer, graph apis.ServiceGraph) error {
+	report, err := Run(graph, g.Config)
+	if err != nil {
+		return err
+	}
+	if g.Config.JSON {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(append(b, '\n'))
+		return err
+	}
+	return report.WriteTable(writer)
+}
+
+// WriteTable writes the report as human-readable tables.
+func (r Report) WriteTable(writer io.Writer) error {
+	tw := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	write := func(title string, rows [][]string, stats []Stats) {
+		fmt.Fprintf(tw, "%s\tREQUESTS\tSUCCESS\tMEAN(ms)\tP50(ms)\tP99(ms)\n", title)
+		for i, row := range rows {
+			st := stats[i]
+			fmt.Fprintf(tw, "%s\t%d\t%.2f%%\t%.1f\t%.1f\t%.1f\n", strings.Join(row, pathSeparator), st.Requests, st.SuccessRate*100, st.MeanMs, st.P50Ms, st.P99Ms)
+		}
+		fmt.Fprintln(tw)
+	}
+	var rows [][]string
+	var stats []Stats
+	for _, e := range r.Entries {
+		rows, stats = append(rows, []string{e.Service}), append(stats, e.Stats)
+	}
+	write("ENTRY", rows, stats)
+	rows, stats = nil, nil
+	for _, e := range r.Services {
+		rows, stats = append(rows, []string{e.Service}), append(stats, e.Stats)
+	}
+	write("SERVICE", rows, stats)
+	rows, stats = nil, nil
+	for _, p := range r.Paths {
+		rows, stats = append(rows, p.Path), append(stats, p.Stats)
+	}
+	write("PATH", rows, stats)
+	return tw.Flush()
+}
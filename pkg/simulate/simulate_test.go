@@ -0,0 +1,127 @@
+package simulate_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/simulate"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var graph = apis.ServiceGraph{
+	Services: []apis.Service{
+		{Replicas: 1, Edges: []apis.Edge{{Target: 1, LatencyMs: 10}, {Target: 2, LatencyMs: 20}}, Idx: 0, Name: "frontend"},
+		{Replicas: 1, Edges: []apis.Edge{{Target: 2, LatencyMs: 5, ErrorRate: 0.5, Retries: 1}}, Idx: 1},
+		{Replicas: 1, Idx: 2},
+	},
+}
+
+func TestRun(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		parallel bool
+		p50      float64
+	}{
+		{name: "sequential", parallel: false, p50: 35},
+		{name: "parallel", parallel: true, p50: 20},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := simulate.DefaultConfig()
+			conf.LatencySigma = 0
+			conf.Parallel = tc.parallel
+			report, err := simulate.Run(graph, conf)
+			if err != nil {
+				t.Fatal("failed", err)
+			}
+			if len(report.Entries) != 1 || report.Entries[0].Service != "frontend" {
+				t.Fatalf("unexpected entries: %+v", report.Entries)
+			}
+			entry := report.Entries[0]
+			// 1 -> 2 fails 25% of the time after a retry
+			if entry.Requests != 1000 || entry.SuccessRate < 0.7 || entry.SuccessRate > 0.8 {
+				t.Errorf("unexpected success rate: %+v", entry)
+			}
+			if entry.P50Ms != tc.p50 {
+				t.Errorf("expected p50 of %f got: %+v", tc.p50, entry)
+			}
+			if len(report.Paths) != 3 || !reflect.DeepEqual(report.Paths[1].Path, []string{"frontend", "1", "2"}) {
+				t.Errorf("unexpected paths: %+v", report.Paths)
+			}
+			// Service 2 is called directly by frontend and by 1 with retries
+			if report.Services[2].Requests <= 2000 {
+				t.Errorf("expected retries to be counted: %+v", report.Services[2])
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	conf := simulate.DefaultConfig()
+	conf.LatencySigma = 0
+	report, err := simulate.Run(apis.ServiceGraph{
+		Services: []apis.Service{
+			{Replicas: 1, Edges: []apis.Edge{{Target: 1, LatencyMs: 100, TimeoutMs: 50, Retries: 2}}, Idx: 0},
+			{Replicas: 1, Idx: 1},
+		},
+	}, conf)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	if entry := report.Entries[0]; entry.SuccessRate != 0 || entry.P99Ms != 150 {
+		t.Errorf("expected all calls to time out after 3 attempts: %+v", entry)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	conf := simulate.DefaultConfig()
+	conf.Seed = 42
+	a, _ := simulate.Run(graph, conf)
+	b, _ := simulate.Run(graph, conf)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("expected same reports with the same seed")
+	}
+}
+
+func TestTooManyCalls(t *testing.T) {
+	conf := simulate.DefaultConfig()
+	conf.MaxCallsPerRequest = 2
+	if _, err := simulate.Run(graph, conf); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestTooManyRetries(t *testing.T) {
+	// Every call fails so each one is retried: a request leads to 4^20 calls.
+	deep := apis.ServiceGraph{}
+	for i := 0; i < 20; i++ {
+		deep.Services = append(deep.Services, apis.Service{Replicas: 1, Idx: i, Edges: []apis.Edge{{Target: i + 1, ErrorRate: 1, Retries: 3}}})
+	}
+	deep.Services = append(deep.Services, apis.Service{Replicas: 1, Idx: 20})
+	_, err := simulate.Run(deep, simulate.DefaultConfig())
+	if err == nil || !strings.Contains(err.Error(), "retries included") {
+		t.Errorf("expected an error got: %v", err)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := (simulate.Generator{Config: simulate.DefaultConfig()}).Apply(&buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	if !strings.Contains(buf.String(), "frontend -> 1 -> 2") {
+		t.Errorf("expected table to contain the paths got:\n%s", buf.String())
+	}
+	conf := simulate.DefaultConfig()
+	conf.JSON = true
+	buf.Reset()
+	if err := (simulate.Generator{Config: conf}).Apply(&buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	report := simulate.Report{}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal("failed", err)
+	}
+	println(buf.String())
+}
@@ -0,0 +1,325 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ServiceStats the position of a service in the graph.
+type ServiceStats struct {
+	Service string `json:"service"`
+	// FanIn the number of distinct services calling this service.
+	FanIn int `json:"fanIn"`
+	// FanOut the number of distinct services this service calls.
+	FanOut int `json:"fanOut"`
+	// Depth the number of calls of the longest chain from an entry service to this service.
+	Depth int `json:"depth"`
+	// Betweenness the number of shortest call chains between 2 other services going through this service
+	// (when there are multiple shortest chains between 2 services each one counts as a fraction).
+	Betweenness float64 `json:"betweenness"`
+}
+
+type Report struct {
+	Services  int     `json:"services"`
+	Edges     int     `json:"edges"`
+	MaxFanIn  int     `json:"maxFanIn"`
+	MaxFanOut int     `json:"maxFanOut"`
+	AvgFanIn  float64 `json:"avgFanIn"`
+	AvgFanOut float64 `json:"avgFanOut"`
+	// LongestChain the services of the longest call chain (the first one if there are multiple).
+	LongestChain []string `json:"longestChain"`
+	// Entries the services no one calls.
+	Entries []string `json:"entries"`
+	// Leaves the services calling no one.
+	Leaves []string `json:"leaves"`
+	// Components the groups of services connected by calls (ignoring the direction of the calls).
+	Components [][]string     `json:"components"`
+	PerService []ServiceStats `json:"perService"`
+}
+
+// MaxBetweennessWork the maximum of services * (services + edges) which bounds the cost of computing betweenness.
+const MaxBetweennessWork = 100_000_000
+
+// ErrTooLarge is returned when a graph goes over MaxBetweennessWork.
+var ErrTooLarge = errors.New("graph is too large to compute stats")
+
+// Compute computes the stats of a graph, duplicate edges between 2 services are counted once.
+// It fails with ErrTooLarge if the graph goes over MaxBetweennessWork.
+func Compute(graph apis.ServiceGraph) (Report, error) {
+	if err := graph.Validate(); err != nil {
+		return Report{}, err
+	}
+	n := len(graph.Services)
+	names := make([]string, n)
+	for i, svc := range graph.Services {
+		names[i] = svc.DisplayName()
+	}
+	callees := make([][]int, n)
+	for _, svc := range graph.Services {
+		seen := map[int]bool{}
+		for _, e := range svc.Edges {
+			if !seen[e.Target] {
+				seen[e.Target] = true
+				callees[svc.Idx] = append(callees[svc.Idx], e.Target)
+			}
+		}
+		sort.Ints(callees[svc.Idx])
+	}
+	edges := 0
+	for _, c := range callees {
+		edges += len(c)
+	}
+	if work := n * (n + edges); work > MaxBetweennessWork {
+		return Report{}, fmt.Errorf("%w: %d services and %d edges (max services * (services + edges): %d)", ErrTooLarge, n, edges, MaxBetweennessWork)
+	}
+	callers := graph.Callers()
+
+	out := Report{
+		Services:     n,
+		LongestChain: []string{},
+		Entries:      []string{},
+		Leaves:       []string{},
+		Components:   [][]string{},
+		PerService:   []ServiceStats{},
+	}
+	for i := 0; i < n; i++ {
+		fanIn, fanOut := len(callers[i]), len(callees[i])
+		out.Edges += fanOut
+		out.MaxFanIn = max(out.MaxFanIn, fanIn)
+		out.MaxFanOut = max(out.MaxFanOut, fanOut)
+		if fanIn == 0 {
+			out.Entries = append(out.Entries, names[i])
+		}
+		if fanOut == 0 {
+			out.Leaves = append(out.Leaves, names[i])
+		}
+	}
+	if n > 0 {
+		// Each edge is counted once as fan-in and once as fan-out so both averages are the same.
+		out.AvgFanIn = round(float64(out.Edges) / float64(n))
+		out.AvgFanOut = out.AvgFanIn
+	}
+
+	depths := depths(callees)
+	betweenness := betweenness(callees)
+	for i := 0; i < n; i++ {
+		out.PerService = append(out.PerService, ServiceStats{
+			Service:     names[i],
+			FanIn:       len(callers[i]),
+			FanOut:      len(callees[i]),
+			Depth:       depths[i],
+			Betweenness: round(betweenness[i]),
+		})
+	}
+	for _, idx := range longestChain(callees) {
+		out.LongestChain = append(out.LongestChain, names[idx])
+	}
+	for _, component := range components(callees) {
+		var members []string
+		for _, idx := range component {
+			members = append(members, names[idx])
+		}
+		out.Components = append(out.Components, members)
+	}
+	return out, nil
+}
+
+// topologicalOrder returns the services so that callers are always before their callees.
+func topologicalOrder(callees [][]int) []int {
+	var order []int
+	visited := make([]bool, len(callees))
+	var visit func(n int)
+	visit = func(n int) {
+		if visited[n] {
+			return
+		}
+		visited[n] = true
+		for _, t := range callees[n] {
+			visit(t)
+		}
+		order = append(order, n)
+	}
+	for i := range callees {
+		visit(i)
+	}
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+func depths(callees [][]int) []int {
+	out := make([]int, len(callees))
+	for _, n := range topologicalOrder(callees) {
+		for _, t := range callees[n] {
+			out[t] = max(out[t], out[n]+1)
+		}
+	}
+	return out
+}
+
+// longestChain the services of the longest path in the graph, ties are broken by picking the lowest idx.
+func longestChain(callees [][]int) []int {
+	if len(callees) == 0 {
+		return nil
+	}
+	// length[n] the number of calls of the longest chain starting at n and next[n] the following service in it.
+	length := make([]int, len(callees))
+	next := make([]int, len(callees))
+	order := topologicalOrder(callees)
+	for i := len(order) - 1; i >= 0; i-- {
+		n := order[i]
+		next[n] = -1
+		for _, t := range callees[n] {
+			if next[n] == -1 || length[t]+1 > length[n] {
+				length[n], next[n] = length[t]+1, t
+			}
+		}
+	}
+	start := 0
+	for n := range callees {
+		if length[n] > length[start] {
+			start = n
+		}
+	}
+	out := []int{start}
+	for n := next[start]; n != -1; n = next[n] {
+		out = append(out, n)
+	}
+	return out
+}
+
+// components the weakly connected components of the graph sorted by their lowest idx.
+func components(callees [][]int) [][]int {
+	parent := make([]int, len(callees))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(n int) int
+	find = func(n int) int {
+		if parent[n] != n {
+			parent[n] = find(parent[n])
+		}
+		return parent[n]
+	}
+	for n, targets := range callees {
+		for _, t := range targets {
+			a, b := find(n), find(t)
+			// Keep the lowest idx as root so components come out in order.
+			if a < b {
+				parent[b] = a
+			} else if b < a {
+				parent[a] = b
+			}
+		}
+	}
+	var out [][]int
+	pos := map[int]int{}
+	for n := range callees {
+		root := find(n)
+		if _, exists := pos[root]; !exists {
+			pos[root] = len(out)
+			out = append(out, nil)
+		}
+		out[pos[root]] = append(out[pos[root]], n)
+	}
+	return out
+}
+
+// betweenness the betweenness centrality of each service using Brandes' algorithm on the directed graph.
+func betweenness(callees [][]int) []float64 {
+	n := len(callees)
+	out := make([]float64, n)
+	for s := 0; s < n; s++ {
+		var stack []int
+		predecessors := make([][]int, n)
+		paths := make([]float64, n)
+		dist := make([]int, n)
+		for i := range dist {
+			dist[i] = -1
+		}
+		paths[s], dist[s] = 1, 0
+		queue := []int{s}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, w := range callees[v] {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					paths[w] += paths[v]
+					predecessors[w] = append(predecessors[w], v)
+				}
+			}
+		}
+		dependency := make([]float64, n)
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range predecessors[w] {
+				dependency[v] += paths[v] / paths[w] * (1 + dependency[w])
+			}
+			if w != s {
+				out[w] += dependency[w]
+			}
+		}
+	}
+	return out
+}
+
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+// Generator computes the stats of the graph and outputs them.
+type Generator struct {
+	// JSON outputs the report in JSON instead of a table.
+	JSON bool
+}
+
+func (g Generator) Apply(writer io.Writer, graph apis.ServiceGraph) error {
+	report, err := Compute(graph)
+	if err != nil {
+		return err
+	}
+	if g.JSON {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(append(b, '\n'))
+		return err
+	}
+	return report.WriteTable(writer)
+}
+
+// WriteTable writes the report as human-readable tables.
+func (r Report) WriteTable(writer io.Writer) error {
+	tw := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "services:\t%d\n", r.Services)
+	fmt.Fprintf(tw, "edges:\t%d\n", r.Edges)
+	fmt.Fprintf(tw, "fan-in:\tmax %d, avg %.2f\n", r.MaxFanIn, r.AvgFanIn)
+	fmt.Fprintf(tw, "fan-out:\tmax %d, avg %.2f\n", r.MaxFanOut, r.AvgFanOut)
+	fmt.Fprintf(tw, "longest chain:\t%s (%d calls)\n", strings.Join(r.LongestChain, " -> "), max(len(r.LongestChain)-1, 0))
+	fmt.Fprintf(tw, "entries:\t%s\n", strings.Join(r.Entries, ", "))
+	fmt.Fprintf(tw, "leaves:\t%s\n", strings.Join(r.Leaves, ", "))
+	fmt.Fprintf(tw, "components:\t%d\n", len(r.Components))
+	for i, c := range r.Components {
+		fmt.Fprintf(tw, "  %d:\t%s\n", i, strings.Join(c, ", "))
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "SERVICE\tFAN-IN\tFAN-OUT\tDEPTH\tBETWEENNESS\n")
+	for _, s := range r.PerService {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.3f\n", s.Service, s.FanIn, s.FanOut, s.Depth, s.Betweenness)
+	}
+	return tw.Flush()
+}
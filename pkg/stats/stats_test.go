@@ -0,0 +1,95 @@
+package stats_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/lahabana/microservice-mesh-generator/pkg/apis"
+	"github.com/lahabana/microservice-mesh-generator/pkg/stats"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A diamond 0 -> (1, 2) -> 3 -> 4 and a separate 6 -> 5.
+var graph = apis.ServiceGraph{
+	Services: []apis.Service{
+		{Replicas: 1, Edges: apis.EdgesTo(1, 2), Idx: 0, Name: "frontend"},
+		{Replicas: 1, Edges: apis.EdgesTo(3, 3), Idx: 1},
+		{Replicas: 1, Edges: apis.EdgesTo(3), Idx: 2},
+		{Replicas: 1, Edges: apis.EdgesTo(4), Idx: 3},
+		{Replicas: 1, Idx: 4},
+		{Replicas: 1, Idx: 5},
+		{Replicas: 1, Edges: apis.EdgesTo(5), Idx: 6},
+	},
+}
+
+func TestCompute(t *testing.T) {
+	report, err := stats.Compute(graph)
+	if err != nil {
+		t.Fatal("failed", err)
+	}
+	if report.Services != 7 || report.Edges != 6 || report.MaxFanIn != 2 || report.MaxFanOut != 2 || report.AvgFanOut != 0.857 {
+		t.Errorf("unexpected counts: %+v", report)
+	}
+	if !reflect.DeepEqual(report.LongestChain, []string{"frontend", "1", "3", "4"}) {
+		t.Errorf("unexpected longest chain: %v", report.LongestChain)
+	}
+	if !reflect.DeepEqual(report.Entries, []string{"frontend", "6"}) || !reflect.DeepEqual(report.Leaves, []string{"4", "5"}) {
+		t.Errorf("unexpected entries: %v or leaves: %v", report.Entries, report.Leaves)
+	}
+	if !reflect.DeepEqual(report.Components, [][]string{{"frontend", "1", "2", "3", "4"}, {"5", "6"}}) {
+		t.Errorf("unexpected components: %v", report.Components)
+	}
+	expected := []stats.ServiceStats{
+		{Service: "frontend", FanIn: 0, FanOut: 2, Depth: 0, Betweenness: 0},
+		{Service: "1", FanIn: 1, FanOut: 1, Depth: 1, Betweenness: 1},
+		{Service: "2", FanIn: 1, FanOut: 1, Depth: 1, Betweenness: 1},
+		{Service: "3", FanIn: 2, FanOut: 1, Depth: 2, Betweenness: 3},
+		{Service: "4", FanIn: 1, FanOut: 0, Depth: 3, Betweenness: 0},
+		{Service: "5", FanIn: 1, FanOut: 0, Depth: 1, Betweenness: 0},
+		{Service: "6", FanIn: 0, FanOut: 1, Depth: 0, Betweenness: 0},
+	}
+	if !reflect.DeepEqual(report.PerService, expected) {
+		t.Errorf("unexpected per service stats: %+v", report.PerService)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := (stats.Generator{}).Apply(&buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	for _, s := range []string{"edges:          6\n", "longest chain:  frontend -> 1 -> 3 -> 4 (3 calls)\n", "3         2       1        2      3.000\n"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %q in output:\n%s", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := (stats.Generator{JSON: true}).Apply(&buf, graph); err != nil {
+		t.Fatal("failed", err)
+	}
+	report := stats.Report{}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal("invalid json", err)
+	}
+	if report.Edges != 6 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestComputeTooLarge(t *testing.T) {
+	// 2000 services each calling the next 30 gives 2000 * (2000 + 59535) > MaxBetweennessWork.
+	large := apis.ServiceGraph{}
+	for i := 0; i < 2000; i++ {
+		var targets []int
+		for j := i + 1; j < 2000 && j <= i+30; j++ {
+			targets = append(targets, j)
+		}
+		large.Services = append(large.Services, apis.Service{Replicas: 1, Edges: apis.EdgesTo(targets...), Idx: i})
+	}
+	if _, err := stats.Compute(large); !errors.Is(err, stats.ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got: %v", err)
+	}
+}